@@ -0,0 +1,103 @@
+// Package events holds the CloudEvents envelope and the JSON Schema event
+// contracts shared by the Go producers and consumers. The schemas are the
+// JSON files beside this package, embedded as they are, so there is one copy
+// of each contract.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SpecVersion is the CloudEvents specification version
+	SpecVersion = "1.0"
+
+	// typePrefix is prepended to event names to form the CloudEvents type
+	typePrefix = "com.bankflow."
+
+	contentTypeJSON = "application/json"
+)
+
+var ErrInvalidEnvelope = errors.New("invalid event envelope")
+
+// Envelope is a CloudEvents 1.0 envelope around a JSON payload. Sequence is
+// the CloudEvents sequence extension: a per-subject counter that increases by
+// one with every event about that subject.
+type Envelope struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	Sequence        int64           `json:"sequence,omitempty"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// New wraps data from source in an envelope after checking it against the
+// schema registered for eventType
+func New(source, eventType, subject string, data interface{}) (*Envelope, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := schemaFor(eventType)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.validate(payload); err != nil {
+		return nil, fmt.Errorf("%s: %w", eventType, err)
+	}
+
+	return &Envelope{
+		SpecVersion:     SpecVersion,
+		ID:              uuid.NewString(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: contentTypeJSON,
+		DataSchema:      schema.ID,
+		Data:            payload,
+	}, nil
+}
+
+// Validate checks the required CloudEvents attributes and, for types with a
+// registered schema, the payload
+func (e *Envelope) Validate() error {
+	if e.SpecVersion != SpecVersion || e.ID == "" || e.Source == "" || e.Type == "" {
+		return ErrInvalidEnvelope
+	}
+
+	schema, err := schemaFor(e.Type)
+	if err != nil {
+		// Events from producers without contracts, such as
+		// transaction-service, are not described here
+		return nil
+	}
+	return schema.validate(e.Data)
+}
+
+// Decode unmarshals the payload into v
+func (e *Envelope) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// Name returns the event type without the namespace and version, for
+// example "account.created"
+func (e *Envelope) Name() string {
+	name := strings.TrimPrefix(e.Type, typePrefix)
+	if i := strings.LastIndex(name, ".v"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
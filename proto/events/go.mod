@@ -0,0 +1,5 @@
+module github.com/Caesarsage/bankflow/proto/events
+
+go 1.24.0
+
+require github.com/google/uuid v1.6.0
@@ -0,0 +1,239 @@
+package events
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// schemaFiles are the event contracts of every producer, one directory each
+//
+//go:embed */*.json
+var schemaFiles embed.FS
+
+// schema is the subset of JSON Schema used by the event contracts
+type schema struct {
+	ID                   string             `json:"$id"`
+	Type                 schemaType         `json:"type"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Enum                 []interface{}      `json:"enum"`
+	Format               string             `json:"format"`
+	Pattern              string             `json:"pattern"`
+	Items                *schema            `json:"items"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaType accepts both "string" and ["string", "null"] forms
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = schemaType{one}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+var schemas = mustLoadSchemas()
+
+func mustLoadSchemas() map[string]*schema {
+	files, err := fs.Glob(schemaFiles, "*/*.json")
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := make(map[string]*schema, len(files))
+	for _, file := range files {
+		raw, err := schemaFiles.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+
+		s := &schema{}
+		if err := json.Unmarshal(raw, s); err != nil {
+			panic(fmt.Sprintf("events: parse %s: %v", file, err))
+		}
+		if err := s.compile(); err != nil {
+			panic(fmt.Sprintf("events: compile %s: %v", file, err))
+		}
+
+		loaded[typePrefix+strings.TrimSuffix(path.Base(file), ".json")] = s
+	}
+
+	return loaded
+}
+
+func schemaFor(eventType string) (*schema, error) {
+	s, ok := schemas[eventType]
+	if !ok {
+		return nil, fmt.Errorf("no schema registered for event type %q", eventType)
+	}
+	return s, nil
+}
+
+// HasSchema reports whether eventType has a registered schema
+func HasSchema(eventType string) bool {
+	_, ok := schemas[eventType]
+	return ok
+}
+
+// Types returns the event types with a registered schema, of every producer
+func Types() []string {
+	types := make([]string, 0, len(schemas))
+	for t := range schemas {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func (s *schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+	for _, prop := range s.Properties {
+		if err := prop.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+func (s *schema) validate(payload []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return err
+	}
+	return s.check("$", v)
+}
+
+func (s *schema) check(at string, v interface{}) error {
+	if len(s.Type) > 0 && !s.Type.allows(v) {
+		return fmt.Errorf("%s: expected %s", at, strings.Join(s.Type, " or "))
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if e == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value %v not allowed", at, v)
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		return s.checkString(at, val)
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range val {
+				if err := s.Items.check(fmt.Sprintf("%s[%d]", at, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", at, name)
+			}
+		}
+		for name, field := range val {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: unexpected property %q", at, name)
+				}
+				continue
+			}
+			if err := prop.check(at+"."+name, field); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *schema) checkString(at, v string) error {
+	switch s.Format {
+	case "uuid":
+		if _, err := uuid.Parse(v); err != nil {
+			return fmt.Errorf("%s: invalid uuid", at)
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+			return fmt.Errorf("%s: invalid date-time", at)
+		}
+	}
+
+	if s.pattern != nil && !s.pattern.MatchString(v) {
+		return fmt.Errorf("%s: does not match %s", at, s.Pattern)
+	}
+	return nil
+}
+
+func (t schemaType) allows(v interface{}) bool {
+	for _, name := range t {
+		switch name {
+		case "null":
+			if v == nil {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		case "integer":
+			if f, ok := v.(float64); ok && f == float64(int64(f)) {
+				return true
+			}
+		case "object":
+			if _, ok := v.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]interface{}); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+#!/usr/bin/env bash
+# Generates a development CA, a server certificate for account-service and a
+# client certificate for transaction-service, for gRPC mutual TLS.
+# Client certificates are identified by their common name.
+#
+# Usage: scripts/gen-grpc-certs.sh [output-dir]
+set -euo pipefail
+
+OUT="${1:-certs}"
+DAYS=365
+mkdir -p "$OUT"
+
+openssl req -x509 -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes \
+  -keyout "$OUT/ca-key.pem" -out "$OUT/ca.pem" -days "$DAYS" \
+  -subj "/CN=bankflow-dev-ca"
+
+# issue <name> <extensions>
+issue() {
+  local name="$1" ext="$2"
+  openssl req -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes \
+    -keyout "$OUT/$name-key.pem" -out "$OUT/$name.csr" -subj "/CN=$name"
+  openssl x509 -req -in "$OUT/$name.csr" -CA "$OUT/ca.pem" -CAkey "$OUT/ca-key.pem" \
+    -CAcreateserial -out "$OUT/$name.pem" -days "$DAYS" -extfile <(printf '%s' "$ext")
+  rm "$OUT/$name.csr"
+}
+
+issue account-service "subjectAltName=DNS:account-service,DNS:localhost
+extendedKeyUsage=serverAuth"
+issue transaction-service "extendedKeyUsage=clientAuth"
+
+echo "Certificates written to $OUT"
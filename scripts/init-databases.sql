@@ -11,10 +11,15 @@ CREATE TABLE users (
     phone VARCHAR(20) UNIQUE,
     password_hash VARCHAR(255) NOT NULL,
     is_verified BOOLEAN DEFAULT FALSE,
+    email_verified BOOLEAN DEFAULT FALSE,
+    phone_verified BOOLEAN DEFAULT FALSE,
+    mfa_enabled BOOLEAN DEFAULT FALSE,
     is_active BOOLEAN DEFAULT TRUE,
+    password_reset_required BOOLEAN DEFAULT FALSE,
     failed_login_attempts INT DEFAULT 0,
     locked_until TIMESTAMP,
     last_login TIMESTAMP,
+    tokens_valid_after TIMESTAMP,
     created_at TIMESTAMP DEFAULT NOW(),
     updated_at TIMESTAMP DEFAULT NOW()
 );
@@ -22,18 +27,272 @@ CREATE TABLE users (
 CREATE TABLE sessions (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
     user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
-    refresh_token VARCHAR(500) NOT NULL,
+    refresh_token_hash VARCHAR(64) UNIQUE NOT NULL,
+    family_id UUID NOT NULL,
+    parent_id UUID,
+    rotated_at TIMESTAMP,
+    revoked_at TIMESTAMP,
     expires_at TIMESTAMP NOT NULL,
     ip_address VARCHAR(45),
     user_agent TEXT,
+    auth_time TIMESTAMP,
+    amr TEXT[] NOT NULL DEFAULT '{}',
     created_at TIMESTAMP DEFAULT NOW()
 );
 
+CREATE TABLE outbox_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    position BIGSERIAL,
+    aggregate_id UUID NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP DEFAULT NOW(),
+    sent_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE password_reset_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE password_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE verification_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    channel VARCHAR(10) NOT NULL,
+    destination VARCHAR(255) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    attempts INT DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE user_mfa (
+    user_id UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret_encrypted TEXT NOT NULL,
+    confirmed_at TIMESTAMP,
+    last_used_step BIGINT DEFAULT 0,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE mfa_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    attempts INT DEFAULT 0,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    device_fingerprint VARCHAR(64),
+    method VARCHAR(10) NOT NULL DEFAULT 'totp',
+    code_hash VARCHAR(64),
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE user_devices (
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    fingerprint VARCHAR(64) NOT NULL,
+    user_agent TEXT,
+    last_ip_address VARCHAR(45),
+    first_seen_at TIMESTAMP DEFAULT NOW(),
+    last_seen_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (user_id, fingerprint)
+);
+
+CREATE TABLE login_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    session_id UUID,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    device_fingerprint VARCHAR(64),
+    country VARCHAR(2),
+    city VARCHAR(255),
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    suspicious_reasons TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE revoked_tokens (
+    kind VARCHAR(10) NOT NULL,
+    token_id VARCHAR(64) NOT NULL,
+    user_id UUID REFERENCES users (id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (kind, token_id)
+);
+
+CREATE TABLE roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE permissions (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT
+);
+
+CREATE TABLE role_permissions (
+    role_name VARCHAR(50) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    permission_name VARCHAR(100) NOT NULL REFERENCES permissions (name) ON DELETE CASCADE,
+    PRIMARY KEY (role_name, permission_name)
+);
+
+CREATE TABLE user_roles (
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_name VARCHAR(50) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    assigned_by UUID,
+    assigned_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_name)
+);
+
+CREATE TABLE oauth_clients (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    client_id VARCHAR(64) UNIQUE NOT NULL,
+    secret_hash VARCHAR(64) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    public BOOLEAN DEFAULT FALSE,
+    created_by UUID REFERENCES users (id) ON DELETE SET NULL,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE oauth_authorization_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    code_hash VARCHAR(64) UNIQUE NOT NULL,
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    nonce TEXT,
+    code_challenge VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE oauth_consents (
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    granted_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (user_id, client_id)
+);
+
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) UNIQUE NOT NULL,
+    key_hash VARCHAR(64) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Kept when users are deleted, so there are no foreign keys
+CREATE TABLE admin_audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    admin_id UUID NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    target_user_id UUID,
+    details JSONB NOT NULL DEFAULT '{}',
+    ip_address VARCHAR(45),
+    created_at TIMESTAMP DEFAULT NOW()
+);
+INSERT INTO permissions (name, description) VALUES
+    ('accounts:read', 'View any customer account'),
+    ('accounts:update', 'Change account status and interest rate'),
+    ('accounts:freeze', 'Freeze and unfreeze accounts'),
+    ('accounts:close', 'Close accounts'),
+    ('accounts:transact', 'Move money and place holds on any account'),
+    ('accounts:own', 'Use your own accounts; lets API keys and OAuth clients reach them'),
+    ('roles:manage', 'Create roles and assign them to users'),
+    ('sessions:manage', 'List and revoke other users'' sessions'),
+    ('clients:manage', 'Register and revoke OAuth clients'),
+    ('users:manage', 'Search, deactivate, unlock and reset user accounts');
+
+INSERT INTO roles (name, description) VALUES
+    ('customer', 'Bank customer, assigned on registration'),
+    ('teller', 'Branch staff'),
+    ('admin', 'Administrator');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('customer', 'accounts:own'),
+    ('teller', 'accounts:read'),
+    ('teller', 'accounts:freeze'),
+    ('admin', 'accounts:read'),
+    ('admin', 'accounts:update'),
+    ('admin', 'accounts:freeze'),
+    ('admin', 'accounts:close'),
+    ('admin', 'roles:manage'),
+    ('admin', 'sessions:manage'),
+    ('admin', 'clients:manage'),
+    ('admin', 'users:manage');
+
 CREATE INDEX idx_users_email ON users (email);
 
 CREATE INDEX idx_sessions_user_id ON sessions (user_id);
 
-CREATE INDEX idx_sessions_token ON sessions (refresh_token);
+CREATE INDEX idx_sessions_family_id ON sessions (family_id);
+
+CREATE INDEX idx_password_reset_user_id ON password_reset_tokens (user_id);
+
+CREATE INDEX idx_password_history_user_id ON password_history (user_id, created_at);
+
+CREATE INDEX idx_verification_user_channel ON verification_codes (user_id, channel, created_at);
+
+CREATE INDEX idx_verification_code_hash ON verification_codes (code_hash);
+
+CREATE INDEX idx_recovery_codes_user_id ON mfa_recovery_codes (user_id);
+
+CREATE INDEX idx_login_history_user_id ON login_history (user_id, created_at);
+
+CREATE INDEX idx_admin_audit_log_admin_id ON admin_audit_log (admin_id, created_at);
+
+CREATE INDEX idx_admin_audit_log_target_user_id ON admin_audit_log (target_user_id, created_at);
+
+CREATE INDEX idx_outbox_pending ON outbox_events (position) WHERE sent_at IS NULL;
+
+CREATE INDEX idx_outbox_pending_aggregate ON outbox_events (aggregate_id, position) WHERE sent_at IS NULL;
+
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE INDEX idx_user_roles_role_name ON user_roles (role_name);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
+
+CREATE INDEX idx_authorization_codes_expires_at ON oauth_authorization_codes (expires_at);
 
 -- Customer Service Database
 \c postgres;
@@ -95,6 +354,8 @@ CREATE TABLE accounts (
     available_balance DECIMAL(15, 2) DEFAULT 0.00,
     status VARCHAR(50) DEFAULT 'ACTIVE',
     interest_rate DECIMAL(5, 2) DEFAULT 0.00,
+    interest_accrued_at TIMESTAMP,
+    event_sequence BIGINT DEFAULT 0,
     opened_at TIMESTAMP DEFAULT NOW(),
     closed_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT NOW(),
@@ -112,6 +373,37 @@ CREATE TABLE account_holds (
     created_at TIMESTAMP DEFAULT NOW()
 );
 
+CREATE TABLE outbox_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    position BIGSERIAL,
+    aggregate_id UUID NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP DEFAULT NOW(),
+    sent_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE journal_entries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    position BIGSERIAL NOT NULL,
+    account_id UUID NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    entry_type VARCHAR(20) NOT NULL,
+    amount DECIMAL(15, 2) NOT NULL,
+    balance_after DECIMAL(15, 2) NOT NULL,
+    reference VARCHAR(100),
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE account_balances_shadow (
+    account_id UUID PRIMARY KEY,
+    balance DECIMAL(15, 2) NOT NULL,
+    available_balance DECIMAL(15, 2) NOT NULL,
+    rebuilt_at TIMESTAMP DEFAULT NOW()
+);
+
 CREATE INDEX idx_accounts_customer ON accounts (customer_id);
 
 CREATE INDEX idx_accounts_number ON accounts (account_number);
@@ -120,6 +412,12 @@ CREATE INDEX idx_accounts_status ON accounts (status);
 
 CREATE INDEX idx_holds_account ON account_holds (account_id);
 
+CREATE INDEX idx_journal_account ON journal_entries (account_id, position);
+
+CREATE INDEX idx_outbox_pending ON outbox_events (position) WHERE sent_at IS NULL;
+
+CREATE INDEX idx_outbox_pending_aggregate ON outbox_events (aggregate_id, position) WHERE sent_at IS NULL;
+
 -- Transaction Service Database
 \c postgres;
 
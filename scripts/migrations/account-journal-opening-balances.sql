@@ -0,0 +1,54 @@
+-- Upgrades an account_db created before the balance journal. Run it once
+-- against account_db while account-service is stopped, or at least before
+-- running rebuild-projections:
+--
+--   psql -d account_db -f scripts/migrations/account-journal-opening-balances.sql
+--
+-- Each account gets an OPENING_BALANCE entry for the part of its balance the
+-- journal does not explain, so rebuilding balances from the journal starts
+-- from the real balance instead of zero. Opening entries take position 0 so
+-- they replay before any entries already written. Accounts that already have
+-- one are skipped, so running the script again is harmless.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    position BIGSERIAL NOT NULL,
+    account_id UUID NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    entry_type VARCHAR(20) NOT NULL,
+    amount DECIMAL(15, 2) NOT NULL,
+    balance_after DECIMAL(15, 2) NOT NULL,
+    reference VARCHAR(100),
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS account_balances_shadow (
+    account_id UUID PRIMARY KEY,
+    balance DECIMAL(15, 2) NOT NULL,
+    available_balance DECIMAL(15, 2) NOT NULL,
+    rebuilt_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_journal_account ON journal_entries (account_id, position);
+
+-- No balance may change between reading it and journaling it
+LOCK TABLE accounts IN SHARE MODE;
+
+INSERT INTO journal_entries (position, account_id, entry_type, amount, balance_after, reference)
+SELECT 0, a.id, 'OPENING_BALANCE', opening.amount, opening.amount, 'balance before the journal'
+FROM accounts a
+CROSS JOIN LATERAL (
+    SELECT a.balance - COALESCE(SUM(j.amount), 0) AS amount
+    FROM journal_entries j
+    WHERE j.account_id = a.id
+) opening
+WHERE NOT EXISTS (
+    SELECT 1 FROM journal_entries j
+    WHERE j.account_id = a.id AND j.entry_type = 'OPENING_BALANCE'
+)
+AND opening.amount <> 0;
+
+GRANT ALL PRIVILEGES ON journal_entries, account_balances_shadow TO bankflow;
+
+COMMIT;
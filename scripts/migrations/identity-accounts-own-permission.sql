@@ -0,0 +1,15 @@
+-- Adds the accounts:own permission that API keys and OAuth clients need as a
+-- scope to reach the accounts of the customer they act for, and grants it to
+-- customers. Safe to run more than once:
+--
+--   psql -f scripts/migrations/identity-accounts-own-permission.sql
+
+\c identity_db;
+
+INSERT INTO permissions (name, description)
+VALUES ('accounts:own', 'Use your own accounts; lets API keys and OAuth clients reach them')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_name, permission_name)
+VALUES ('customer', 'accounts:own')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,19 @@
+-- Removes the reset tokens and one-time codes kept in identity-service outbox
+-- events that were already published. The relay removes them from events it
+-- sends from now on. Safe to run more than once:
+--
+--   psql -f scripts/migrations/identity-outbox-redact-secrets.sql
+
+\c identity_db;
+
+UPDATE outbox_events
+SET payload = payload #- '{data,reset_token}'
+WHERE sent_at IS NOT NULL
+  AND event_type = 'com.bankflow.user.password_reset_requested.v1'
+  AND payload #> '{data,reset_token}' IS NOT NULL;
+
+UPDATE outbox_events
+SET payload = payload #- '{data,code}'
+WHERE sent_at IS NOT NULL
+  AND event_type IN ('com.bankflow.user.verification_requested.v1', 'com.bankflow.user.login.step_up_requested.v1')
+  AND payload #> '{data,code}' IS NOT NULL;
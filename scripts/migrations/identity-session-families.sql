@@ -0,0 +1,35 @@
+-- Upgrades the sessions table of an identity_db created before refresh token
+-- rotation. Sessions kept the plaintext refresh token; they now keep its
+-- hash and the family it was rotated from. Existing sessions cannot be put
+-- in a family, so they are deleted and their users log in again. Safe to run
+-- more than once; sessions are only deleted the first time:
+--
+--   psql -f scripts/migrations/identity-session-families.sql
+
+\c identity_db;
+
+BEGIN;
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'sessions' AND column_name = 'refresh_token'
+    ) THEN
+        DELETE FROM sessions;
+        ALTER TABLE sessions DROP COLUMN refresh_token;
+    END IF;
+END $$;
+
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS refresh_token_hash VARCHAR(64) UNIQUE NOT NULL,
+    ADD COLUMN IF NOT EXISTS family_id UUID NOT NULL,
+    ADD COLUMN IF NOT EXISTS parent_id UUID,
+    ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP;
+
+DROP INDEX IF EXISTS idx_sessions_token;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_family_id ON sessions (family_id);
+
+COMMIT;
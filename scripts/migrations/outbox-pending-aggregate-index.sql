@@ -0,0 +1,12 @@
+-- Adds the index the outbox relays use to hold back the later events of an
+-- aggregate whose earlier event is backing off. Safe to run more than once:
+--
+--   psql -f scripts/migrations/outbox-pending-aggregate-index.sql
+
+\c identity_db;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending_aggregate ON outbox_events (aggregate_id, position) WHERE sent_at IS NULL;
+
+\c account_db;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending_aggregate ON outbox_events (aggregate_id, position) WHERE sent_at IS NULL;
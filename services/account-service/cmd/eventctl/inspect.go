@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/events"
+	"github.com/Caesarsage/bankflow/account-service/internal/kafka"
+)
+
+func runList(ctx context.Context, args []string) error {
+	var topic topicFlags
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	topic.register(fs)
+	fs.Parse(args)
+
+	msgs, err := topic.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "OFFSET\tTIME\tTYPE\tID\tSOURCE TOPIC\tATTEMPTS\tREASON")
+	for _, msg := range msgs {
+		eventType, eventID := "-", "-"
+		if event, err := kafka.Decode(msg); err == nil {
+			eventType, eventID = event.Type, event.ID
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			msg.Offset,
+			msg.Time.Format(time.RFC3339),
+			eventType,
+			eventID,
+			header(msg, kafka.HeaderDLQTopic),
+			header(msg, kafka.HeaderDLQAttempts),
+			header(msg, kafka.HeaderDLQReason),
+		)
+	}
+
+	return w.Flush()
+}
+
+func runShow(ctx context.Context, args []string) error {
+	var topic topicFlags
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	topic.register(fs)
+	offset := fs.Int64("offset", -1, "offset of the message to show (required)")
+	fs.Parse(args)
+
+	if *offset < 0 {
+		return fmt.Errorf("-offset is required")
+	}
+	topic.from, topic.to = *offset, *offset
+
+	msgs, err := topic.read(ctx)
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		return fmt.Errorf("no message at offset %d", *offset)
+	}
+	msg := msgs[0]
+
+	fmt.Printf("Offset:    %d\n", msg.Offset)
+	fmt.Printf("Partition: %d\n", msg.Partition)
+	fmt.Printf("Key:       %s\n", msg.Key)
+	fmt.Printf("Time:      %s\n", msg.Time.Format(time.RFC3339))
+	fmt.Println("Headers:")
+	for _, h := range msg.Headers {
+		fmt.Printf("  %s: %s\n", h.Key, h.Value)
+	}
+
+	event, err := kafka.Decode(msg)
+	if err != nil {
+		fmt.Printf("\nPayload could not be decoded: %v\n", err)
+		fmt.Printf("%s\n", msg.Value)
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Printf("Event ID:  %s\n", event.ID)
+	fmt.Printf("Type:      %s\n", event.Type)
+	fmt.Printf("Source:    %s\n", event.Source)
+	fmt.Printf("Subject:   %s\n", event.Subject)
+	if event.Sequence > 0 {
+		fmt.Printf("Sequence:  %d\n", event.Sequence)
+	}
+	fmt.Printf("Schema:    %s\n", schemaStatus(event))
+	fmt.Println("Data:")
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, event.Data, "  ", "  "); err != nil {
+		fmt.Printf("  %s\n", event.Data)
+		return nil
+	}
+	fmt.Printf("  %s\n", pretty.String())
+	return nil
+}
+
+func schemaStatus(event *events.Envelope) string {
+	if !events.HasSchema(event.Type) {
+		return "no schema registered"
+	}
+	if err := event.Validate(); err != nil {
+		return "invalid: " + err.Error()
+	}
+	return "valid (" + event.DataSchema + ")"
+}
@@ -0,0 +1,63 @@
+// Command eventctl inspects dead-letter topics and replays their messages.
+//
+//	eventctl list   -topic transaction-events.dlq [-from 0] [-to -1]
+//	eventctl show   -topic transaction-events.dlq -offset 42
+//	eventctl replay -topic transaction-events.dlq -from 40 -to 45 [-target topic|handler] [-dry-run]
+//	eventctl replay -topic transaction-events.dlq -id <event-id>[,<event-id>...]
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `Usage: eventctl <command> [flags]
+
+Commands:
+  list    List messages on a topic partition
+  show    Show a message with its decoded payload
+  replay  Replay messages to their source topic or into a handler
+
+Run "eventctl <command> -h" for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = runList(ctx, os.Args[2:])
+	case "show":
+		err = runShow(ctx, os.Args[2:])
+	case "replay":
+		err = runReplay(ctx, os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "eventctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
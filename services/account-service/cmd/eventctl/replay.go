@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/kafka"
+	"github.com/Caesarsage/bankflow/account-service/internal/repository"
+	"github.com/Caesarsage/bankflow/account-service/internal/service"
+	_ "github.com/lib/pq"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const (
+	targetTopic   = "topic"
+	targetHandler = "handler"
+)
+
+func runReplay(ctx context.Context, args []string) error {
+	var topic topicFlags
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	topic.register(fs)
+	ids := fs.String("id", "", "comma-separated event IDs to replay instead of the whole offset range")
+	target := fs.String("target", targetTopic, `where to replay: "topic" or "handler"`)
+	toTopic := fs.String("to-topic", "", "topic to replay into (default: the message's source topic)")
+	dryRun := fs.Bool("dry-run", false, "print what would be replayed without replaying")
+	fs.Parse(args)
+
+	if *target != targetTopic && *target != targetHandler {
+		return fmt.Errorf("-target must be %q or %q", targetTopic, targetHandler)
+	}
+
+	msgs, err := topic.read(ctx)
+	if err != nil {
+		return err
+	}
+	if *ids != "" {
+		msgs = filterByEventID(msgs, strings.Split(*ids, ","))
+	}
+	if len(msgs) == 0 {
+		fmt.Println("No messages selected")
+		return nil
+	}
+
+	if *target == targetHandler {
+		return replayToHandler(ctx, msgs, *dryRun)
+	}
+	return replayToTopic(ctx, topic.brokerList(), msgs, *toTopic, *dryRun)
+}
+
+func filterByEventID(msgs []kafkago.Message, ids []string) []kafkago.Message {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[strings.TrimSpace(id)] = true
+	}
+
+	selected := []kafkago.Message{}
+	for _, msg := range msgs {
+		if event, err := kafka.Decode(msg); err == nil && wanted[event.ID] {
+			selected = append(selected, msg)
+		}
+	}
+	return selected
+}
+
+// replayToTopic republishes messages marked as replays, keeping their source
+// headers so legacy messages keep their IDs
+func replayToTopic(ctx context.Context, brokers []string, msgs []kafkago.Message, toTopic string, dryRun bool) error {
+	writers := map[string]*kafkago.Writer{}
+	defer func() {
+		for _, w := range writers {
+			w.Close()
+		}
+	}()
+
+	for _, msg := range msgs {
+		dest := toTopic
+		if dest == "" {
+			dest = header(msg, kafka.HeaderDLQTopic)
+		}
+		if dest == "" {
+			return fmt.Errorf("offset %d has no source topic header; use -to-topic", msg.Offset)
+		}
+
+		if dryRun {
+			fmt.Printf("[dry-run] would replay offset %d (%s) to %s\n", msg.Offset, describe(msg), dest)
+			continue
+		}
+
+		w, ok := writers[dest]
+		if !ok {
+			w = &kafkago.Writer{
+				Addr:         kafkago.TCP(brokers...),
+				Topic:        dest,
+				Balancer:     &kafkago.Hash{},
+				RequiredAcks: kafkago.RequireAll,
+			}
+			writers[dest] = w
+		}
+
+		err := w.WriteMessages(ctx, kafkago.Message{
+			Key:     msg.Key,
+			Value:   msg.Value,
+			Headers: replayHeaders(msg),
+		})
+		if err != nil {
+			return fmt.Errorf("replay offset %d: %w", msg.Offset, err)
+		}
+		fmt.Printf("Replayed offset %d (%s) to %s\n", msg.Offset, describe(msg), dest)
+	}
+
+	return nil
+}
+
+// replayToHandler runs messages through the account-service handlers directly
+func replayToHandler(ctx context.Context, msgs []kafkago.Message, dryRun bool) error {
+	router := kafka.NewRouter()
+
+	if !dryRun {
+		db, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		svc := service.NewAccountService(repository.NewAccountRepository(db), repository.NewOutboxRepository(db))
+		svc.RegisterTransactionHandlers(router)
+	}
+
+	failed := 0
+	for _, msg := range msgs {
+		event, err := kafka.Decode(msg)
+		if err != nil {
+			fmt.Printf("Skipped offset %d: %v\n", msg.Offset, err)
+			failed++
+			continue
+		}
+
+		if dryRun {
+			fmt.Printf("[dry-run] would handle offset %d (%s)\n", msg.Offset, describe(msg))
+			continue
+		}
+
+		handled, err := router.Dispatch(ctx, event)
+		switch {
+		case err != nil:
+			fmt.Printf("Failed offset %d (%s): %v\n", msg.Offset, describe(msg), err)
+			failed++
+		case !handled:
+			fmt.Printf("Skipped offset %d (%s): no handler\n", msg.Offset, describe(msg))
+		default:
+			fmt.Printf("Handled offset %d (%s)\n", msg.Offset, describe(msg))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d message(s) failed", failed, len(msgs))
+	}
+	return nil
+}
+
+func openDB() (*sql.DB, error) {
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		getEnv("DB_HOST", "localhost"),
+		getEnv("DB_PORT", "5432"),
+		getEnv("DB_USER", "bankflow"),
+		getEnv("DB_PASSWORD", "bankflow123"),
+		getEnv("DB_NAME", "account_db"),
+	)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// replayHeaders returns the headers of a replayed message: its own without
+// the failure details, marked with where it is replayed from. The consumer
+// handles marked messages even if their sequence looks stale.
+func replayHeaders(msg kafkago.Message) []kafkago.Header {
+	kept := []kafkago.Header{}
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case kafka.HeaderDLQReason, kafka.HeaderDLQAttempts, kafka.HeaderReplayedFrom:
+			continue
+		}
+		kept = append(kept, h)
+	}
+
+	from := fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+	return append(kept, kafkago.Header{Key: kafka.HeaderReplayedFrom, Value: []byte(from)})
+}
+
+func describe(msg kafkago.Message) string {
+	event, err := kafka.Decode(msg)
+	if err != nil {
+		return "undecodable"
+	}
+	return event.Type + " " + event.ID
+}
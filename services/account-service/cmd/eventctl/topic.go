@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// topicFlags selects a range of messages on one topic partition
+type topicFlags struct {
+	brokers   string
+	topic     string
+	partition int
+	from      int64
+	to        int64
+}
+
+func (f *topicFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.brokers, "brokers", getEnv("KAFKA_BROKERS", "localhost:9092"), "comma-separated Kafka brokers")
+	fs.StringVar(&f.topic, "topic", "", "topic to read, usually a dead-letter topic (required)")
+	fs.IntVar(&f.partition, "partition", 0, "partition to read")
+	fs.Int64Var(&f.from, "from", 0, "first offset to read")
+	fs.Int64Var(&f.to, "to", -1, "last offset to read, -1 for the end of the partition")
+}
+
+func (f *topicFlags) brokerList() []string {
+	return strings.Split(f.brokers, ",")
+}
+
+// read returns the messages between the from and to offsets inclusive,
+// clamped to the offsets currently held by the partition
+func (f *topicFlags) read(ctx context.Context) ([]kafka.Message, error) {
+	if f.topic == "" {
+		return nil, fmt.Errorf("-topic is required")
+	}
+
+	conn, err := kafka.DialLeader(ctx, "tcp", f.brokerList()[0], f.topic, f.partition)
+	if err != nil {
+		return nil, err
+	}
+	first, last, err := conn.ReadOffsets()
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := f.from, f.to
+	if from < first {
+		from = first
+	}
+	if to < 0 || to >= last {
+		to = last - 1
+	}
+	if from > to {
+		return nil, nil
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   f.brokerList(),
+		Topic:     f.topic,
+		Partition: f.partition,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+
+	if err := reader.SetOffset(from); err != nil {
+		return nil, err
+	}
+
+	msgs := []kafka.Message{}
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+		if msg.Offset >= to {
+			return msgs, nil
+		}
+	}
+}
+
+func header(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
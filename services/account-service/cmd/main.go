@@ -1,19 +1,27 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/Caesarsage/bankflow/account-service/internal/access"
+	"github.com/Caesarsage/bankflow/account-service/internal/customer"
+	grpcserver "github.com/Caesarsage/bankflow/account-service/internal/grpc"
 	"github.com/Caesarsage/bankflow/account-service/internal/handlers"
 	"github.com/Caesarsage/bankflow/account-service/internal/kafka"
+	"github.com/Caesarsage/bankflow/account-service/internal/outbox"
 	"github.com/Caesarsage/bankflow/account-service/internal/repository"
 	"github.com/Caesarsage/bankflow/account-service/internal/service"
+	"github.com/Caesarsage/bankflow/account-service/pkg/auth"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
@@ -26,9 +34,52 @@ func main() {
 	dbPassword := getEnv("DB_PASSWORD", "bankflow123")
 	dbName := getEnv("DB_NAME", "account_db")
 	port := getEnv("PORT", "8002")
+	grpcPort := getEnv("GRPC_PORT", "50051")
+
+	// gRPC TLS: cert and key enable TLS, a CA enables mutual TLS
+	grpcTLSCert := getEnv("GRPC_TLS_CERT", "")
+	grpcTLSKey := getEnv("GRPC_TLS_KEY", "")
+	grpcTLSCA := getEnv("GRPC_TLS_CA", "")
+	grpcClientAuth := getEnv("GRPC_TLS_CLIENT_AUTH", "require")
+	grpcPolicy := getEnv("GRPC_AUTHZ_POLICY", "")
 
 	kafkaBrokers := getEnv("KAFKA_BROKERS", "localhost:9092")
 	kafkaTopic := getEnv("KAFKA_TOPIC", "account-events")
+	transactionTopic := getEnv("KAFKA_TRANSACTION_TOPIC", "transaction-events")
+	consumerGroup := getEnv("KAFKA_CONSUMER_GROUP", "account-service")
+
+	// Access tokens are validated against identity-service's public keys
+	jwksURL := getEnv("IDENTITY_JWKS_URL", "http://localhost:8001/.well-known/jwks.json")
+	jwksRefresh := getEnv("IDENTITY_JWKS_REFRESH", "10m")
+
+	// Tokens revoked at identity-service are read from the Redis it keeps
+	// revocations in (REVOCATION_STORE=redis there); without REDIS_HOST
+	// revoked tokens are accepted until they expire
+	redisHost := getEnv("REDIS_HOST", "")
+	redisPort := getEnv("REDIS_PORT", "6379")
+	redisPassword := getEnv("REDIS_PASSWORD", "")
+	revocationCacheTTL := getEnv("REVOCATION_CACHE_TTL", "5s")
+
+	// Sensitive routes need a login or step-up at identity-service this recent
+	stepUpMaxAge := getEnv("STEP_UP_MAX_AGE", "5m")
+
+	// Customer lookups for account ownership checks
+	customerServiceURL := getEnv("CUSTOMER_SERVICE_URL", "http://localhost:8002")
+
+	jwksTTL, err := time.ParseDuration(jwksRefresh)
+	if err != nil {
+		log.Fatalf("Invalid IDENTITY_JWKS_REFRESH: %v", err)
+	}
+
+	stepUpAge, err := time.ParseDuration(stepUpMaxAge)
+	if err != nil {
+		log.Fatalf("Invalid STEP_UP_MAX_AGE: %v", err)
+	}
+
+	revocationTTL, err := time.ParseDuration(revocationCacheTTL)
+	if err != nil {
+		log.Fatalf("Invalid REVOCATION_CACHE_TTL: %v", err)
+	}
 
 	// Initialize database
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", dbHost, dbPort, dbUser, dbPassword, dbName)
@@ -52,8 +103,78 @@ func main() {
 
 	// Initialize repository, service, and handler
 	repo := repository.NewAccountRepository(db)
-	svc := service.NewAccountService(repo, producer)
-	handler := handlers.NewAccountHandler(svc)
+	outboxRepo := repository.NewOutboxRepository(db)
+	svc := service.NewAccountService(repo, outboxRepo)
+	checker := access.NewChecker(svc, customer.NewClient(customerServiceURL))
+	validator := auth.NewValidator(jwksURL, jwksTTL)
+
+	var revocations *auth.RevocationChecker
+	if redisHost != "" {
+		redisClient := redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%s", redisHost, redisPort),
+			Password: redisPassword,
+		})
+		defer redisClient.Close()
+
+		if err := redisClient.Ping(context.Background()).Err(); err != nil {
+			log.Fatalf("Failed to ping Redis: %v", err)
+		}
+		revocations = auth.NewRevocationChecker(redisClient, revocationTTL)
+		log.Println("Checking access tokens against revocations in Redis")
+	} else {
+		log.Println("REDIS_HOST not set, revoked access tokens are accepted until they expire")
+	}
+	handler := handlers.NewAccountHandler(svc, checker)
+
+	// Relay outbox events to Kafka
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relay := outbox.NewRelay(outboxRepo, producer, time.Second, 100)
+	go relay.Run(ctx)
+	log.Println("Outbox relay started")
+
+	// Consume transaction events
+	consumer := kafka.NewConsumer(brokers, transactionTopic, consumerGroup, transactionTopic+".dlq")
+	defer consumer.Close()
+	consumer.TrackSequences(kafka.NewSequenceTracker(kafka.DefaultMaxSubjects))
+	svc.RegisterTransactionHandlers(consumer.Router)
+
+	go func() {
+		if err := consumer.Run(ctx); err != nil {
+			log.Fatalf("Transaction event consumer stopped: %v", err)
+		}
+	}()
+	log.Printf("Consuming %s as group %s", transactionTopic, consumerGroup)
+
+	// Start gRPC server
+	grpcConfig := grpcserver.ServerConfig{Port: grpcPort, Revocations: revocations}
+	if grpcTLSCert != "" || grpcTLSKey != "" {
+		if grpcClientAuth != "require" && grpcClientAuth != "optional" {
+			log.Fatalf("Invalid GRPC_TLS_CLIENT_AUTH: %q", grpcClientAuth)
+		}
+		grpcConfig.TLS = &grpcserver.TLSConfig{
+			CertFile:          grpcTLSCert,
+			KeyFile:           grpcTLSKey,
+			CAFile:            grpcTLSCA,
+			RequireClientCert: grpcClientAuth == "require",
+		}
+	} else {
+		log.Println("GRPC_TLS_CERT not set, serving gRPC without TLS")
+	}
+
+	if grpcPolicy != "" {
+		grpcConfig.Policy, err = grpcserver.LoadPolicy(grpcPolicy)
+		if err != nil {
+			log.Fatalf("Invalid GRPC_AUTHZ_POLICY: %v", err)
+		}
+	}
+
+	go func() {
+		if err := grpcserver.StartGRPCServer(svc, checker, validator, grpcConfig); err != nil {
+			log.Fatalf("gRPC server stopped: %v", err)
+		}
+	}()
 
 	// Setup Gin router
 	router := gin.Default()
@@ -68,7 +189,7 @@ func main() {
 
 	// API routes
 	v1 := router.Group("/api/v1")
-	handler.RegisterRoutes(v1)
+	handler.RegisterRoutes(v1, validator, revocations, stepUpAge)
 
 	// Start server
 	log.Printf("Account service starting on port %s", port)
@@ -0,0 +1,178 @@
+// Command rebuild-projections recomputes account balances from the balance
+// journal into the account_balances_shadow table, diffs them against the
+// live accounts table, and reports or repairs the differences.
+//
+//	rebuild-projections [-repair] [-account <id>[,<id>...]]
+//
+// Balances that predate the journal have no entries to replay and will show
+// up as discrepancies until scripts/migrations/account-journal-opening-balances.sql
+// has seeded them. Repairs lock each account and replay its journal again,
+// and skip any account whose balance changed after the rebuild read it.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/models"
+	"github.com/Caesarsage/bankflow/account-service/internal/projection"
+	"github.com/Caesarsage/bankflow/account-service/internal/repository"
+	"github.com/Caesarsage/bankflow/account-service/internal/service"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	repair := flag.Bool("repair", false, "reset live balances to the rebuilt balances")
+	accounts := flag.String("account", "", "comma-separated account IDs to repair (default all discrepancies)")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, *repair, *accounts); err != nil {
+		fmt.Fprintf(os.Stderr, "rebuild-projections: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, repair bool, accounts string) error {
+	only, err := parseIDs(accounts)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+	defer db.Close()
+
+	report, err := projection.NewRebuilder(repository.NewJournalRepository(db)).Rebuild(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Replayed %d journal entries across %d accounts\n", report.Entries, report.Accounts)
+
+	if len(report.ChainBreaks) > 0 {
+		fmt.Printf("\n%d journal chain breaks:\n", len(report.ChainBreaks))
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ACCOUNT\tPOSITION\tEXPECTED\tRECORDED")
+		for _, b := range report.ChainBreaks {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", b.AccountID, b.Position, b.Expected.StringFixed(2), b.Recorded.StringFixed(2))
+		}
+		w.Flush()
+	}
+
+	discrepancies := filter(report.Discrepancies, only)
+	if len(discrepancies) == 0 {
+		fmt.Println("\nNo balance discrepancies")
+		return nil
+	}
+
+	fmt.Printf("\n%d balance discrepancies:\n", len(discrepancies))
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tLIVE BALANCE\tREBUILT BALANCE\tLIVE AVAILABLE\tREBUILT AVAILABLE")
+	for _, d := range discrepancies {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			d.AccountID,
+			d.LiveBalance.StringFixed(2),
+			d.RebuiltBalance.StringFixed(2),
+			d.LiveAvailable.StringFixed(2),
+			d.RebuiltAvailable.StringFixed(2),
+		)
+	}
+	w.Flush()
+
+	if !repair {
+		fmt.Println("\nRun with -repair to reset live balances")
+		return nil
+	}
+
+	svc := service.NewAccountService(repository.NewAccountRepository(db), repository.NewOutboxRepository(db))
+
+	repaired, skipped := 0, 0
+	for _, d := range discrepancies {
+		ok, err := svc.RepairBalance(ctx, d.AccountID, d.LiveBalance, d.LiveAvailable)
+		if errors.Is(err, repository.ErrBalanceChanged) {
+			fmt.Printf("Skipped %s: balance changed since the rebuild, run again\n", d.AccountID)
+			skipped++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("repair %s: %w", d.AccountID, err)
+		}
+		if ok {
+			repaired++
+		}
+	}
+
+	fmt.Printf("\nRepaired %d accounts, skipped %d\n", repaired, skipped)
+	return nil
+}
+
+func parseIDs(value string) (map[uuid.UUID]bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	ids := map[uuid.UUID]bool{}
+	for _, part := range strings.Split(value, ",") {
+		id, err := uuid.Parse(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid account ID %q", part)
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+func filter(discrepancies []*models.BalanceDiscrepancy, only map[uuid.UUID]bool) []*models.BalanceDiscrepancy {
+	if only == nil {
+		return discrepancies
+	}
+
+	kept := []*models.BalanceDiscrepancy{}
+	for _, d := range discrepancies {
+		if only[d.AccountID] {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+func openDB() (*sql.DB, error) {
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		getEnv("DB_HOST", "localhost"),
+		getEnv("DB_PORT", "5432"),
+		getEnv("DB_USER", "bankflow"),
+		getEnv("DB_PASSWORD", "bankflow123"),
+		getEnv("DB_NAME", "account_db"),
+	)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,111 @@
+package access
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/customer"
+	"github.com/Caesarsage/bankflow/account-service/internal/service"
+	"github.com/Caesarsage/bankflow/account-service/pkg/auth"
+	"github.com/google/uuid"
+)
+
+var ErrForbidden = errors.New("access to account denied")
+
+// Permissions granted by identity-service roles
+const (
+	// PermissionAccountsRead lets staff view any customer's accounts
+	PermissionAccountsRead = "accounts:read"
+	// PermissionAccountsUpdate lets staff open accounts for any customer and
+	// change account status and interest rates
+	PermissionAccountsUpdate = "accounts:update"
+	PermissionAccountsFreeze = "accounts:freeze"
+	PermissionAccountsClose  = "accounts:close"
+	// PermissionAccountsTransact lets callers move money and place holds
+	PermissionAccountsTransact = "accounts:transact"
+	// PermissionAccountsOwn is held by customers so their API keys and OAuth
+	// clients can be granted it as a scope to reach their accounts
+	PermissionAccountsOwn = "accounts:own"
+)
+
+// accountsScopePrefix starts the scopes that let a client reach the accounts
+// of the user it acts for, such as accounts:own
+const accountsScopePrefix = "accounts:"
+
+// Checker decides whether the caller of a request may access an account.
+// Customers may only access their own accounts; staff with accounts:read
+// may access any. Clients acting for a customer, such as API keys and OAuth
+// clients, reach the customer's accounts only if granted an accounts:*
+// scope.
+type Checker struct {
+	accounts  *service.AccountService
+	customers *customer.Client
+}
+
+func NewChecker(accounts *service.AccountService, customers *customer.Client) *Checker {
+	return &Checker{
+		accounts:  accounts,
+		customers: customers,
+	}
+}
+
+// CanAccessAccount returns nil if the caller may access the account,
+// ErrForbidden if not, or the error looking the account up
+func (c *Checker) CanAccessAccount(ctx context.Context, claims *auth.Claims, accountID uuid.UUID) error {
+	if claims.HasPermission(PermissionAccountsRead) {
+		return nil
+	}
+
+	customerID, err := c.callerCustomerID(ctx, claims)
+	if err != nil {
+		return err
+	}
+
+	owns, err := c.accounts.ValidateAccountOwnership(ctx, accountID, customerID)
+	if err != nil {
+		return err
+	}
+	if !owns {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// CanAccessCustomer returns nil if the caller may access the accounts of a
+// customer, or ErrForbidden if not
+func (c *Checker) CanAccessCustomer(ctx context.Context, claims *auth.Claims, customerID uuid.UUID) error {
+	if claims.HasPermission(PermissionAccountsRead) {
+		return nil
+	}
+
+	callerID, err := c.callerCustomerID(ctx, claims)
+	if err != nil {
+		return err
+	}
+	if callerID != customerID {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// callerCustomerID returns the customer ID of the token's user. A user
+// without a customer record owns no accounts, and a client without an
+// accounts:* scope may not act as the user's owner.
+func (c *Checker) callerCustomerID(ctx context.Context, claims *auth.Claims) (uuid.UUID, error) {
+	if claims.Delegated() && !claims.HasScopePrefix(accountsScopePrefix) {
+		return uuid.Nil, ErrForbidden
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return uuid.Nil, ErrForbidden
+	}
+
+	customerID, err := c.customers.CustomerIDForUser(ctx, userID)
+	if err == customer.ErrCustomerNotFound {
+		return uuid.Nil, ErrForbidden
+	}
+	return customerID, err
+}
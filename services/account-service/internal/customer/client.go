@@ -0,0 +1,84 @@
+package customer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrCustomerNotFound = errors.New("customer not found")
+
+// maxCachedCustomers bounds the cache; it is cleared when it grows past this
+const maxCachedCustomers = 100000
+
+// Client looks up customers in customer-service. A user's customer ID never
+// changes, so lookups are cached without expiry.
+type Client struct {
+	baseURL string
+	client  *http.Client
+
+	mu        sync.RWMutex
+	customers map[uuid.UUID]uuid.UUID
+}
+
+// NewClient creates a client for the customer-service at baseURL, e.g.
+// http://customer-service:8002
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:   baseURL,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		customers: map[uuid.UUID]uuid.UUID{},
+	}
+}
+
+// CustomerIDForUser returns the ID of the customer record of an identity
+// user, or ErrCustomerNotFound if the user has none yet
+func (c *Client) CustomerIDForUser(ctx context.Context, userID uuid.UUID) (uuid.UUID, error) {
+	c.mu.RLock()
+	customerID, ok := c.customers[userID]
+	c.mu.RUnlock()
+	if ok {
+		return customerID, nil
+	}
+
+	url := fmt.Sprintf("%s/api/v1/customers/user/%s", c.baseURL, userID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return uuid.Nil, ErrCustomerNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return uuid.Nil, fmt.Errorf("fetch %s: %s", url, resp.Status)
+	}
+
+	var customer struct {
+		ID uuid.UUID `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&customer); err != nil {
+		return uuid.Nil, fmt.Errorf("decode %s: %w", url, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.customers) >= maxCachedCustomers {
+		c.customers = map[uuid.UUID]uuid.UUID{}
+	}
+	c.customers[userID] = customer.ID
+
+	return customer.ID, nil
+}
@@ -0,0 +1,48 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Account event types
+const (
+	TypeAccountCreated        = "com.bankflow.account.created.v1"
+	TypeAccountBalanceUpdated = "com.bankflow.account.balance.updated.v1"
+	TypeAccountFrozen         = "com.bankflow.account.frozen.v1"
+	TypeAccountClosed         = "com.bankflow.account.closed.v1"
+)
+
+// AccountCreated is the payload of account.created
+type AccountCreated struct {
+	AccountID     uuid.UUID `json:"account_id"`
+	CustomerID    uuid.UUID `json:"customer_id"`
+	AccountNumber string    `json:"account_number"`
+	AccountType   string    `json:"account_type"`
+	Currency      string    `json:"currency"`
+}
+
+// AccountBalanceUpdated is the payload of account.balance.updated
+type AccountBalanceUpdated struct {
+	AccountID        uuid.UUID       `json:"account_id"`
+	Balance          decimal.Decimal `json:"balance"`
+	AvailableBalance decimal.Decimal `json:"available_balance"`
+}
+
+// AccountFrozen is the payload of account.frozen
+type AccountFrozen struct {
+	AccountID uuid.UUID `json:"account_id"`
+	FrozenAt  time.Time `json:"frozen_at"`
+}
+
+// AccountClosed is the payload of account.closed
+type AccountClosed struct {
+	AccountID           uuid.UUID       `json:"account_id"`
+	SettlementAccountID *uuid.UUID      `json:"settlement_account_id,omitempty"`
+	InterestPosted      decimal.Decimal `json:"interest_posted"`
+	AmountSwept         decimal.Decimal `json:"amount_swept"`
+	Currency            string          `json:"currency"`
+	ClosedAt            time.Time       `json:"closed_at"`
+}
@@ -0,0 +1,36 @@
+package events
+
+import (
+	contract "github.com/Caesarsage/bankflow/proto/events"
+)
+
+// The envelope and schemas are shared with the other Go services; see
+// proto/events
+const (
+	// SpecVersion is the CloudEvents specification version
+	SpecVersion = contract.SpecVersion
+
+	// Source identifies this service as the producer of its events
+	Source = "account-service"
+)
+
+var ErrInvalidEnvelope = contract.ErrInvalidEnvelope
+
+// Envelope is a CloudEvents 1.0 envelope around a JSON payload
+type Envelope = contract.Envelope
+
+// New wraps data in an envelope from this service after checking it against
+// the schema registered for eventType
+func New(eventType, subject string, data interface{}) (*Envelope, error) {
+	return contract.New(Source, eventType, subject, data)
+}
+
+// HasSchema reports whether eventType has a registered schema
+func HasSchema(eventType string) bool {
+	return contract.HasSchema(eventType)
+}
+
+// Types returns the event types with a registered schema
+func Types() []string {
+	return contract.Types()
+}
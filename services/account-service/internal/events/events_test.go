@@ -0,0 +1,118 @@
+package events_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/events"
+	"github.com/Caesarsage/bankflow/account-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// TestPayloadsMatchSchemas checks every payload account-service produces
+// against its contract in proto/events/account
+func TestPayloadsMatchSchemas(t *testing.T) {
+	settlementID := uuid.New()
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		eventType string
+		data      interface{}
+	}{
+		{"created current", events.TypeAccountCreated, events.AccountCreated{
+			AccountID:     uuid.New(),
+			CustomerID:    uuid.New(),
+			AccountNumber: "1234567890",
+			AccountType:   string(models.AccountTypeChecking),
+			Currency:      "USD",
+		}},
+		{"created savings", events.TypeAccountCreated, events.AccountCreated{
+			AccountID:     uuid.New(),
+			CustomerID:    uuid.New(),
+			AccountNumber: "1234567890",
+			AccountType:   string(models.AccountTypeSavings),
+			Currency:      "EUR",
+		}},
+		{"balance updated", events.TypeAccountBalanceUpdated, events.AccountBalanceUpdated{
+			AccountID:        uuid.New(),
+			Balance:          decimal.RequireFromString("1050.25"),
+			AvailableBalance: decimal.RequireFromString("-20.5"),
+		}},
+		{"frozen", events.TypeAccountFrozen, events.AccountFrozen{
+			AccountID: uuid.New(),
+			FrozenAt:  now,
+		}},
+		{"closed with settlement", events.TypeAccountClosed, events.AccountClosed{
+			AccountID:           uuid.New(),
+			SettlementAccountID: &settlementID,
+			InterestPosted:      decimal.RequireFromString("1.37"),
+			AmountSwept:         decimal.RequireFromString("250.00"),
+			Currency:            "USD",
+			ClosedAt:            now,
+		}},
+		{"closed empty", events.TypeAccountClosed, events.AccountClosed{
+			AccountID:      uuid.New(),
+			InterestPosted: decimal.Zero,
+			AmountSwept:    decimal.Zero,
+			Currency:       "USD",
+			ClosedAt:       now,
+		}},
+	}
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := events.New(tt.eventType, uuid.NewString(), tt.data)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if err := event.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if event.Source != events.Source {
+				t.Errorf("source = %q, want %q", event.Source, events.Source)
+			}
+		})
+		covered[tt.eventType] = true
+	}
+
+	for _, eventType := range events.Types() {
+		if strings.HasPrefix(eventType, "com.bankflow.account.") && !covered[eventType] {
+			t.Errorf("no payload tested for %s", eventType)
+		}
+	}
+}
+
+func TestNewRejectsPayloadsOffContract(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		data      interface{}
+	}{
+		{"unknown type", "com.bankflow.account.renamed.v1", events.AccountFrozen{AccountID: uuid.New()}},
+		{"wrong payload", events.TypeAccountFrozen, events.AccountBalanceUpdated{AccountID: uuid.New()}},
+		{"bad enum", events.TypeAccountCreated, events.AccountCreated{
+			AccountID:     uuid.New(),
+			CustomerID:    uuid.New(),
+			AccountNumber: "1234567890",
+			AccountType:   "CHECKING",
+			Currency:      "USD",
+		}},
+		{"bad currency", events.TypeAccountClosed, events.AccountClosed{
+			AccountID: uuid.New(),
+			Currency:  "usd",
+			ClosedAt:  time.Now(),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := events.New(tt.eventType, uuid.NewString(), tt.data); err == nil {
+				t.Fatal("New accepted a payload that breaks the contract")
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package events
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Transaction event types. transaction-service publishes plain JSON messages
+// whose "event_type" field carries these names.
+const (
+	TypeTransactionInitiated = "transaction.initiated"
+	TypeTransactionCompleted = "transaction.completed"
+	TypeTransactionFailed    = "transaction.failed"
+	TypeTransactionReversed  = "transaction.reversed"
+)
+
+// TransactionEvent is the payload of the transaction-events topic
+type TransactionEvent struct {
+	TransactionID  string          `json:"transaction_id"`
+	TransactionRef string          `json:"transaction_ref"`
+	FromAccountID  *uuid.UUID      `json:"from_account_id,omitempty"`
+	ToAccountID    *uuid.UUID      `json:"to_account_id,omitempty"`
+	Amount         decimal.Decimal `json:"amount"`
+	Currency       string          `json:"currency,omitempty"`
+	Timestamp      int64           `json:"timestamp"`
+}
@@ -0,0 +1,148 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/access"
+	"github.com/Caesarsage/bankflow/account-service/internal/repository"
+	"github.com/Caesarsage/bankflow/account-service/pkg/auth"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type callerKey struct{}
+
+// caller is the authenticated caller of an RPC: a service identified by its
+// client certificate, or a user or client with an access token
+type caller struct {
+	service string
+	claims  *auth.Claims
+}
+
+// authenticator authenticates callers by client certificate, under the
+// policy, or by the bearer token in the authorization metadata, rejecting
+// revoked tokens when revocations is set
+type authenticator struct {
+	validator   *auth.Validator
+	revocations *auth.RevocationChecker
+	policy      *Policy
+}
+
+// authenticate returns a context carrying the caller of fullMethod
+func (a *authenticator) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if identity := peerIdentity(ctx); a.policy.knows(identity) {
+		if !a.policy.allows(identity, fullMethod) {
+			return nil, status.Errorf(codes.PermissionDenied, "%s may not call %s", identity, rpcName(fullMethod))
+		}
+		return context.WithValue(ctx, callerKey{}, &caller{service: identity}), nil
+	}
+
+	if a.policy.serviceOnly(fullMethod) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is restricted to service callers", rpcName(fullMethod))
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "authorization bearer token required")
+	}
+
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || token == "" {
+		return nil, status.Error(codes.Unauthenticated, "authorization must be Bearer {token}")
+	}
+
+	claims, err := a.validator.ValidateAccessToken(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	if a.revocations != nil {
+		if err := a.revocations.CheckAccessToken(ctx, claims); err == auth.ErrTokenRevoked {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		} else if err != nil {
+			// Fail closed, a revoked token must not slip through
+			return nil, status.Error(codes.Unavailable, "unable to verify token, try again later")
+		}
+	}
+
+	return context.WithValue(ctx, callerKey{}, &caller{claims: claims}), nil
+}
+
+// unary rejects unauthenticated calls
+func (a *authenticator) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authServerStream carries the authenticated context into stream handlers
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// stream rejects unauthenticated streams
+func (a *authenticator) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// callerFrom returns the caller stored by the authenticator
+func callerFrom(ctx context.Context) (*caller, error) {
+	c, ok := ctx.Value(callerKey{}).(*caller)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "not authenticated")
+	}
+	return c, nil
+}
+
+// authorizeAccount checks that the caller may read an account. Services
+// allowed by the policy may read any account; tokens delegated to a client
+// need an accounts:* scope, as over HTTP.
+func (s *AccountGRPCServer) authorizeAccount(ctx context.Context, accountID uuid.UUID) error {
+	c, err := callerFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if c.service != "" {
+		return nil
+	}
+
+	switch err := s.access.CanAccessAccount(ctx, c.claims, accountID); err {
+	case nil:
+		return nil
+	case access.ErrForbidden:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case repository.ErrAccountNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// requirePermission checks that the caller's token grants a permission.
+// Services were already authorized by the policy.
+func requirePermission(ctx context.Context, permission string) error {
+	c, err := callerFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if c.service == "" && !c.claims.HasPermission(permission) {
+		return status.Error(codes.PermissionDenied, "missing permission "+permission)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Policy maps client certificate identities to the RPCs they may call.
+// Callers authenticated by certificate act as trusted services: they skip
+// the ownership and permission checks applied to access tokens.
+//
+//	{
+//	  "identities": {"transaction-service": ["GetBalance", "UpdateBalance"]},
+//	  "service_only": ["UpdateBalance"]
+//	}
+type Policy struct {
+	// Identities maps a certificate identity to RPC names, or "*" for all
+	Identities map[string][]string `json:"identities"`
+	// ServiceOnly lists RPCs that cannot be called with an access token
+	ServiceOnly []string `json:"service_only"`
+}
+
+// LoadPolicy reads a JSON policy file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	return &policy, nil
+}
+
+// rpcName returns the method name of a full gRPC method, e.g.
+// /account.AccountService/UpdateBalance is UpdateBalance
+func rpcName(fullMethod string) string {
+	return fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+}
+
+// knows reports whether the policy names an identity
+func (p *Policy) knows(identity string) bool {
+	if p == nil {
+		return false
+	}
+	_, ok := p.Identities[identity]
+	return ok
+}
+
+// allows reports whether an identity may call a method
+func (p *Policy) allows(identity, fullMethod string) bool {
+	if p == nil {
+		return false
+	}
+	name := rpcName(fullMethod)
+	for _, allowed := range p.Identities[identity] {
+		if allowed == "*" || allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceOnly reports whether a method is restricted to certificate callers
+func (p *Policy) serviceOnly(fullMethod string) bool {
+	if p == nil {
+		return false
+	}
+	name := rpcName(fullMethod)
+	for _, restricted := range p.ServiceOnly {
+		if restricted == name {
+			return true
+		}
+	}
+	return false
+}
+
+// peerIdentity returns the identity of the caller's verified client
+// certificate: its first URI SAN (e.g. a SPIFFE ID), or else its common
+// name. It is empty if the caller presented no certificate.
+func peerIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	cert := tlsInfo.State.VerifiedChains[0][0]
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.CommonName
+}
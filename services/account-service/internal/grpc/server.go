@@ -7,23 +7,28 @@ import (
 	"net"
 	"time"
 
+	"github.com/Caesarsage/bankflow/account-service/internal/access"
 	"github.com/Caesarsage/bankflow/account-service/internal/service"
+	"github.com/Caesarsage/bankflow/account-service/pkg/auth"
 	pb "github.com/Caesarsage/bankflow/account-service/proto/account"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/status"
 )
 
 type AccountGRPCServer struct {
 	pb.UnimplementedAccountServiceServer
 	accountService *service.AccountService
+	access         *access.Checker
 }
 
-func NewAccountGRPCServer(svc *service.AccountService) *AccountGRPCServer {
+func NewAccountGRPCServer(svc *service.AccountService, access *access.Checker) *AccountGRPCServer {
 	return &AccountGRPCServer{
 		accountService: svc,
+		access:         access,
 	}
 }
 
@@ -39,6 +44,10 @@ func (s *AccountGRPCServer) GetAccount(ctx context.Context, req *pb.GetAccountRe
 		}, nil
 	}
 
+	if err := s.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
 	account, err := s.accountService.GetAccountByID(ctx, accountID)
 	if err != nil {
 		return &pb.GetAccountResponse{
@@ -79,6 +88,10 @@ func (s *AccountGRPCServer) GetBalance(ctx context.Context, req *pb.GetBalanceRe
 		}, nil
 	}
 
+	if err := s.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
 	balance, availableBalance, err := s.accountService.GetBalance(ctx, accountID)
 	if err != nil {
 		return &pb.GetBalanceResponse{
@@ -97,6 +110,10 @@ func (s *AccountGRPCServer) GetBalance(ctx context.Context, req *pb.GetBalanceRe
 
 // UpdateBalance implements the UpdateBalance RPC
 func (s *AccountGRPCServer) UpdateBalance(ctx context.Context, req *pb.UpdateBalanceRequest) (*pb.UpdateBalanceResponse, error) {
+	if err := requirePermission(ctx, access.PermissionAccountsTransact); err != nil {
+		return nil, err
+	}
+
 	accountID, err := uuid.Parse(req.AccountId)
 	if err != nil {
 		return &pb.UpdateBalanceResponse{
@@ -131,6 +148,10 @@ func (s *AccountGRPCServer) UpdateBalance(ctx context.Context, req *pb.UpdateBal
 
 // CreateHold implements the CreateHold RPC
 func (s *AccountGRPCServer) CreateHold(ctx context.Context, req *pb.CreateHoldRequest) (*pb.CreateHoldResponse, error) {
+	if err := requirePermission(ctx, access.PermissionAccountsTransact); err != nil {
+		return nil, err
+	}
+
 	accountID, err := uuid.Parse(req.AccountId)
 	if err != nil {
 		return &pb.CreateHoldResponse{
@@ -167,6 +188,10 @@ func (s *AccountGRPCServer) CreateHold(ctx context.Context, req *pb.CreateHoldRe
 
 // ReleaseHold implements the ReleaseHold RPC
 func (s *AccountGRPCServer) ReleaseHold(ctx context.Context, req *pb.ReleaseHoldRequest) (*pb.ReleaseHoldResponse, error) {
+	if err := requirePermission(ctx, access.PermissionAccountsTransact); err != nil {
+		return nil, err
+	}
+
 	holdID, err := uuid.Parse(req.HoldId)
 	if err != nil {
 		return &pb.ReleaseHoldResponse{
@@ -203,6 +228,10 @@ func (s *AccountGRPCServer) StreamBalanceUpdates(req *pb.StreamBalanceRequest, s
 		return status.Error(codes.InvalidArgument, "Invalid account ID")
 	}
 
+	if err := s.authorizeAccount(stream.Context(), accountID); err != nil {
+		return err
+	}
+
 	// Subscribe to balance updates (this would be a real subscription)
 	// For demonstration, sending periodic updates
 	ticker := time.NewTicker(5 * time.Second)
@@ -232,21 +261,46 @@ func (s *AccountGRPCServer) StreamBalanceUpdates(req *pb.StreamBalanceRequest, s
 	}
 }
 
-// StartGRPCServer starts the gRPC server
-func StartGRPCServer(accountService *service.AccountService, port string) error {
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+// ServerConfig configures the gRPC server
+type ServerConfig struct {
+	Port string
+	// TLS enables TLS, and mutual TLS if it has a CA; nil serves plaintext
+	TLS *TLSConfig
+	// Policy authorizes callers by client certificate; nil accepts only
+	// access tokens
+	Policy *Policy
+	// Revocations rejects revoked access tokens; nil skips the check
+	Revocations *auth.RevocationChecker
+}
+
+// StartGRPCServer starts the gRPC server. Callers authenticate with a client
+// certificate allowed by the policy, or an identity-service access token in
+// the authorization metadata.
+func StartGRPCServer(accountService *service.AccountService, checker *access.Checker, validator *auth.Validator, cfg ServerConfig) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.Port))
 	if err != nil {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(unaryLoggingInterceptor),
-		grpc.StreamInterceptor(streamLoggingInterceptor),
-	)
+	authn := &authenticator{validator: validator, revocations: cfg.Revocations, policy: cfg.Policy}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryLoggingInterceptor, authn.unary),
+		grpc.ChainStreamInterceptor(streamLoggingInterceptor, authn.stream),
+	}
+
+	if cfg.TLS != nil {
+		reloader, err := newCertReloader(*cfg.TLS)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificates: %v", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.tlsConfig())))
+	}
+
+	grpcServer := grpc.NewServer(opts...)
 
-	pb.RegisterAccountServiceServer(grpcServer, NewAccountGRPCServer(accountService))
+	pb.RegisterAccountServiceServer(grpcServer, NewAccountGRPCServer(accountService, checker))
 
-	log.Printf("gRPC server listening on port %s", port)
+	log.Printf("gRPC server listening on port %s (tls: %t, mtls: %t)", cfg.Port, cfg.TLS != nil, cfg.TLS != nil && cfg.TLS.CAFile != "")
 	return grpcServer.Serve(lis)
 }
 
@@ -0,0 +1,147 @@
+package grpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadCheckInterval is how often certificate files are checked for
+// changes, at most once per handshake
+const reloadCheckInterval = 10 * time.Second
+
+// TLSConfig configures TLS for the gRPC server. With CAFile set, client
+// certificates signed by that CA are verified (mutual TLS).
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	// RequireClientCert rejects clients without a certificate. Otherwise a
+	// certificate is verified if presented, and callers without one must
+	// send an access token.
+	RequireClientCert bool
+}
+
+// certReloader serves the server certificate and client CA pool, reloading
+// them when the files change so certificates can be rotated without a
+// restart
+type certReloader struct {
+	cfg TLSConfig
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(cfg TLSConfig) (*certReloader, error) {
+	r := &certReloader{cfg: cfg}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.CAFile != "" {
+		files = append(files, r.cfg.CAFile)
+	}
+	return files
+}
+
+// load reads the certificate, key and CA files
+func (r *certReloader) load() error {
+	modTimes := map[string]time.Time{}
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.CAFile != "" {
+		pem, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.cfg.CAFile)
+		}
+	}
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
+
+// changed reports whether any file was modified since it was loaded
+func (r *certReloader) changed() bool {
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// current returns the loaded certificate and CA pool, reloading them first
+// if the files changed. A failed reload, e.g. while files are half
+// written, keeps the previous ones.
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= reloadCheckInterval {
+		r.checkedAt = time.Now()
+		if r.changed() {
+			if err := r.load(); err != nil {
+				log.Printf("gRPC TLS reload failed, keeping current certificates: %v", err)
+			} else {
+				log.Println("gRPC TLS certificates reloaded")
+			}
+		}
+	}
+
+	return r.cert, r.clientCAs
+}
+
+// tlsConfig returns a server TLS config that picks up reloaded certificates
+// on every handshake
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, clientCAs := r.current()
+
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				NextProtos:   []string{"h2"},
+			}
+			if clientCAs != nil {
+				cfg.ClientCAs = clientCAs
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+				if r.cfg.RequireClientCert {
+					cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				}
+			}
+			return cfg, nil
+		},
+	}
+}
@@ -2,9 +2,14 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/Caesarsage/bankflow/account-service/internal/access"
+	"github.com/Caesarsage/bankflow/account-service/internal/middleware"
 	"github.com/Caesarsage/bankflow/account-service/internal/models"
+	"github.com/Caesarsage/bankflow/account-service/internal/repository"
 	"github.com/Caesarsage/bankflow/account-service/internal/service"
+	"github.com/Caesarsage/bankflow/account-service/pkg/auth"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
@@ -13,10 +18,11 @@ import (
 
 type AccountHandler struct {
 	service *service.AccountService
+	access  *access.Checker
 }
 
-func NewAccountHandler(service *service.AccountService) *AccountHandler {
-	return &AccountHandler{service: service}
+func NewAccountHandler(service *service.AccountService, access *access.Checker) *AccountHandler {
+	return &AccountHandler{service: service, access: access}
 }
 
 // CreateAccount handles POST /api/v1/accounts
@@ -27,6 +33,19 @@ func (h *AccountHandler) CreateAccount(c *gin.Context) {
 		return
 	}
 
+	// Customers open accounts for themselves at the default interest rate;
+	// anything else is a staff operation
+	claims, _ := middleware.Claims(c)
+	if !claims.HasPermission(access.PermissionAccountsUpdate) {
+		if req.InterestRate != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "missing permission " + access.PermissionAccountsUpdate})
+			return
+		}
+		if !h.authorize(c, h.access.CanAccessCustomer(c.Request.Context(), claims, req.CustomerID)) {
+			return
+		}
+	}
+
 	account, err := h.service.CreateAccount(c.Request.Context(), &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -44,6 +63,10 @@ func (h *AccountHandler) GetAccount(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeAccount(c, id) {
+		return
+	}
+
 	account, err := h.service.GetAccountByID(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
@@ -63,6 +86,11 @@ func (h *AccountHandler) GetAccountByNumber(c *gin.Context) {
 		return
 	}
 
+	claims, _ := middleware.Claims(c)
+	if !h.authorize(c, h.access.CanAccessCustomer(c.Request.Context(), claims, account.CustomerID)) {
+		return
+	}
+
 	c.JSON(http.StatusOK, account)
 }
 
@@ -74,6 +102,11 @@ func (h *AccountHandler) GetCustomerAccounts(c *gin.Context) {
 		return
 	}
 
+	claims, _ := middleware.Claims(c)
+	if !h.authorize(c, h.access.CanAccessCustomer(c.Request.Context(), claims, customerID)) {
+		return
+	}
+
 	accounts, err := h.service.GetAccountsByCustomerID(c.Request.Context(), customerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -99,7 +132,14 @@ func (h *AccountHandler) UpdateAccount(c *gin.Context) {
 
 	account, err := h.service.UpdateAccount(c.Request.Context(), id, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch err {
+		case service.ErrStatusClosed:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case repository.ErrAccountNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
@@ -114,6 +154,10 @@ func (h *AccountHandler) GetBalance(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeAccount(c, id) {
+		return
+	}
+
 	balance, availableBalance, err := h.service.GetBalance(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
@@ -166,12 +210,38 @@ func (h *AccountHandler) CloseAccount(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.CloseAccount(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req models.CloseAccountRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	closure, err := h.service.CloseAccount(c.Request.Context(), id, &req)
+	if err != nil {
+		writeCloseError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "account closed successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "account closed successfully",
+		"data":    closure,
+	})
+}
+
+// writeCloseError writes the response for a failed account closure
+func writeCloseError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrInvalidSettlement, repository.ErrSettlementRequired, repository.ErrCurrencyMismatch:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case repository.ErrAccountNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+	case repository.ErrAccountClosed, repository.ErrActiveHolds, repository.ErrSettlementNotActive, repository.ErrNegativeBalance:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
 
 // CreateHold handles POST /api/v1/accounts/:id/holds
@@ -219,20 +289,48 @@ func (h *AccountHandler) ReleaseHold(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "hold released successfully"})
 }
 
-// RegisterRoutes registers all account routes
-func (h *AccountHandler) RegisterRoutes(router *gin.RouterGroup) {
+// authorizeAccount checks that the caller may access an account, writing
+// an error response if not
+func (h *AccountHandler) authorizeAccount(c *gin.Context, accountID uuid.UUID) bool {
+	claims, _ := middleware.Claims(c)
+	return h.authorize(c, h.access.CanAccessAccount(c.Request.Context(), claims, accountID))
+}
+
+// authorize writes the error response for a failed access check
+func (h *AccountHandler) authorize(c *gin.Context, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case access.ErrForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case repository.ErrAccountNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return false
+}
+
+// RegisterRoutes registers all account routes. Every route requires an
+// identity-service access token; customers can only reach their own
+// accounts, and staff operations require the matching permission. Closing
+// an account also requires a login or step-up within stepUpMaxAge. Revoked
+// tokens are rejected when revocations is not nil.
+func (h *AccountHandler) RegisterRoutes(router *gin.RouterGroup, validator *auth.Validator, revocations *auth.RevocationChecker, stepUpMaxAge time.Duration) {
 	accounts := router.Group("/accounts")
+	accounts.Use(middleware.Authenticate(validator, revocations))
 	{
 		accounts.POST("", h.CreateAccount)
 		accounts.GET("/:id", h.GetAccount)
 		accounts.GET("/number/:number", h.GetAccountByNumber)
 		accounts.GET("/customer/:customerId", h.GetCustomerAccounts)
-		accounts.PUT("/:id", h.UpdateAccount)
 		accounts.GET("/:id/balance", h.GetBalance)
-		accounts.POST("/:id/freeze", h.FreezeAccount)
-		accounts.POST("/:id/unfreeze", h.UnfreezeAccount)
-		accounts.DELETE("/:id", h.CloseAccount)
-		accounts.POST("/:id/holds", h.CreateHold)
-		accounts.POST("/holds/:holdId/release", h.ReleaseHold)
+
+		accounts.PUT("/:id", middleware.RequirePermission(access.PermissionAccountsUpdate), h.UpdateAccount)
+		accounts.POST("/:id/freeze", middleware.RequirePermission(access.PermissionAccountsFreeze), h.FreezeAccount)
+		accounts.POST("/:id/unfreeze", middleware.RequirePermission(access.PermissionAccountsFreeze), h.UnfreezeAccount)
+		accounts.DELETE("/:id", middleware.RequirePermission(access.PermissionAccountsClose), middleware.RequireStepUp(stepUpMaxAge), h.CloseAccount)
+		accounts.POST("/:id/holds", middleware.RequirePermission(access.PermissionAccountsTransact), h.CreateHold)
+		accounts.POST("/holds/:holdId/release", middleware.RequirePermission(access.PermissionAccountsTransact), h.ReleaseHold)
 	}
 }
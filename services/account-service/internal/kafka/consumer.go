@@ -0,0 +1,330 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/events"
+	"github.com/segmentio/kafka-go"
+)
+
+// Dead-letter headers added to a message alongside its original headers.
+// The source headers name where the message was first published and are
+// kept when it is replayed or dead-lettered again.
+const (
+	HeaderDLQReason    = "x-dlq-reason"
+	HeaderDLQTopic     = "x-dlq-source-topic"
+	HeaderDLQPartition = "x-dlq-source-partition"
+	HeaderDLQOffset    = "x-dlq-source-offset"
+	HeaderDLQAttempts  = "x-dlq-attempts"
+)
+
+// HeaderReplayedFrom marks a message replayed from a dead-letter topic with
+// the topic, partition and offset it was replayed from
+const HeaderReplayedFrom = "x-replayed-from"
+
+// Reader is the subset of *kafka.Reader used by Consumer
+type Reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Writer is the subset of *kafka.Writer used to publish dead letters
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// HandlerFunc handles a decoded event
+type HandlerFunc func(ctx context.Context, event *events.Envelope) error
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the consumer dead-letters the message without retrying
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Router dispatches events to handlers registered by event type
+type Router struct {
+	handlers map[string]HandlerFunc
+}
+
+func NewRouter() *Router {
+	return &Router{handlers: make(map[string]HandlerFunc)}
+}
+
+// HandleFunc registers fn for eventType
+func (r *Router) HandleFunc(eventType string, fn HandlerFunc) {
+	r.handlers[eventType] = fn
+}
+
+// Dispatch runs the handler registered for the event once. It reports false
+// when no handler is registered.
+func (r *Router) Dispatch(ctx context.Context, event *events.Envelope) (bool, error) {
+	handler, ok := r.handlers[event.Type]
+	if !ok {
+		return false, nil
+	}
+	return true, handler(ctx, event)
+}
+
+// Handle registers a handler that receives the event payload decoded into T.
+// Payloads that cannot be decoded are dead-lettered.
+func Handle[T any](r *Router, eventType string, fn func(ctx context.Context, event *events.Envelope, data *T) error) {
+	r.HandleFunc(eventType, func(ctx context.Context, event *events.Envelope) error {
+		data := new(T)
+		if err := event.Decode(data); err != nil {
+			return Permanent(fmt.Errorf("decode %s: %w", event.Type, err))
+		}
+		return fn(ctx, event, data)
+	})
+}
+
+// Consumer reads events from a topic as part of a consumer group, dispatches
+// them through its Router and commits each message only after it has been
+// handled or dead-lettered
+type Consumer struct {
+	*Router
+	reader      Reader
+	deadLetters Writer
+	sequences   *SequenceTracker
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewConsumer creates a consumer group reader for topic and a writer for its
+// dead-letter topic
+func NewConsumer(brokers []string, topic, groupID, dlqTopic string) *Consumer {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:        brokers,
+		Topic:          topic,
+		GroupID:        groupID,
+		MinBytes:       1,
+		MaxBytes:       10e6,
+		CommitInterval: 0, // commit synchronously
+	})
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        dlqTopic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+
+	return NewConsumerWithReader(reader, writer)
+}
+
+// NewConsumerWithReader creates a consumer over any Reader and Writer, such as
+// the in-memory MemoryBroker
+func NewConsumerWithReader(reader Reader, deadLetters Writer) *Consumer {
+	return &Consumer{
+		Router:      NewRouter(),
+		reader:      reader,
+		deadLetters: deadLetters,
+		maxAttempts: 3,
+		backoff:     200 * time.Millisecond,
+	}
+}
+
+// SetRetryPolicy sets how many times a handler is tried before the message is
+// dead-lettered and the initial delay between tries, which doubles each time
+func (c *Consumer) SetRetryPolicy(maxAttempts int, backoff time.Duration) {
+	c.maxAttempts = maxAttempts
+	c.backoff = backoff
+}
+
+// TrackSequences makes the consumer check the sequence number of events that
+// carry one. Events already handled, such as redeliveries, are committed
+// without being handled again; gaps are logged and the event is handled.
+func (c *Consumer) TrackSequences(tracker *SequenceTracker) {
+	c.sequences = tracker
+}
+
+// Run consumes messages until ctx is cancelled or a message can neither be
+// handled nor dead-lettered
+func (c *Consumer) Run(ctx context.Context) error {
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if err := c.process(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if err := c.reader.CommitMessages(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the reader and dead-letter writer
+func (c *Consumer) Close() error {
+	return errors.Join(c.reader.Close(), c.deadLetters.Close())
+}
+
+// process handles msg, retrying with backoff, and dead-letters it when the
+// handler keeps failing. A nil return means msg may be committed.
+func (c *Consumer) process(ctx context.Context, msg kafka.Message) error {
+	event, err := Decode(msg)
+	if err != nil {
+		return c.deadLetter(ctx, msg, err, 0)
+	}
+
+	tracked := c.sequences != nil && event.Sequence > 0 && event.Subject != ""
+	if tracked {
+		result, last := c.sequences.Check(event.Subject, event.Sequence)
+		switch {
+		case result == SequenceStale && !isReplay(msg):
+			log.Printf("Skipping stale %s event %s for %s: sequence %d, last seen %d", event.Type, event.ID, event.Subject, event.Sequence, last)
+			return nil
+		case result == SequenceGap:
+			log.Printf("Sequence gap for %s: expected %d, got %d (%s event %s)", event.Subject, last+1, event.Sequence, event.Type, event.ID)
+		}
+	}
+
+	delay := c.backoff
+	for attempt := 1; ; attempt++ {
+		_, err = c.Dispatch(ctx, event)
+		if err == nil {
+			// Only handled events count as seen, so a failed one is handled
+			// when it is redelivered or replayed from the dead-letter topic
+			if tracked {
+				c.sequences.Advance(event.Subject, event.Sequence)
+			}
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= c.maxAttempts {
+			log.Printf("Failed to handle %s event %s after %d attempt(s): %v", event.Type, event.ID, attempt, err)
+			return c.deadLetter(ctx, msg, err, attempt)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isReplay reports whether msg is being replayed from a dead-letter topic,
+// either read from it directly or republished by eventctl. Replays are
+// deliberate, so they are handled even if they look stale.
+func isReplay(msg kafka.Message) bool {
+	for _, h := range msg.Headers {
+		if h.Key == HeaderDLQReason || h.Key == HeaderReplayedFrom {
+			return true
+		}
+	}
+	return false
+}
+
+// deadLetter writes msg to the dead-letter topic. A message that was already
+// dead-lettered keeps its source headers, so it stays identified by where it
+// was first published.
+func (c *Consumer) deadLetter(ctx context.Context, msg kafka.Message, reason error, attempts int) error {
+	headers := []kafka.Header{}
+	hasSource := false
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case HeaderDLQReason, HeaderDLQAttempts:
+			continue
+		case HeaderDLQTopic:
+			hasSource = true
+		}
+		headers = append(headers, h)
+	}
+
+	if !hasSource {
+		headers = append(headers,
+			kafka.Header{Key: HeaderDLQTopic, Value: []byte(msg.Topic)},
+			kafka.Header{Key: HeaderDLQPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+			kafka.Header{Key: HeaderDLQOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		)
+	}
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQReason, Value: []byte(reason.Error())},
+		kafka.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+	)
+
+	return c.deadLetters.WriteMessages(ctx, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+}
+
+// Decode reads an event from a binary-mode CloudEvents message, falling back
+// to the plain JSON messages with an "event_type" field that
+// transaction-service publishes
+func Decode(msg kafka.Message) (*events.Envelope, error) {
+	for _, h := range msg.Headers {
+		if h.Key == headerSpecVersion {
+			return FromMessage(msg)
+		}
+	}
+
+	var legacy struct {
+		EventType string `json:"event_type"`
+		Timestamp int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal(msg.Value, &legacy); err != nil {
+		return nil, err
+	}
+	if legacy.EventType == "" {
+		return nil, events.ErrInvalidEnvelope
+	}
+
+	// Identify the message by where it was first published, so the ID
+	// survives a trip through the dead-letter topic
+	topic, partition, offset := msg.Topic, strconv.Itoa(msg.Partition), strconv.FormatInt(msg.Offset, 10)
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case HeaderDLQTopic:
+			topic = string(h.Value)
+		case HeaderDLQPartition:
+			partition = string(h.Value)
+		case HeaderDLQOffset:
+			offset = string(h.Value)
+		}
+	}
+
+	event := &events.Envelope{
+		SpecVersion:     events.SpecVersion,
+		ID:              topic + "-" + partition + "-" + offset,
+		Source:          topic,
+		Type:            legacy.EventType,
+		Subject:         string(msg.Key),
+		Time:            msg.Time,
+		DataContentType: "application/json",
+		Data:            msg.Value,
+	}
+	if legacy.Timestamp > 0 {
+		event.Time = time.UnixMilli(legacy.Timestamp)
+	}
+
+	return event, nil
+}
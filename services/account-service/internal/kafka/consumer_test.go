@@ -0,0 +1,453 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/events"
+	"github.com/Caesarsage/bankflow/account-service/internal/kafka"
+	"github.com/google/uuid"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const (
+	topic    = "transaction-events"
+	dlqTopic = "transaction-events.dlq"
+)
+
+// start runs a consumer of topic on broker, dead-lettering to dlqTopic,
+// until the test ends
+func start(t *testing.T, broker *kafka.MemoryBroker, setup func(c *kafka.Consumer)) {
+	t.Helper()
+	startWith(t, broker, broker.Writer(dlqTopic), setup)
+}
+
+// startWith runs a consumer with its own dead-letter writer and returns
+// the error Run stops with
+func startWith(t *testing.T, broker *kafka.MemoryBroker, deadLetters kafka.Writer, setup func(c *kafka.Consumer)) <-chan error {
+	t.Helper()
+
+	consumer := kafka.NewConsumerWithReader(broker.Reader(topic), deadLetters)
+	consumer.SetRetryPolicy(3, 5*time.Millisecond)
+	setup(consumer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	stopped := make(chan struct{})
+	go func() {
+		done <- consumer.Run(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return done
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func publish(t *testing.T, broker *kafka.MemoryBroker, event *events.Envelope) {
+	t.Helper()
+	broker.Writer(topic).WriteMessages(context.Background(), kafka.ToMessage(event))
+}
+
+func frozenEvent(t *testing.T, accountID uuid.UUID, seq int64) *events.Envelope {
+	t.Helper()
+	event, err := events.New(events.TypeAccountFrozen, accountID.String(), events.AccountFrozen{
+		AccountID: accountID,
+		FrozenAt:  time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.Sequence = seq
+	return event
+}
+
+func header(msg kafkago.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestConsumerRetriesWithBackoff(t *testing.T) {
+	broker := kafka.NewMemoryBroker()
+
+	var mu sync.Mutex
+	var calls []time.Time
+	start(t, broker, func(c *kafka.Consumer) {
+		c.HandleFunc(events.TypeAccountFrozen, func(ctx context.Context, event *events.Envelope) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, time.Now())
+			if len(calls) < 3 {
+				return errors.New("database unavailable")
+			}
+			return nil
+		})
+	})
+
+	publish(t, broker, frozenEvent(t, uuid.New(), 0))
+	waitFor(t, "commit", func() bool { return broker.Committed(topic) == 1 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 3 {
+		t.Fatalf("handler called %d times, want 3", len(calls))
+	}
+	// The delay doubles after each failure
+	if gap := calls[1].Sub(calls[0]); gap < 5*time.Millisecond {
+		t.Errorf("first retry after %v, want at least 5ms", gap)
+	}
+	if gap := calls[2].Sub(calls[1]); gap < 10*time.Millisecond {
+		t.Errorf("second retry after %v, want at least 10ms", gap)
+	}
+	if n := len(broker.Messages(dlqTopic)); n != 0 {
+		t.Errorf("%d dead letters, want none", n)
+	}
+}
+
+func TestConsumerDeadLettersWithHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  kafka.HandlerFunc
+		attempts string
+		reason   string
+	}{
+		{
+			name: "retries exhausted",
+			handler: func(ctx context.Context, event *events.Envelope) error {
+				return errors.New("database unavailable")
+			},
+			attempts: "3",
+			reason:   "database unavailable",
+		},
+		{
+			name: "permanent failure",
+			handler: func(ctx context.Context, event *events.Envelope) error {
+				return kafka.Permanent(errors.New("account not found"))
+			},
+			attempts: "1",
+			reason:   "account not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafka.NewMemoryBroker()
+			start(t, broker, func(c *kafka.Consumer) {
+				c.HandleFunc(events.TypeAccountFrozen, tt.handler)
+			})
+
+			event := frozenEvent(t, uuid.New(), 0)
+			publish(t, broker, event)
+			waitFor(t, "commit", func() bool { return broker.Committed(topic) == 1 })
+
+			dead := broker.Messages(dlqTopic)
+			if len(dead) != 1 {
+				t.Fatalf("%d dead letters, want 1", len(dead))
+			}
+
+			msg := dead[0]
+			want := map[string]string{
+				kafka.HeaderDLQReason:    tt.reason,
+				kafka.HeaderDLQTopic:     topic,
+				kafka.HeaderDLQPartition: "0",
+				kafka.HeaderDLQOffset:    "0",
+				kafka.HeaderDLQAttempts:  tt.attempts,
+				"ce_id":                  event.ID,
+			}
+			for key, value := range want {
+				if got := header(msg, key); got != value {
+					t.Errorf("header %s = %q, want %q", key, got, value)
+				}
+			}
+			if string(msg.Key) != event.Subject || string(msg.Value) != string(event.Data) {
+				t.Error("dead letter does not carry the original key and value")
+			}
+		})
+	}
+}
+
+func TestConsumerDeadLettersUndecodableMessages(t *testing.T) {
+	broker := kafka.NewMemoryBroker()
+	start(t, broker, func(c *kafka.Consumer) {
+		kafka.Handle(c.Router, events.TypeTransactionCompleted, func(ctx context.Context, event *events.Envelope, data *events.TransactionEvent) error {
+			t.Error("handler called for an undecodable message")
+			return nil
+		})
+	})
+
+	writer := broker.Writer(topic)
+	writer.WriteMessages(context.Background(),
+		kafkago.Message{Value: []byte("not json")},
+		kafkago.Message{Value: []byte(`{"event_type":"transaction.completed","amount":"lots"}`)},
+	)
+
+	bad := frozenEvent(t, uuid.New(), 0)
+	bad.Data = []byte(`{"account_id": 42}`)
+	publish(t, broker, bad)
+
+	waitFor(t, "commits", func() bool { return broker.Committed(topic) == 3 })
+
+	dead := broker.Messages(dlqTopic)
+	if len(dead) != 3 {
+		t.Fatalf("%d dead letters, want 3", len(dead))
+	}
+	// Unreadable messages and payloads off their schema are never handled;
+	// payloads the handler cannot decode are not retried
+	for i, want := range []string{"0", "1", "0"} {
+		if got := header(dead[i], kafka.HeaderDLQAttempts); got != want {
+			t.Errorf("dead letter %d attempts = %q, want %s", i, got, want)
+		}
+	}
+}
+
+func TestConsumerCommitsOnlyAfterHandling(t *testing.T) {
+	broker := kafka.NewMemoryBroker()
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	start(t, broker, func(c *kafka.Consumer) {
+		c.HandleFunc(events.TypeAccountFrozen, func(ctx context.Context, event *events.Envelope) error {
+			close(handling)
+			<-release
+			return nil
+		})
+	})
+
+	publish(t, broker, frozenEvent(t, uuid.New(), 0))
+
+	<-handling
+	if got := broker.Committed(topic); got != 0 {
+		t.Fatalf("committed offset %d while the handler was running", got)
+	}
+
+	close(release)
+	waitFor(t, "commit", func() bool { return broker.Committed(topic) == 1 })
+}
+
+type failingWriter struct{}
+
+func (failingWriter) WriteMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	return errors.New("broker unavailable")
+}
+
+func (failingWriter) Close() error { return nil }
+
+func TestConsumerStopsWithoutCommittingWhenDeadLetteringFails(t *testing.T) {
+	broker := kafka.NewMemoryBroker()
+	done := startWith(t, broker, failingWriter{}, func(c *kafka.Consumer) {
+		c.HandleFunc(events.TypeAccountFrozen, func(ctx context.Context, event *events.Envelope) error {
+			return kafka.Permanent(errors.New("account not found"))
+		})
+	})
+
+	publish(t, broker, frozenEvent(t, uuid.New(), 0))
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Run returned nil, want the dead-letter error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("consumer kept running")
+	}
+
+	if got := broker.Committed(topic); got != 0 {
+		t.Errorf("committed offset %d, want 0", got)
+	}
+}
+
+func TestConsumerDecodesLegacyMessages(t *testing.T) {
+	broker := kafka.NewMemoryBroker()
+	accountID := uuid.New()
+
+	received := make(chan *events.Envelope, 2)
+	start(t, broker, func(c *kafka.Consumer) {
+		kafka.Handle(c.Router, events.TypeTransactionCompleted, func(ctx context.Context, event *events.Envelope, data *events.TransactionEvent) error {
+			if data.ToAccountID == nil || *data.ToAccountID != accountID || data.Amount.String() != "12.5" {
+				t.Errorf("decoded payload %+v", data)
+			}
+			received <- event
+			return nil
+		})
+	})
+
+	value := []byte(`{"event_type":"transaction.completed","transaction_id":"tx-1","transaction_ref":"TXN1",` +
+		`"to_account_id":"` + accountID.String() + `","amount":"12.5","timestamp":1700000000000}`)
+	writer := broker.Writer(topic)
+	writer.WriteMessages(context.Background(), kafkago.Message{Key: []byte("tx-1"), Value: value})
+
+	// A replay from the dead-letter topic keeps the ID of the original
+	writer.WriteMessages(context.Background(), kafkago.Message{
+		Key:   []byte("tx-1"),
+		Value: value,
+		Headers: []kafkago.Header{
+			{Key: kafka.HeaderDLQReason, Value: []byte("database unavailable")},
+			{Key: kafka.HeaderDLQTopic, Value: []byte(topic)},
+			{Key: kafka.HeaderDLQPartition, Value: []byte("0")},
+			{Key: kafka.HeaderDLQOffset, Value: []byte("0")},
+		},
+	})
+
+	first, replay := <-received, <-received
+	if first.Type != events.TypeTransactionCompleted || first.Subject != "tx-1" || first.Source != topic {
+		t.Errorf("legacy envelope %+v", first)
+	}
+	if first.ID != topic+"-0-0" {
+		t.Errorf("legacy ID = %q, want %q", first.ID, topic+"-0-0")
+	}
+	if !first.Time.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("legacy time = %v, want the payload timestamp", first.Time)
+	}
+	if replay.ID != first.ID {
+		t.Errorf("replayed ID = %q, want %q", replay.ID, first.ID)
+	}
+	waitFor(t, "commits", func() bool { return broker.Committed(topic) == 2 })
+}
+
+func TestConsumerSkipsOnlyHandledSequences(t *testing.T) {
+	broker := kafka.NewMemoryBroker()
+	accountID := uuid.New()
+
+	var mu sync.Mutex
+	var handled []int64
+	failures := 1
+	start(t, broker, func(c *kafka.Consumer) {
+		c.SetRetryPolicy(1, time.Millisecond)
+		c.TrackSequences(kafka.NewSequenceTracker(0))
+		c.HandleFunc(events.TypeAccountFrozen, func(ctx context.Context, event *events.Envelope) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if event.Sequence == 2 && failures > 0 {
+				failures--
+				return errors.New("database unavailable")
+			}
+			handled = append(handled, event.Sequence)
+			return nil
+		})
+	})
+
+	// 2 fails and is dead-lettered, 1 is redelivered, then 2 is replayed
+	// and 4 arrives before the missing 3
+	for _, seq := range []int64{1, 2, 1, 2, 4, 3, 4} {
+		publish(t, broker, frozenEvent(t, accountID, seq))
+	}
+	waitFor(t, "commits", func() bool { return broker.Committed(topic) == 7 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []int64{1, 2, 4, 3}
+	if len(handled) != len(want) {
+		t.Fatalf("handled sequences %v, want %v", handled, want)
+	}
+	for i := range want {
+		if handled[i] != want[i] {
+			t.Fatalf("handled sequences %v, want %v", handled, want)
+		}
+	}
+	if got := header(broker.Messages(dlqTopic)[0], kafka.HeaderDLQAttempts); got != strconv.Itoa(1) {
+		t.Errorf("dead letter attempts = %q, want 1", got)
+	}
+}
+
+func TestConsumerHandlesReplayedStaleEvents(t *testing.T) {
+	broker := kafka.NewMemoryBroker()
+	accountID := uuid.New()
+
+	var mu sync.Mutex
+	var handled []int64
+	start(t, broker, func(c *kafka.Consumer) {
+		c.TrackSequences(kafka.NewSequenceTracker(0))
+		c.HandleFunc(events.TypeAccountFrozen, func(ctx context.Context, event *events.Envelope) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, event.Sequence)
+			return nil
+		})
+	})
+
+	publish(t, broker, frozenEvent(t, accountID, 1))
+	publish(t, broker, frozenEvent(t, accountID, 2))
+
+	// Republished by eventctl replay, without the failure headers
+	replayed := kafka.ToMessage(frozenEvent(t, accountID, 1))
+	replayed.Headers = append(replayed.Headers, kafkago.Header{Key: kafka.HeaderReplayedFrom, Value: []byte(dlqTopic + "/0/0")})
+	broker.Writer(topic).WriteMessages(context.Background(), replayed)
+
+	// A plain redelivery of the same sequence is still skipped
+	publish(t, broker, frozenEvent(t, accountID, 1))
+	waitFor(t, "commits", func() bool { return broker.Committed(topic) == 4 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []int64{1, 2, 1}
+	if len(handled) != len(want) {
+		t.Fatalf("handled sequences %v, want %v", handled, want)
+	}
+	for i := range want {
+		if handled[i] != want[i] {
+			t.Fatalf("handled sequences %v, want %v", handled, want)
+		}
+	}
+}
+
+func TestConsumerKeepsSourceWhenDeadLetteringAgain(t *testing.T) {
+	broker := kafka.NewMemoryBroker()
+	start(t, broker, func(c *kafka.Consumer) {
+		c.HandleFunc(events.TypeAccountFrozen, func(ctx context.Context, event *events.Envelope) error {
+			return kafka.Permanent(errors.New("account not found"))
+		})
+	})
+
+	// A replay of a message first published to another topic at offset 7
+	msg := kafka.ToMessage(frozenEvent(t, uuid.New(), 0))
+	msg.Headers = append(msg.Headers,
+		kafkago.Header{Key: kafka.HeaderDLQTopic, Value: []byte("legacy-events")},
+		kafkago.Header{Key: kafka.HeaderDLQPartition, Value: []byte("2")},
+		kafkago.Header{Key: kafka.HeaderDLQOffset, Value: []byte("7")},
+		kafkago.Header{Key: kafka.HeaderReplayedFrom, Value: []byte(dlqTopic + "/0/0")},
+	)
+	broker.Writer(topic).WriteMessages(context.Background(), msg)
+	waitFor(t, "commit", func() bool { return broker.Committed(topic) == 1 })
+
+	dead := broker.Messages(dlqTopic)
+	if len(dead) != 1 {
+		t.Fatalf("%d dead letters, want 1", len(dead))
+	}
+
+	counts := map[string]int{}
+	for _, h := range dead[0].Headers {
+		counts[h.Key]++
+	}
+	for _, key := range []string{kafka.HeaderDLQTopic, kafka.HeaderDLQPartition, kafka.HeaderDLQOffset, kafka.HeaderDLQReason, kafka.HeaderDLQAttempts} {
+		if counts[key] != 1 {
+			t.Errorf("%d %s headers, want 1", counts[key], key)
+		}
+	}
+	if got := header(dead[0], kafka.HeaderDLQTopic); got != "legacy-events" {
+		t.Errorf("source topic = %q, want legacy-events", got)
+	}
+	if got := header(dead[0], kafka.HeaderDLQOffset); got != "7" {
+		t.Errorf("source offset = %q, want 7", got)
+	}
+}
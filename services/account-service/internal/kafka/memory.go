@@ -0,0 +1,128 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MemoryBroker is an in-memory stand-in for Kafka with one partition per topic
+// and one committed offset per topic, for exercising consumers without a
+// cluster
+type MemoryBroker struct {
+	mu        sync.Mutex
+	topics    map[string][]kafka.Message
+	committed map[string]int64
+	written   chan struct{}
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics:    make(map[string][]kafka.Message),
+		committed: make(map[string]int64),
+		written:   make(chan struct{}),
+	}
+}
+
+// Writer returns a writer appending to topic
+func (b *MemoryBroker) Writer(topic string) Writer {
+	return &memoryWriter{broker: b, topic: topic}
+}
+
+// Reader returns a reader starting at the committed offset of topic
+func (b *MemoryBroker) Reader(topic string) Reader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &memoryReader{broker: b, topic: topic, next: b.committed[topic]}
+}
+
+// Messages returns a copy of the messages written to topic
+func (b *MemoryBroker) Messages(topic string) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]kafka.Message{}, b.topics[topic]...)
+}
+
+// Committed returns the next offset to be read from topic after a restart
+func (b *MemoryBroker) Committed(topic string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.committed[topic]
+}
+
+func (b *MemoryBroker) write(topic string, msgs ...kafka.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, msg := range msgs {
+		msg.Topic = topic
+		msg.Offset = int64(len(b.topics[topic]))
+		if msg.Time.IsZero() {
+			msg.Time = time.Now()
+		}
+		b.topics[topic] = append(b.topics[topic], msg)
+	}
+
+	// Wake blocked readers
+	close(b.written)
+	b.written = make(chan struct{})
+}
+
+type memoryWriter struct {
+	broker *MemoryBroker
+	topic  string
+}
+
+func (w *memoryWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.broker.write(w.topic, msgs...)
+	return nil
+}
+
+func (w *memoryWriter) Close() error {
+	return nil
+}
+
+type memoryReader struct {
+	broker *MemoryBroker
+	topic  string
+	next   int64
+}
+
+func (r *memoryReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		r.broker.mu.Lock()
+		msgs := r.broker.topics[r.topic]
+		if r.next < int64(len(msgs)) {
+			msg := msgs[r.next]
+			r.next++
+			r.broker.mu.Unlock()
+			return msg, nil
+		}
+		written := r.broker.written
+		r.broker.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-written:
+		}
+	}
+}
+
+func (r *memoryReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	for _, msg := range msgs {
+		if msg.Offset+1 > r.broker.committed[r.topic] {
+			r.broker.committed[r.topic] = msg.Offset + 1
+		}
+	}
+	return nil
+}
+
+func (r *memoryReader) Close() error {
+	return nil
+}
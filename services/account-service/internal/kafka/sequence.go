@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"container/list"
+	"sync"
+)
+
+// SequenceResult classifies an event's sequence number against the last one
+// seen for the same subject
+type SequenceResult int
+
+const (
+	// SequenceFirst is the first event seen for the subject
+	SequenceFirst SequenceResult = iota
+	// SequenceNext directly follows the last event seen
+	SequenceNext
+	// SequenceGap skips one or more events
+	SequenceGap
+	// SequenceStale repeats or precedes an event already seen
+	SequenceStale
+)
+
+// maxAhead bounds how many handled sequence numbers past a gap are kept for
+// a subject. Beyond it the gap is given up on and its events become stale.
+const maxAhead = 1000
+
+// DefaultMaxSubjects is how many subjects a tracker remembers by default
+const DefaultMaxSubjects = 100000
+
+// SequenceTracker detects gaps and out-of-order delivery in per-subject event
+// sequences. Check classifies an event and Advance records it once handled,
+// so events that failed are not mistaken for stale when they are retried.
+// Handled events past a gap are remembered until it fills, so the missing
+// events are still handled when they arrive.
+//
+// State is kept in memory for at most maxSubjects subjects, evicting the
+// least recently seen. After a restart, a rebalance or an eviction the next
+// event seen for a subject becomes its baseline, so the tracker catches
+// reordering and redelivery within a run but is no substitute for idempotent
+// handlers.
+type SequenceTracker struct {
+	mu          sync.Mutex
+	maxSubjects int
+	subjects    map[string]*list.Element
+	// recent orders subjects from most to least recently seen
+	recent *list.List
+}
+
+// subjectState is what a tracker remembers about one subject
+type subjectState struct {
+	subject string
+	last    int64
+	ahead   map[int64]bool
+}
+
+// NewSequenceTracker creates a tracker remembering up to maxSubjects
+// subjects, or DefaultMaxSubjects if maxSubjects is not positive
+func NewSequenceTracker(maxSubjects int) *SequenceTracker {
+	if maxSubjects <= 0 {
+		maxSubjects = DefaultMaxSubjects
+	}
+	return &SequenceTracker{
+		maxSubjects: maxSubjects,
+		subjects:    make(map[string]*list.Element),
+		recent:      list.New(),
+	}
+}
+
+// Check returns how seq relates to the events handled for subject, along
+// with the last sequence handled without a gap before it
+func (t *SequenceTracker) Check(subject string, seq int64) (SequenceResult, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.lookup(subject)
+	switch {
+	case state == nil:
+		return SequenceFirst, 0
+	case seq <= state.last || state.ahead[seq]:
+		return SequenceStale, state.last
+	case seq == state.last+1:
+		return SequenceNext, state.last
+	default:
+		return SequenceGap, state.last
+	}
+}
+
+// Advance records that the event with seq has been handled for subject
+func (t *SequenceTracker) Advance(subject string, seq int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.lookup(subject)
+	switch {
+	case state == nil:
+		t.add(subject, seq)
+		return
+	case seq <= state.last:
+		return
+	case seq > state.last+1:
+		if state.ahead == nil {
+			state.ahead = make(map[int64]bool)
+		}
+		state.ahead[seq] = true
+		if len(state.ahead) <= maxAhead {
+			return
+		}
+		// Give up on the gap and carry on from the earliest event past it
+		seq = seq + 1
+		for s := range state.ahead {
+			if s < seq {
+				seq = s
+			}
+		}
+	}
+
+	// seq now directly follows last; fold in any events handled past it
+	for {
+		delete(state.ahead, seq)
+		state.last = seq
+		if !state.ahead[seq+1] {
+			break
+		}
+		seq++
+	}
+	if len(state.ahead) == 0 {
+		state.ahead = nil
+	}
+}
+
+// lookup returns the state of subject, marking it recently seen, or nil if
+// it is not tracked
+func (t *SequenceTracker) lookup(subject string) *subjectState {
+	elem, ok := t.subjects[subject]
+	if !ok {
+		return nil
+	}
+	t.recent.MoveToFront(elem)
+	return elem.Value.(*subjectState)
+}
+
+// add starts tracking subject from seq, evicting the least recently seen
+// subject if the tracker is full
+func (t *SequenceTracker) add(subject string, seq int64) {
+	if t.recent.Len() >= t.maxSubjects {
+		oldest := t.recent.Back()
+		t.recent.Remove(oldest)
+		delete(t.subjects, oldest.Value.(*subjectState).subject)
+	}
+	t.subjects[subject] = t.recent.PushFront(&subjectState{subject: subject, last: seq})
+}
@@ -0,0 +1,52 @@
+package kafka_test
+
+import (
+	"testing"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/kafka"
+)
+
+func TestSequenceTrackerFillsGaps(t *testing.T) {
+	tracker := kafka.NewSequenceTracker(0)
+
+	steps := []struct {
+		seq  int64
+		want kafka.SequenceResult
+	}{
+		{1, kafka.SequenceFirst},
+		{2, kafka.SequenceNext},
+		{4, kafka.SequenceGap},
+		{4, kafka.SequenceStale},
+		{3, kafka.SequenceNext},
+		{4, kafka.SequenceStale},
+		{5, kafka.SequenceNext},
+	}
+	for _, step := range steps {
+		got, _ := tracker.Check("acc", step.seq)
+		if got != step.want {
+			t.Fatalf("Check(%d) = %v, want %v", step.seq, got, step.want)
+		}
+		if got != kafka.SequenceStale {
+			tracker.Advance("acc", step.seq)
+		}
+	}
+}
+
+func TestSequenceTrackerEvictsLeastRecentSubjects(t *testing.T) {
+	tracker := kafka.NewSequenceTracker(2)
+
+	tracker.Advance("a", 1)
+	tracker.Advance("b", 1)
+	tracker.Check("a", 2) // a is now more recent than b
+	tracker.Advance("c", 1)
+
+	if got, _ := tracker.Check("a", 1); got != kafka.SequenceStale {
+		t.Errorf("a = %v, want still tracked", got)
+	}
+	if got, _ := tracker.Check("c", 1); got != kafka.SequenceStale {
+		t.Errorf("c = %v, want tracked", got)
+	}
+	if got, _ := tracker.Check("b", 1); got != kafka.SequenceFirst {
+		t.Errorf("b = %v, want evicted", got)
+	}
+}
@@ -69,6 +69,21 @@ type UpdateAccountRequest struct {
 }
 
 
+// CloseAccountRequest represents the request to close an account
+type CloseAccountRequest struct {
+	SettlementAccountID *uuid.UUID `json:"settlement_account_id,omitempty"`
+}
+
+// AccountClosure represents the outcome of closing an account
+type AccountClosure struct {
+	AccountID           uuid.UUID       `json:"account_id"`
+	SettlementAccountID *uuid.UUID      `json:"settlement_account_id,omitempty"`
+	InterestPosted      decimal.Decimal `json:"interest_posted"`
+	AmountSwept         decimal.Decimal `json:"amount_swept"`
+	Currency            string          `json:"currency"`
+	ClosedAt            time.Time       `json:"closed_at"`
+}
+
 // AccountStatement represents account statement data
 type AccountStatement struct {
 	Account      *Account              `json:"account"`
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// JournalEntryType represents why an account balance changed
+type JournalEntryType string
+
+const (
+	JournalEntryTransaction  JournalEntryType = "TRANSACTION"
+	JournalEntryInterest     JournalEntryType = "INTEREST"
+	JournalEntryClosureSweep JournalEntryType = "CLOSURE_SWEEP"
+	// JournalEntryOpeningBalance carries a balance from before the journal
+	JournalEntryOpeningBalance JournalEntryType = "OPENING_BALANCE"
+	// JournalEntryRepair records a live balance reset to its journal value
+	JournalEntryRepair JournalEntryType = "REPAIR"
+)
+
+// JournalEntry records a single change to an account balance
+type JournalEntry struct {
+	ID           uuid.UUID        `json:"id" db:"id"`
+	Position     int64            `json:"position" db:"position"`
+	AccountID    uuid.UUID        `json:"account_id" db:"account_id"`
+	EntryType    JournalEntryType `json:"entry_type" db:"entry_type"`
+	Amount       decimal.Decimal  `json:"amount" db:"amount"`
+	BalanceAfter decimal.Decimal  `json:"balance_after" db:"balance_after"`
+	Reference    *string          `json:"reference,omitempty" db:"reference"`
+	CreatedAt    time.Time        `json:"created_at" db:"created_at"`
+}
+
+// BalanceSnapshot represents account balances rebuilt from the journal
+type BalanceSnapshot struct {
+	AccountID        uuid.UUID       `json:"account_id" db:"account_id"`
+	Balance          decimal.Decimal `json:"balance" db:"balance"`
+	AvailableBalance decimal.Decimal `json:"available_balance" db:"available_balance"`
+}
+
+// BalanceDiscrepancy represents an account whose live balances differ from
+// the balances rebuilt from the journal
+type BalanceDiscrepancy struct {
+	AccountID        uuid.UUID       `json:"account_id"`
+	LiveBalance      decimal.Decimal `json:"live_balance"`
+	LiveAvailable    decimal.Decimal `json:"live_available_balance"`
+	RebuiltBalance   decimal.Decimal `json:"rebuilt_balance"`
+	RebuiltAvailable decimal.Decimal `json:"rebuilt_available_balance"`
+}
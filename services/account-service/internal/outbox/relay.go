@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/events"
+	"github.com/Caesarsage/bankflow/account-service/internal/kafka"
+	"github.com/Caesarsage/bankflow/account-service/internal/repository"
+	"github.com/google/uuid"
+)
+
+const maxBackoff = 5 * time.Minute
+
+// Relay publishes pending outbox events to Kafka and marks them sent.
+// Delivery is at-least-once: an event is retried until Kafka acknowledges it.
+// Only the relay holding the repository's relay lock publishes, so events of
+// an aggregate leave in the order they were recorded.
+type Relay struct {
+	repo         *repository.OutboxRepository
+	producer     *kafka.Producer
+	pollInterval time.Duration
+	batchSize    int
+}
+
+func NewRelay(repo *repository.OutboxRepository, producer *kafka.Producer, pollInterval time.Duration, batchSize int) *Relay {
+	return &Relay{
+		repo:         repo,
+		producer:     producer,
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+	}
+}
+
+// Run relays events until ctx is cancelled, taking over whenever no other
+// relay holds the lock
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	var lock *repository.RelayLock
+	defer func() {
+		if lock != nil {
+			lock.Release()
+		}
+	}()
+
+	for {
+		if lock != nil && !lock.Held(ctx) {
+			lock.Release()
+			lock = nil
+		}
+		if lock == nil {
+			var err error
+			lock, err = r.repo.TryRelayLock(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Outbox relay failed to take the relay lock: %v", err)
+			}
+		}
+
+		if lock != nil {
+			sent, err := r.relayBatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Outbox relay failed: %v", err)
+			}
+
+			// A full batch means more events are likely waiting
+			if sent == r.batchSize && ctx.Err() == nil {
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayBatch publishes due events in order, in one write to Kafka. When an
+// event fails, later events of the same aggregate wait for it, while other
+// aggregates carry on; any of them that Kafka did accept are published again
+// with it, as delivery is at-least-once. Nothing is locked while publishing;
+// the relay lock keeps other relays out.
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	pending, err := r.repo.GetPendingEvents(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// An event that cannot be decoded holds back the rest of its aggregate
+	blocked := map[uuid.UUID]bool{}
+	batch := []int{}
+	envelopes := []*events.Envelope{}
+	for i, e := range pending {
+		if blocked[e.AggregateID] {
+			continue
+		}
+
+		event := &events.Envelope{}
+		if err := json.Unmarshal(e.Payload, event); err != nil {
+			blocked[e.AggregateID] = true
+			if err := r.repo.MarkFailed(ctx, e.ID, err.Error(), time.Now().Add(maxBackoff)); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		batch = append(batch, i)
+		envelopes = append(envelopes, event)
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	failures := make([]error, len(batch))
+	if err := r.producer.PublishEvents(ctx, envelopes); err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		var writeErrs kafka.WriteErrors
+		if errors.As(err, &writeErrs) && len(writeErrs) == len(batch) {
+			copy(failures, writeErrs)
+		} else {
+			for i := range failures {
+				failures[i] = err
+			}
+		}
+	}
+
+	sent := 0
+	for i, index := range batch {
+		e := pending[index]
+		if blocked[e.AggregateID] {
+			continue
+		}
+
+		if failures[i] != nil {
+			blocked[e.AggregateID] = true
+			if err := r.repo.MarkFailed(ctx, e.ID, failures[i].Error(), time.Now().Add(backoff(e.Attempts+1))); err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		if err := r.repo.MarkSent(ctx, e.ID); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// backoff returns an exponential retry delay capped at maxBackoff
+func backoff(attempts int) time.Duration {
+	if attempts > 10 {
+		return maxBackoff
+	}
+
+	delay := time.Second << attempts
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,103 @@
+// Package projection rebuilds account balances from the balance journal.
+package projection
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/models"
+	"github.com/Caesarsage/bankflow/account-service/internal/repository"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ChainBreak is a journal entry whose balance_after does not follow from the
+// previous entry for the same account
+type ChainBreak struct {
+	AccountID uuid.UUID
+	Position  int64
+	Expected  decimal.Decimal
+	Recorded  decimal.Decimal
+}
+
+// Report summarises a rebuild
+type Report struct {
+	Accounts      int
+	Entries       int
+	ChainBreaks   []ChainBreak
+	Discrepancies []*models.BalanceDiscrepancy
+}
+
+// Rebuilder replays the journal into the shadow balance table and diffs it
+// against the live accounts table
+type Rebuilder struct {
+	repo *repository.JournalRepository
+}
+
+func NewRebuilder(repo *repository.JournalRepository) *Rebuilder {
+	return &Rebuilder{
+		repo: repo,
+	}
+}
+
+// Rebuild recomputes every account's balances from the journal. Available
+// balance is the rebuilt balance less unreleased holds. Accounts without
+// journal entries rebuild to zero, so balances from before the journal need
+// an OPENING_BALANCE entry.
+func (r *Rebuilder) Rebuild(ctx context.Context) (*Report, error) {
+	ids, err := r.repo.GetAccountIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list accounts: %w", err)
+	}
+
+	balances := make(map[uuid.UUID]decimal.Decimal, len(ids))
+	for _, id := range ids {
+		balances[id] = decimal.Zero
+	}
+
+	report := &Report{Accounts: len(ids)}
+
+	err = r.repo.StreamEntries(ctx, func(entry *models.JournalEntry) error {
+		expected := balances[entry.AccountID].Add(entry.Amount)
+		if !expected.Equal(entry.BalanceAfter) {
+			report.ChainBreaks = append(report.ChainBreaks, ChainBreak{
+				AccountID: entry.AccountID,
+				Position:  entry.Position,
+				Expected:  expected,
+				Recorded:  entry.BalanceAfter,
+			})
+		}
+
+		balances[entry.AccountID] = expected
+		report.Entries++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("replay journal: %w", err)
+	}
+
+	holds, err := r.repo.GetActiveHoldTotals(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load holds: %w", err)
+	}
+
+	snapshots := make([]*models.BalanceSnapshot, 0, len(balances))
+	for id, balance := range balances {
+		snapshots = append(snapshots, &models.BalanceSnapshot{
+			AccountID:        id,
+			Balance:          balance,
+			AvailableBalance: balance.Sub(holds[id]),
+		})
+	}
+
+	if err := r.repo.ReplaceShadowBalances(ctx, snapshots); err != nil {
+		return nil, fmt.Errorf("write shadow balances: %w", err)
+	}
+
+	report.Discrepancies, err = r.repo.GetDiscrepancies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("diff balances: %w", err)
+	}
+
+	return report, nil
+}
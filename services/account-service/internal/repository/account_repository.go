@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/Caesarsage/bankflow/account-service/internal/models"
@@ -16,6 +17,14 @@ var (
 	ErrAccountAlreadyExists = errors.New("account already exists")
 	ErrHoldNotFound         = errors.New("hold not found")
 	ErrInsufficientFunds    = errors.New("insufficient funds")
+	ErrAccountClosed        = errors.New("account is already closed")
+	ErrActiveHolds          = errors.New("account has active holds")
+	ErrSettlementRequired   = errors.New("settlement account required to close account with non-zero balance")
+	ErrSettlementNotActive  = errors.New("settlement account is not active")
+	ErrCurrencyMismatch     = errors.New("settlement account currency does not match")
+	ErrBalanceChanged       = errors.New("account balance changed since it was read")
+	ErrNegativeBalance      = errors.New("account with a negative balance cannot be closed")
+	ErrAccountNotActive     = errors.New("account is not active")
 )
 
 type AccountRepository struct {
@@ -28,6 +37,16 @@ func NewAccountRepository(db *sql.DB) *AccountRepository {
 	}
 }
 
+// WithTx runs fn in a single database transaction. Repository calls made with
+// the context passed to fn take part in that transaction.
+func (r *AccountRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withTx(ctx, r.db, fn)
+}
+
+func (r *AccountRepository) conn(ctx context.Context) dbtx {
+	return conn(ctx, r.db)
+}
+
 func (r *AccountRepository) CreateAccount(ctx context.Context, account *models.Account) error {
 	query := `
 		INSERT INTO accounts (
@@ -37,7 +56,7 @@ func (r *AccountRepository) CreateAccount(ctx context.Context, account *models.A
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := r.conn(ctx).ExecContext(ctx, query,
 		account.ID,
 		account.AccountNumber,
 		account.CustomerID,
@@ -65,7 +84,7 @@ func (r *AccountRepository) GetAccountByID(ctx context.Context, id uuid.UUID) (*
 	`
 
 	account := &models.Account{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, query, id).Scan(
 		&account.ID,
 		&account.AccountNumber,
 		&account.CustomerID,
@@ -101,7 +120,7 @@ func (r *AccountRepository) GetAccountByNumber(ctx context.Context, accountNumbe
 	`
 
 	account := &models.Account{}
-	err := r.db.QueryRowContext(ctx, query, accountNumber).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, query, accountNumber).Scan(
 		&account.ID,
 		&account.AccountNumber,
 		&account.CustomerID,
@@ -137,7 +156,7 @@ func (r *AccountRepository) GetAccountsByCustomerID(ctx context.Context, custome
 		ORDER BY created_at DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, customerID)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, customerID)
 	if err != nil {
 		return nil, err
 	}
@@ -178,7 +197,7 @@ func (r *AccountRepository) UpdateAccount(ctx context.Context, account *models.A
 		WHERE id = $4
 	`
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := r.conn(ctx).ExecContext(ctx, query,
 		account.Status,
 		account.InterestRate,
 		time.Now(),
@@ -201,43 +220,124 @@ func (r *AccountRepository) UpdateAccount(ctx context.Context, account *models.A
 	return nil
 }
 
-// UpdateBalance updates account balance (called by transaction service)
+// UpdateBalance updates account balance (called by transaction service) and
+// records the change in the journal. Only active accounts are updated, so a
+// change racing a closure cannot land on the closed account.
 func (r *AccountRepository) UpdateBalance(ctx context.Context, accountID uuid.UUID, amount decimal.Decimal) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE accounts
 		SET balance = balance + $1,
 		    available_balance = available_balance + $1,
 		    updated_at = $2
-		WHERE id = $3 AND balance + $1 >= 0
+		WHERE id = $3 AND status = $4 AND balance + $1 >= 0
+		RETURNING balance
 	`
 
-	result, err := r.db.ExecContext(ctx, query, amount, time.Now(), accountID)
+	var balance decimal.Decimal
+	err = tx.QueryRowContext(ctx, query, amount, time.Now(), accountID, models.AccountStatusActive).Scan(&balance)
+	if err == sql.ErrNoRows {
+		// Re-read the row to tell why it was not updated
+		var status models.AccountStatus
+		err = tx.QueryRowContext(ctx, "SELECT status FROM accounts WHERE id = $1", accountID).Scan(&status)
+		if err == sql.ErrNoRows {
+			return ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if status != models.AccountStatusActive {
+			return ErrAccountNotActive
+		}
+
+		// Account is active but balance would be negative
+		return ErrInsufficientFunds
+	}
 	if err != nil {
 		return err
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
+	if err := insertJournalEntry(ctx, tx, accountID, models.JournalEntryTransaction, amount, balance, nil); err != nil {
 		return err
 	}
 
-	if rows == 0 {
-		// Check if account exists
-		var exists bool
-		err = r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1)", accountID).Scan(&exists)
+	return tx.Commit()
+}
+
+// RepairBalances resets an account's balances to the values its journal
+// gives, as long as they still equal the live values a rebuild found wrong.
+// The account row stays locked from the check to the update, and the repair
+// is journaled with a zero amount so the chain of balances is unbroken. It
+// reports whether anything was repaired.
+func (r *AccountRepository) RepairBalances(ctx context.Context, accountID uuid.UUID, liveBalance, liveAvailable decimal.Decimal) (bool, error) {
+	repaired := false
+	err := withTx(ctx, r.db, func(ctx context.Context) error {
+		tx := r.conn(ctx)
+
+		var balance, available decimal.Decimal
+		err := tx.QueryRowContext(ctx,
+			"SELECT balance, available_balance FROM accounts WHERE id = $1 FOR UPDATE",
+			accountID,
+		).Scan(&balance, &available)
+		if err == sql.ErrNoRows {
+			return ErrAccountNotFound
+		}
 		if err != nil {
 			return err
 		}
 
-		if !exists {
-			return ErrAccountNotFound
+		if !balance.Equal(liveBalance) || !available.Equal(liveAvailable) {
+			return ErrBalanceChanged
 		}
 
-		// Account exists but balance would be negative
-		return ErrInsufficientFunds
-	}
+		// Replay again under the lock, as entries may have been added since
+		// the rebuild
+		var rebuilt, held decimal.Decimal
+		err = tx.QueryRowContext(ctx,
+			"SELECT COALESCE(SUM(amount), 0) FROM journal_entries WHERE account_id = $1",
+			accountID,
+		).Scan(&rebuilt)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		err = tx.QueryRowContext(ctx,
+			"SELECT COALESCE(SUM(amount), 0) FROM account_holds WHERE account_id = $1 AND released_at IS NULL",
+			accountID,
+		).Scan(&held)
+		if err != nil {
+			return err
+		}
+
+		rebuiltAvailable := rebuilt.Sub(held)
+		if rebuilt.Equal(balance) && rebuiltAvailable.Equal(available) {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE accounts SET balance = $1, available_balance = $2, updated_at = $3 WHERE id = $4",
+			rebuilt, rebuiltAvailable, time.Now(), accountID,
+		)
+		if err != nil {
+			return err
+		}
+
+		reference := "live balance was " + balance.StringFixed(2)
+		if err := insertJournalEntry(ctx, tx, accountID, models.JournalEntryRepair, decimal.Zero, rebuilt, &reference); err != nil {
+			return err
+		}
+
+		repaired = true
+		return nil
+	})
+
+	return repaired, err
 }
 
 // DebitAccount debits an amount from the account (convenience method)
@@ -259,7 +359,7 @@ func (r *AccountRepository) CreditAccount(ctx context.Context, accountID uuid.UU
 // CreateHold creates a hold on funds
 func (r *AccountRepository) CreateHold(ctx context.Context, hold *models.AccountHold) error {
 	// Start transaction
-	tx, err := r.db.BeginTx(ctx, nil)
+	tx, err := begin(ctx, r.db)
 	if err != nil {
 		return err
 	}
@@ -316,7 +416,7 @@ func (r *AccountRepository) CreateHold(ctx context.Context, hold *models.Account
 // ReleaseHold releases a hold on funds
 func (r *AccountRepository) ReleaseHold(ctx context.Context, holdID uuid.UUID) error {
 	// Start transaction
-	tx, err := r.db.BeginTx(ctx, nil)
+	tx, err := begin(ctx, r.db)
 	if err != nil {
 		return err
 	}
@@ -369,7 +469,7 @@ func (r *AccountRepository) GetActiveHolds(ctx context.Context, accountID uuid.U
 		ORDER BY created_at DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, accountID)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, accountID)
 	if err != nil {
 		return nil, err
 	}
@@ -397,6 +497,56 @@ func (r *AccountRepository) GetActiveHolds(ctx context.Context, accountID uuid.U
 	return holds, nil
 }
 
+// NextEventSequence increments and returns the account's event sequence. The
+// row lock it takes orders concurrent events for the same account.
+func (r *AccountRepository) NextEventSequence(ctx context.Context, accountID uuid.UUID) (int64, error) {
+	query := `
+		UPDATE accounts
+		SET event_sequence = event_sequence + 1
+		WHERE id = $1
+		RETURNING event_sequence
+	`
+
+	var seq int64
+	err := r.conn(ctx).QueryRowContext(ctx, query, accountID).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, ErrAccountNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+// GetActiveHoldIDsByTransactionRef retrieves the IDs of unreleased holds
+// placed for a transaction
+func (r *AccountRepository) GetActiveHoldIDsByTransactionRef(ctx context.Context, transactionRef string) ([]uuid.UUID, error) {
+	query := `
+		SELECT id
+		FROM account_holds
+		WHERE transaction_ref = $1 AND released_at IS NULL
+		ORDER BY created_at
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, transactionRef)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
 // GetHoldByID retrieves a hold by ID
 func (r *AccountRepository) GetHoldByID(ctx context.Context, holdID uuid.UUID) (*models.AccountHold, error) {
 	query := `
@@ -406,7 +556,7 @@ func (r *AccountRepository) GetHoldByID(ctx context.Context, holdID uuid.UUID) (
 	`
 
 	hold := &models.AccountHold{}
-	err := r.db.QueryRowContext(ctx, query, holdID).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, query, holdID).Scan(
 		&hold.ID,
 		&hold.AccountID,
 		&hold.Amount,
@@ -426,3 +576,181 @@ func (r *AccountRepository) GetHoldByID(ctx context.Context, holdID uuid.UUID) (
 
 	return hold, nil
 }
+
+// CloseAccount posts final accrued interest, sweeps the remaining balance to the
+// settlement account and marks the account closed in a single transaction.
+// Accounts left with a negative balance are not closed, as the debt would be
+// lost.
+func (r *AccountRepository) CloseAccount(ctx context.Context, accountID uuid.UUID, settlementAccountID *uuid.UUID) (*models.AccountClosure, error) {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock both rows in a stable order so concurrent sweeps cannot deadlock
+	ids := []uuid.UUID{accountID}
+	if settlementAccountID != nil {
+		ids = append(ids, *settlementAccountID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+
+	locked := make(map[uuid.UUID]*lockedAccount, len(ids))
+	for _, id := range ids {
+		acc, err := lockAccount(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		locked[id] = acc
+	}
+
+	acc := locked[accountID]
+	if acc.Status == models.AccountStatusClosed {
+		return nil, ErrAccountClosed
+	}
+
+	// Check for active holds
+	var activeHolds int
+	err = tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM account_holds WHERE account_id = $1 AND released_at IS NULL",
+		accountID,
+	).Scan(&activeHolds)
+	if err != nil {
+		return nil, err
+	}
+	if activeHolds > 0 {
+		return nil, ErrActiveHolds
+	}
+
+	now := time.Now()
+	interest := accruedInterest(acc.Balance, acc.InterestRate, acc.AccruedSince, now)
+	remaining := acc.Balance.Add(interest)
+	if remaining.IsNegative() {
+		return nil, ErrNegativeBalance
+	}
+
+	if interest.IsPositive() {
+		err = insertJournalEntry(ctx, tx, accountID, models.JournalEntryInterest, interest, remaining, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if remaining.IsPositive() {
+		if settlementAccountID == nil {
+			return nil, ErrSettlementRequired
+		}
+
+		settlement := locked[*settlementAccountID]
+		if settlement.Status != models.AccountStatusActive {
+			return nil, ErrSettlementNotActive
+		}
+		if settlement.Currency != acc.Currency {
+			return nil, ErrCurrencyMismatch
+		}
+
+		var settlementBalance decimal.Decimal
+		err = tx.QueryRowContext(ctx,
+			"UPDATE accounts SET balance = balance + $1, available_balance = available_balance + $1, updated_at = $2 WHERE id = $3 RETURNING balance",
+			remaining, now, *settlementAccountID,
+		).Scan(&settlementBalance)
+		if err != nil {
+			return nil, err
+		}
+
+		// Journal both legs of the sweep, each referencing the other account
+		closedRef, settlementRef := accountID.String(), settlementAccountID.String()
+		err = insertJournalEntry(ctx, tx, accountID, models.JournalEntryClosureSweep, remaining.Neg(), decimal.Zero, &settlementRef)
+		if err != nil {
+			return nil, err
+		}
+		err = insertJournalEntry(ctx, tx, *settlementAccountID, models.JournalEntryClosureSweep, remaining, settlementBalance, &closedRef)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+		UPDATE accounts
+		SET balance = 0, available_balance = 0, status = $1,
+		    closed_at = $2, interest_accrued_at = $2, updated_at = $2
+		WHERE id = $3
+	`
+
+	_, err = tx.ExecContext(ctx, query, models.AccountStatusClosed, now, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	closure := &models.AccountClosure{
+		AccountID:      accountID,
+		InterestPosted: interest,
+		AmountSwept:    remaining,
+		Currency:       acc.Currency,
+		ClosedAt:       now,
+	}
+	if remaining.IsPositive() {
+		closure.SettlementAccountID = settlementAccountID
+	}
+
+	return closure, nil
+}
+
+// lockedAccount holds the fields of an account row locked for closure
+type lockedAccount struct {
+	Currency     string
+	Balance      decimal.Decimal
+	Status       models.AccountStatus
+	InterestRate decimal.Decimal
+	AccruedSince time.Time
+}
+
+func lockAccount(ctx context.Context, tx dbtx, id uuid.UUID) (*lockedAccount, error) {
+	query := `
+		SELECT currency, balance, status, interest_rate,
+		       COALESCE(interest_accrued_at, opened_at)
+		FROM accounts
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	acc := &lockedAccount{}
+	err := tx.QueryRowContext(ctx, query, id).Scan(
+		&acc.Currency,
+		&acc.Balance,
+		&acc.Status,
+		&acc.InterestRate,
+		&acc.AccruedSince,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return acc, nil
+}
+
+// accruedInterest calculates simple daily interest on a positive balance,
+// rounded to the currency's minor unit
+func accruedInterest(balance, annualRate decimal.Decimal, since, until time.Time) decimal.Decimal {
+	if !balance.IsPositive() || !annualRate.IsPositive() {
+		return decimal.Zero
+	}
+
+	days := int64(until.Sub(since).Hours() / 24)
+	if days <= 0 {
+		return decimal.Zero
+	}
+
+	return balance.Mul(annualRate).
+		Mul(decimal.NewFromInt(days)).
+		Div(decimal.NewFromInt(365)).
+		Round(2)
+}
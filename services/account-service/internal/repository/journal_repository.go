@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// JournalRepository reads the balance journal and maintains the shadow
+// balances rebuilt from it
+type JournalRepository struct {
+	db *sql.DB
+}
+
+func NewJournalRepository(db *sql.DB) *JournalRepository {
+	return &JournalRepository{
+		db: db,
+	}
+}
+
+// insertJournalEntry records a balance change. Callers run it in the same
+// transaction as the change itself.
+func insertJournalEntry(ctx context.Context, tx dbtx, accountID uuid.UUID, entryType models.JournalEntryType, amount, balanceAfter decimal.Decimal, reference *string) error {
+	query := `
+		INSERT INTO journal_entries (id, account_id, entry_type, amount, balance_after, reference, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := tx.ExecContext(ctx, query,
+		uuid.New(),
+		accountID,
+		entryType,
+		amount,
+		balanceAfter,
+		reference,
+		time.Now(),
+	)
+
+	return err
+}
+
+// StreamEntries calls fn for every journal entry, grouped by account and in
+// the order the entries were written
+func (r *JournalRepository) StreamEntries(ctx context.Context, fn func(entry *models.JournalEntry) error) error {
+	query := `
+		SELECT id, position, account_id, entry_type, amount, balance_after, reference, created_at
+		FROM journal_entries
+		ORDER BY account_id, position
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := &models.JournalEntry{}
+		err := rows.Scan(
+			&entry.ID,
+			&entry.Position,
+			&entry.AccountID,
+			&entry.EntryType,
+			&entry.Amount,
+			&entry.BalanceAfter,
+			&entry.Reference,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetAccountIDs retrieves the IDs of all accounts
+func (r *JournalRepository) GetAccountIDs(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, "SELECT id FROM accounts ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetActiveHoldTotals retrieves the total of unreleased holds per account
+func (r *JournalRepository) GetActiveHoldTotals(ctx context.Context) (map[uuid.UUID]decimal.Decimal, error) {
+	query := `
+		SELECT account_id, SUM(amount)
+		FROM account_holds
+		WHERE released_at IS NULL
+		GROUP BY account_id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := map[uuid.UUID]decimal.Decimal{}
+	for rows.Next() {
+		var id uuid.UUID
+		var total decimal.Decimal
+		if err := rows.Scan(&id, &total); err != nil {
+			return nil, err
+		}
+		totals[id] = total
+	}
+
+	return totals, rows.Err()
+}
+
+// ReplaceShadowBalances replaces the contents of the shadow table
+func (r *JournalRepository) ReplaceShadowBalances(ctx context.Context, snapshots []*models.BalanceSnapshot) error {
+	return withTx(ctx, r.db, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM account_balances_shadow"); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO account_balances_shadow (account_id, balance, available_balance, rebuilt_at)
+			VALUES ($1, $2, $3, $4)
+		`
+
+		now := time.Now()
+		for _, snapshot := range snapshots {
+			_, err := tx.ExecContext(ctx, query,
+				snapshot.AccountID,
+				snapshot.Balance,
+				snapshot.AvailableBalance,
+				now,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetDiscrepancies compares live balances with the shadow table
+func (r *JournalRepository) GetDiscrepancies(ctx context.Context) ([]*models.BalanceDiscrepancy, error) {
+	query := `
+		SELECT a.id, a.balance, a.available_balance, s.balance, s.available_balance
+		FROM accounts a
+		JOIN account_balances_shadow s ON s.account_id = a.id
+		WHERE a.balance <> s.balance OR a.available_balance <> s.available_balance
+		ORDER BY a.id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	discrepancies := []*models.BalanceDiscrepancy{}
+	for rows.Next() {
+		d := &models.BalanceDiscrepancy{}
+		err := rows.Scan(
+			&d.AccountID,
+			&d.LiveBalance,
+			&d.LiveAvailable,
+			&d.RebuiltBalance,
+			&d.RebuiltAvailable,
+		)
+		if err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, d)
+	}
+
+	return discrepancies, rows.Err()
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/models"
+	"github.com/google/uuid"
+)
+
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{
+		db: db,
+	}
+}
+
+// WithTx runs fn in a single database transaction
+func (r *OutboxRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withTx(ctx, r.db, fn)
+}
+
+// CreateEvent records an event in the outbox, joining the transaction carried
+// on ctx so the event commits or rolls back with the state change
+func (r *OutboxRepository) CreateEvent(ctx context.Context, event *models.OutboxEvent) error {
+	query := `
+		INSERT INTO outbox_events (id, aggregate_id, event_type, payload, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+	`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		event.ID,
+		event.AggregateID,
+		event.EventType,
+		event.Payload,
+		event.CreatedAt,
+	)
+
+	return err
+}
+
+// relayLockKey identifies the advisory lock held by the publishing relay
+const relayLockKey = "outbox_relay"
+
+// RelayLock is the session advisory lock that makes one relay the only one
+// publishing, so events leave in order however many replicas run
+type RelayLock struct {
+	conn *sql.Conn
+}
+
+// TryRelayLock takes the relay lock, returning nil if another relay holds it
+func (r *OutboxRepository) TryRelayLock(ctx context.Context) (*RelayLock, error) {
+	c, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked bool
+	err = c.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", relayLockKey).Scan(&locked)
+	if err != nil || !locked {
+		c.Close()
+		return nil, err
+	}
+
+	return &RelayLock{conn: c}, nil
+}
+
+// Held reports whether the lock's session is still alive. The server drops
+// the lock with the session, after which another relay may take it.
+func (l *RelayLock) Held(ctx context.Context) bool {
+	return l.conn.PingContext(ctx) == nil
+}
+
+// Release gives up the lock
+func (l *RelayLock) Release() {
+	l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", relayLockKey)
+	l.conn.Close()
+}
+
+// GetPendingEvents returns the oldest unsent events that are due, leaving
+// out every event of an aggregate with an earlier event still backing off,
+// so one stuck event holds back only its own aggregate. Callers must hold
+// the RelayLock.
+func (r *OutboxRepository) GetPendingEvents(ctx context.Context, limit int) ([]*models.OutboxEvent, error) {
+	query := `
+		SELECT id, aggregate_id, event_type, payload, attempts, last_error,
+		       next_attempt_at, sent_at, created_at
+		FROM outbox_events e
+		WHERE sent_at IS NULL
+		  AND NOT EXISTS (
+		      SELECT 1 FROM outbox_events b
+		      WHERE b.aggregate_id = e.aggregate_id
+		        AND b.sent_at IS NULL
+		        AND b.position <= e.position
+		        AND b.next_attempt_at > $2
+		  )
+		ORDER BY position
+		LIMIT $1
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, limit, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*models.OutboxEvent{}
+	for rows.Next() {
+		event := &models.OutboxEvent{}
+		err := rows.Scan(
+			&event.ID,
+			&event.AggregateID,
+			&event.EventType,
+			&event.Payload,
+			&event.Attempts,
+			&event.LastError,
+			&event.NextAttemptAt,
+			&event.SentAt,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// MarkSent marks an event as delivered
+func (r *OutboxRepository) MarkSent(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE outbox_events
+		SET sent_at = $1, attempts = attempts + 1, last_error = NULL
+		WHERE id = $2
+	`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now(), id)
+	return err
+}
+
+// MarkFailed records a failed delivery attempt and when to retry
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	query := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2
+		WHERE id = $3
+	`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, lastError, nextAttemptAt, id)
+	return err
+}
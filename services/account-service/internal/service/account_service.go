@@ -2,11 +2,12 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
-	"github.com/Caesarsage/bankflow/account-service/internal/kafka"
+	"github.com/Caesarsage/bankflow/account-service/internal/events"
 	"github.com/Caesarsage/bankflow/account-service/internal/models"
 	"github.com/Caesarsage/bankflow/account-service/internal/repository"
 	"github.com/Caesarsage/bankflow/account-service/pkg/account"
@@ -16,19 +17,20 @@ import (
 
 var (
 	ErrInvalidAccountType = errors.New("Invalid account type")
-	ErrAccountNotActive   = errors.New("account is not active")
-	ErrCannotCloseAccount = errors.New("cannot close account with non-zero balance")
+	ErrAccountNotActive   = repository.ErrAccountNotActive
+	ErrInvalidSettlement  = errors.New("settlement account must differ from the account being closed")
+	ErrStatusClosed       = errors.New("accounts can only be closed by closing them, not by setting their status")
 )
 
 type AccountService struct {
-	repo     *repository.AccountRepository
-	producer *kafka.Producer
+	repo   *repository.AccountRepository
+	outbox *repository.OutboxRepository
 }
 
-func NewAccountService(repository *repository.AccountRepository, producer *kafka.Producer) *AccountService {
+func NewAccountService(repository *repository.AccountRepository, outbox *repository.OutboxRepository) *AccountService {
 	return &AccountService{
-		repo:     repository,
-		producer: producer,
+		repo:   repository,
+		outbox: outbox,
 	}
 }
 
@@ -75,14 +77,17 @@ func (s *AccountService) CreateAccount(ctx context.Context, req *models.CreateAc
 		UpdatedAt:        now,
 	}
 
-	// Save to database
-	if err := s.repo.CreateAccount(ctx, acc); err != nil {
+	// Save to database together with the account created event
+	err = s.repo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.CreateAccount(ctx, acc); err != nil {
+			return err
+		}
+		return s.publishAccountCreated(ctx, acc)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	// Publish account created event
-	s.publishAccountCreated(acc)
-
 	return acc, nil
 }
 
@@ -99,8 +104,13 @@ func (s *AccountService) GetAccountsByCustomerID(ctx context.Context, customerID
 	return s.repo.GetAccountsByCustomerID(ctx, customerID)
 }
 
-// UpdateAccount updates account details
+// UpdateAccount updates account details. It cannot close an account, as
+// closing posts interest and sweeps the balance; see CloseAccount.
 func (s *AccountService) UpdateAccount(ctx context.Context, id uuid.UUID, req *models.UpdateAccountRequest) (*models.Account, error) {
+	if req.Status != nil && *req.Status == models.AccountStatusClosed {
+		return nil, ErrStatusClosed
+	}
+
 	// Get existing account
 	acc, err := s.repo.GetAccountByID(ctx, id)
 	if err != nil {
@@ -143,12 +153,12 @@ func (s *AccountService) FreezeAccount(ctx context.Context, id uuid.UUID) error
 	acc.Status = models.AccountStatusFrozen
 	acc.UpdatedAt = time.Now()
 
-	if err := s.repo.UpdateAccount(ctx, acc); err != nil {
-		return err
-	}
-
-	s.publishAccountFrozen(acc)
-	return nil
+	return s.repo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.UpdateAccount(ctx, acc); err != nil {
+			return err
+		}
+		return s.publishAccountFrozen(ctx, acc)
+	})
 }
 
 // UnfreezeAccount unfreezes an account
@@ -172,34 +182,40 @@ func (s *AccountService) UnfreezeAccount(ctx context.Context, id uuid.UUID) erro
 	return nil
 }
 
-// CloseAccount closes an account
-func (s *AccountService) CloseAccount(ctx context.Context, id uuid.UUID) error {
-	acc, err := s.repo.GetAccountByID(ctx, id)
-	if err != nil {
-		return err
+// CloseAccount posts final interest, sweeps the remaining balance to the
+// settlement account and closes the account
+func (s *AccountService) CloseAccount(ctx context.Context, id uuid.UUID, req *models.CloseAccountRequest) (*models.AccountClosure, error) {
+	if req.SettlementAccountID != nil && *req.SettlementAccountID == id {
+		return nil, ErrInvalidSettlement
 	}
 
-	// Cannot close account with non-zero balance
-	if !acc.Balance.IsZero() {
-		return ErrCannotCloseAccount
-	}
+	var closure *models.AccountClosure
+	err := s.repo.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		closure, err = s.repo.CloseAccount(ctx, id, req.SettlementAccountID)
+		if err != nil {
+			return err
+		}
 
-	// Cannot close already closed account
-	if acc.Status == models.AccountStatusClosed {
-		return errors.New("account is already closed")
-	}
+		if err := s.publishAccountClosed(ctx, closure); err != nil {
+			return err
+		}
 
-	acc.Status = models.AccountStatusClosed
-	now := time.Now()
-	acc.ClosedAt = &now
-	acc.UpdatedAt = now
+		if closure.SettlementAccountID == nil {
+			return nil
+		}
 
-	if err := s.repo.UpdateAccount(ctx, acc); err != nil {
-		return err
+		settlement, err := s.repo.GetAccountByID(ctx, *closure.SettlementAccountID)
+		if err != nil {
+			return err
+		}
+		return s.publishBalanceUpdated(ctx, settlement)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	s.publishAccountClosed(acc)
-	return nil
+	return closure, nil
 }
 
 // GetBalance gets account balance
@@ -252,30 +268,45 @@ func (s *AccountService) ReleaseHold(ctx context.Context, holdID uuid.UUID) erro
 
 // UpdateBalance updates account balance (called by transaction service)
 func (s *AccountService) UpdateBalance(ctx context.Context, accountID uuid.UUID, amount decimal.Decimal) error {
-	// Get account first to check status
-	acc, err := s.repo.GetAccountByID(ctx, accountID)
-	if err != nil {
-		return err
-	}
+	return s.repo.WithTx(ctx, func(ctx context.Context) error {
+		// Update balance
+		if err := s.repo.UpdateBalance(ctx, accountID, amount); err != nil {
+			return err
+		}
 
-	if acc.Status != models.AccountStatusActive {
-		return ErrAccountNotActive
-	}
+		// Get updated account
+		updatedAcc, err := s.repo.GetAccountByID(ctx, accountID)
+		if err != nil {
+			return err
+		}
 
-	// Update balance
-	if err := s.repo.UpdateBalance(ctx, accountID, amount); err != nil {
-		return err
-	}
+		// Record balance updated event
+		return s.publishBalanceUpdated(ctx, updatedAcc)
+	})
+}
 
-	// Get updated account
-	updatedAcc, err := s.repo.GetAccountByID(ctx, accountID)
-	if err != nil {
-		return err
-	}
+// RepairBalance resets account balances to the values rebuilt from the
+// journal and publishes the corrected balances. liveBalance and liveAvailable
+// are the balances the rebuild found wrong; if the account has changed since,
+// it returns repository.ErrBalanceChanged and leaves it alone.
+func (s *AccountService) RepairBalance(ctx context.Context, accountID uuid.UUID, liveBalance, liveAvailable decimal.Decimal) (bool, error) {
+	repaired := false
+	err := s.repo.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		repaired, err = s.repo.RepairBalances(ctx, accountID, liveBalance, liveAvailable)
+		if err != nil || !repaired {
+			return err
+		}
 
-	// Publish balance updated event
-	s.publishBalanceUpdated(updatedAcc)
-	return nil
+		acc, err := s.repo.GetAccountByID(ctx, accountID)
+		if err != nil {
+			return err
+		}
+
+		return s.publishBalanceUpdated(ctx, acc)
+	})
+
+	return repaired, err
 }
 
 // DebitAccount debits amount from account (used for transfers)
@@ -331,73 +362,67 @@ func (s *AccountService) ValidateAccountOwnership(ctx context.Context, accountID
 	return acc.CustomerID == customerID, nil
 }
 
-// Event publishing methods
-func (s *AccountService) publishAccountCreated(acc *models.Account) {
-
-	event := &kafka.Event{
-		EventID:   uuid.NewString(),
-		EventType: "account.created",
-		AccountID: acc.ID,
-		Data: map[string]interface{}{
-			"customer_id":    acc.CustomerID.String(),
-			"account_number": acc.AccountNumber,
-			"account_type":   acc.AccountType,
-			"currency":       acc.Currency,
-		},
-		Timestamp: time.Now(),
-	}
-
-	go func() {
-		if err := s.producer.PublishEvent(context.Background(), event); err != nil {
-			// Log error but don't fail the operation
-			// In production, use proper logging
-			println("Failed to publish account.created event:", err.Error())
-		}
+// Event publishing methods. Events are written to the outbox in the caller's
+// transaction and relayed to Kafka by outbox.Relay.
+func (s *AccountService) publishAccountCreated(ctx context.Context, acc *models.Account) error {
+	return s.enqueue(ctx, acc.ID, events.TypeAccountCreated, &events.AccountCreated{
+		AccountID:     acc.ID,
+		CustomerID:    acc.CustomerID,
+		AccountNumber: acc.AccountNumber,
+		AccountType:   string(acc.AccountType),
+		Currency:      acc.Currency,
+	})
+}
 
-	}()
+func (s *AccountService) publishBalanceUpdated(ctx context.Context, acc *models.Account) error {
+	return s.enqueue(ctx, acc.ID, events.TypeAccountBalanceUpdated, &events.AccountBalanceUpdated{
+		AccountID:        acc.ID,
+		Balance:          acc.Balance,
+		AvailableBalance: acc.AvailableBalance,
+	})
 }
 
-func (s *AccountService) publishBalanceUpdated(acc *models.Account) {
-	event := &kafka.Event{
-		EventID:   uuid.NewString(),
-		EventType: "account.balance.updated",
+func (s *AccountService) publishAccountFrozen(ctx context.Context, acc *models.Account) error {
+	return s.enqueue(ctx, acc.ID, events.TypeAccountFrozen, &events.AccountFrozen{
 		AccountID: acc.ID,
-		Data: map[string]interface{}{
-			"balance":           acc.Balance.String(),
-			"available_balance": acc.AvailableBalance.String(),
-		},
-		Timestamp: time.Now(),
-	}
+		FrozenAt:  acc.UpdatedAt,
+	})
+}
 
-	go func() {
-		if err := s.producer.PublishEvent(context.Background(), event); err != nil {
-			println("Failed to publish account.balance.updated event:", err.Error())
-		}
-	}()
+func (s *AccountService) publishAccountClosed(ctx context.Context, closure *models.AccountClosure) error {
+	return s.enqueue(ctx, closure.AccountID, events.TypeAccountClosed, &events.AccountClosed{
+		AccountID:           closure.AccountID,
+		SettlementAccountID: closure.SettlementAccountID,
+		InterestPosted:      closure.InterestPosted,
+		AmountSwept:         closure.AmountSwept,
+		Currency:            closure.Currency,
+		ClosedAt:            closure.ClosedAt,
+	})
 }
 
-func (s *AccountService) publishAccountFrozen(acc *models.Account) {
-	event := &kafka.Event{
-		EventType: "account.frozen",
-		AccountID: acc.ID,
-		Timestamp: time.Now(),
+// enqueue wraps data in an event envelope stamped with the account's next
+// sequence number and records it in the outbox. It must run inside WithTx.
+func (s *AccountService) enqueue(ctx context.Context, accountID uuid.UUID, eventType string, data interface{}) error {
+	event, err := events.New(eventType, accountID.String(), data)
+	if err != nil {
+		return err
 	}
-	go func() {
-		if err := s.producer.PublishEvent(context.Background(), event); err != nil {
-			println("Failed to publish account.frozen event:", err.Error())
-		}
-	}()
-}
 
-func (s *AccountService) publishAccountClosed(acc *models.Account) {
-	event := &kafka.Event{
-		EventID:   uuid.NewString(),
-		AccountID: acc.ID,
-		Timestamp: time.Now(),
+	event.Sequence, err = s.repo.NextEventSequence(ctx, accountID)
+	if err != nil {
+		return err
 	}
-	go func() {
-		if err := s.producer.PublishEvent(context.Background(), event); err != nil {
-			println("Failed to publish account.closed event:", err.Error())
-		}
-	}()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return s.outbox.CreateEvent(ctx, &models.OutboxEvent{
+		ID:          uuid.New(),
+		AggregateID: accountID,
+		EventType:   eventType,
+		Payload:     payload,
+		CreatedAt:   time.Now(),
+	})
 }
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/Caesarsage/bankflow/account-service/internal/events"
+	"github.com/Caesarsage/bankflow/account-service/internal/kafka"
+	"github.com/Caesarsage/bankflow/account-service/internal/repository"
+)
+
+// RegisterTransactionHandlers routes transaction-events to the service
+func (s *AccountService) RegisterTransactionHandlers(router *kafka.Router) {
+	kafka.Handle(router, events.TypeTransactionCompleted, s.HandleTransactionSettled)
+	kafka.Handle(router, events.TypeTransactionFailed, s.HandleTransactionSettled)
+	kafka.Handle(router, events.TypeTransactionReversed, s.HandleTransactionSettled)
+}
+
+// HandleTransactionSettled releases any holds still placed for a transaction
+// once it has completed, failed or been reversed. Redelivered events find no
+// active holds, so handling is idempotent.
+func (s *AccountService) HandleTransactionSettled(ctx context.Context, event *events.Envelope, txn *events.TransactionEvent) error {
+	if txn.TransactionRef == "" {
+		return kafka.Permanent(errors.New("transaction event has no transaction_ref"))
+	}
+
+	holdIDs, err := s.repo.GetActiveHoldIDsByTransactionRef(ctx, txn.TransactionRef)
+	if err != nil {
+		return err
+	}
+
+	for _, holdID := range holdIDs {
+		err := s.repo.ReleaseHold(ctx, holdID)
+		if err != nil && err != repository.ErrHoldNotFound {
+			return err
+		}
+	}
+
+	if len(holdIDs) > 0 {
+		log.Printf("Released %d hold(s) for transaction %s (%s)", len(holdIDs), txn.TransactionRef, event.Type)
+	}
+	return nil
+}
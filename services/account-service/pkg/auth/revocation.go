@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// maxCacheEntries bounds the cache; it is cleared when it grows past this
+const maxCacheEntries = 100000
+
+type cachedCheck struct {
+	revoked   bool
+	fetchedAt time.Time
+}
+
+// RevocationChecker rejects access tokens that identity-service has revoked
+// by jti or sid, or issued before the user's valid-after time. It reads the
+// keys identity-service writes to Redis with REVOCATION_STORE=redis, and
+// caches each token's result for ttl, so a revoked token may be accepted for
+// up to that long.
+type RevocationChecker struct {
+	client *redis.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedCheck
+}
+
+func NewRevocationChecker(client *redis.Client, ttl time.Duration) *RevocationChecker {
+	return &RevocationChecker{
+		client: client,
+		ttl:    ttl,
+		cache:  map[string]cachedCheck{},
+	}
+}
+
+// CheckAccessToken returns ErrTokenRevoked if a validated token has been
+// revoked, or another error if that cannot be told
+func (c *RevocationChecker) CheckAccessToken(ctx context.Context, claims *Claims) error {
+	cacheKey := claims.ID + "|" + claims.SessionID + "|" + claims.UserID
+
+	c.mu.Lock()
+	entry, ok := c.cache[cacheKey]
+	c.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < c.ttl {
+		if entry.revoked {
+			return ErrTokenRevoked
+		}
+		return nil
+	}
+
+	revoked, err := c.lookup(ctx, claims)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if len(c.cache) >= maxCacheEntries {
+		c.cache = map[string]cachedCheck{}
+	}
+	c.cache[cacheKey] = cachedCheck{revoked: revoked, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// lookup reads the token's revocations and its user's valid-after time in
+// one round trip. The key names must match identity-service's RedisStore.
+func (c *RevocationChecker) lookup(ctx context.Context, claims *Claims) (bool, error) {
+	// Unset claims get keys that never exist
+	values, err := c.client.MGet(ctx,
+		"revoked:jti:"+claims.ID,
+		"revoked:sid:"+claims.SessionID,
+		"tokens_valid_after:"+claims.UserID,
+	).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if claims.ID != "" && values[0] != nil {
+		return true, nil
+	}
+	if claims.SessionID != "" && values[1] != nil {
+		return true, nil
+	}
+
+	// OAuth client tokens have no user, and are revoked by their sid
+	if claims.UserID == "" || values[2] == nil {
+		return false, nil
+	}
+
+	value, _ := values[2].(string)
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	// iat has whole second precision, as does the valid-after time
+	return claims.IssuedAt == nil || claims.IssuedAt.Time.Before(time.Unix(unix, 0)), nil
+}
@@ -2,27 +2,42 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/Caesarsage/bankflow/identity-service/internal/cleanup"
+	"github.com/Caesarsage/bankflow/identity-service/internal/geoip"
 	"github.com/Caesarsage/bankflow/identity-service/internal/handlers"
 	"github.com/Caesarsage/bankflow/identity-service/internal/kafka"
 	"github.com/Caesarsage/bankflow/identity-service/internal/middleware"
+	"github.com/Caesarsage/bankflow/identity-service/internal/outbox"
+	"github.com/Caesarsage/bankflow/identity-service/internal/password"
+	"github.com/Caesarsage/bankflow/identity-service/internal/ratelimit"
 	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+	"github.com/Caesarsage/bankflow/identity-service/internal/revocation"
 	"github.com/Caesarsage/bankflow/identity-service/internal/service"
 	"github.com/Caesarsage/bankflow/identity-service/pkg/jwt"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/secretbox"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
 )
 
+// devMFAKeySeed derives the MFA encryption key used in development when
+// MFA_ENCRYPTION_KEY is not set
+const devMFAKeySeed = "bankflow-development-mfa-key"
+
 func main() {
 	// Load environment variables
 	_ = godotenv.Load()
@@ -33,9 +48,35 @@ func main() {
 	dbUser := getEnv("DB_USER", "bankflow")
 	dbPassword := getEnv("DB_PASSWORD", "bankflow123")
 	dbName := getEnv("DB_NAME", "identity_db")
-	jwtSecret := getEnv("JWT_SECRET", "your-secret-key")
+	env := getEnv("ENV", "development")
+	jwtKeysDir := getEnv("JWT_KEYS_DIR", "")
+	jwtActiveKid := getEnv("JWT_ACTIVE_KID", "")
 	jwtExpiry := getEnv("JWT_EXPIRY", "15m")
 	refreshExpiry := getEnv("REFRESH_TOKEN_EXPIRY", "168h")
+	loginVerification := getEnv("LOGIN_REQUIRE_VERIFIED", "none")
+	mfaKey := getEnv("MFA_ENCRYPTION_KEY", "")
+	bootstrapAdmin := getEnv("BOOTSTRAP_ADMIN_EMAIL", "")
+	oidcIssuer := getEnv("OIDC_ISSUER", "http://localhost:"+port)
+	// Sign-in page that GET /oauth/authorize sends browsers to
+	oidcLoginURL := getEnv("OIDC_LOGIN_URL", "")
+	passwordMinLength := getEnv("PASSWORD_MIN_LENGTH", "8")
+	passwordRequire := getEnv("PASSWORD_REQUIRE", "")
+	passwordHistory := getEnv("PASSWORD_HISTORY", "5")
+	breachedPasswordsFile := getEnv("BREACHED_PASSWORDS_FILE", "")
+	breachedPasswordsMinCount := getEnv("BREACHED_PASSWORDS_MIN_COUNT", "1")
+	sessionCleanup := getEnv("SESSION_CLEANUP_INTERVAL", "1h")
+	revocationBackend := getEnv("REVOCATION_STORE", "postgres")
+	revocationCacheTTL := getEnv("REVOCATION_CACHE_TTL", "5s")
+	loginLimitBackend := getEnv("LOGIN_RATE_LIMIT_STORE", "memory")
+	trustedProxies := getEnv("TRUSTED_PROXIES", "")
+	geoIPFile := getEnv("GEOIP_DATABASE_FILE", "")
+	loginStepUp := getEnv("LOGIN_STEP_UP", "false")
+
+	// Redis configuration, used when REVOCATION_STORE or
+	// LOGIN_RATE_LIMIT_STORE is redis
+	redisHost := getEnv("REDIS_HOST", "localhost")
+	redisPort := getEnv("REDIS_PORT", "6379")
+	redisPassword := getEnv("REDIS_PASSWORD", "")
 
 	// Kafka configuration
 	kafkaBrokers := getEnv("KAFKA_BROKERS", "localhost:9092")
@@ -47,11 +88,101 @@ func main() {
 		log.Fatalf("Invalid JWT_EXPIRY: %v", err)
 	}
 
+	cleanupInterval, err := time.ParseDuration(sessionCleanup)
+	if err != nil {
+		log.Fatalf("Invalid SESSION_CLEANUP_INTERVAL: %v", err)
+	}
+
+	cacheTTL, err := time.ParseDuration(revocationCacheTTL)
+	if err != nil {
+		log.Fatalf("Invalid REVOCATION_CACHE_TTL: %v", err)
+	}
+
 	refreshDuration, err := time.ParseDuration(refreshExpiry)
 	if err != nil {
 		log.Fatalf("Invalid REFRESH_TOKEN_EXPIRY: %v", err)
 	}
 
+	// Load token signing keys. Every key in JWT_KEYS_DIR is published in the
+	// JWKS; tokens are signed with JWT_ACTIVE_KID, or the last key by name.
+	var signingKeys []*jwt.SigningKey
+	if jwtKeysDir != "" {
+		signingKeys, err = jwt.LoadKeyDir(jwtKeysDir)
+		if err != nil {
+			log.Fatalf("Failed to load JWT keys: %v", err)
+		}
+	} else if env == "development" {
+		log.Println("JWT_KEYS_DIR not set, generating an ephemeral signing key")
+		key, err := jwt.GenerateEd25519Key("dev-" + time.Now().UTC().Format("20060102T150405"))
+		if err != nil {
+			log.Fatalf("Failed to generate JWT key: %v", err)
+		}
+		signingKeys = []*jwt.SigningKey{key}
+	} else {
+		log.Fatal("JWT_KEYS_DIR is required outside development")
+	}
+
+	keySet, err := jwt.NewKeySet(signingKeys, jwtActiveKid)
+	if err != nil {
+		log.Fatalf("Invalid JWT keys: %v", err)
+	}
+
+	verificationPolicy, err := service.ParseLoginVerificationPolicy(loginVerification)
+	if err != nil {
+		log.Fatalf("Invalid LOGIN_REQUIRE_VERIFIED: %v", err)
+	}
+
+	// Password policy for registration and password changes
+	passwordPolicy := password.DefaultPolicy()
+	passwordPolicy.MinLength, err = strconv.Atoi(passwordMinLength)
+	if err != nil || passwordPolicy.MinLength < 1 || passwordPolicy.MinLength > password.MaxBytes {
+		log.Fatalf("Invalid PASSWORD_MIN_LENGTH: %q", passwordMinLength)
+	}
+
+	passwordPolicy.Require, err = password.ParseClasses(passwordRequire)
+	if err != nil {
+		log.Fatalf("Invalid PASSWORD_REQUIRE: %v", err)
+	}
+
+	passwordPolicy.History, err = strconv.Atoi(passwordHistory)
+	if err != nil || passwordPolicy.History < 0 {
+		log.Fatalf("Invalid PASSWORD_HISTORY: %q", passwordHistory)
+	}
+
+	// Breached passwords are checked against a local Pwned Passwords list
+	if breachedPasswordsFile != "" {
+		minCount, err := strconv.Atoi(breachedPasswordsMinCount)
+		if err != nil {
+			log.Fatalf("Invalid BREACHED_PASSWORDS_MIN_COUNT: %q", breachedPasswordsMinCount)
+		}
+
+		passwordPolicy.Breached, err = password.LoadBreachedList(breachedPasswordsFile, minCount)
+		if err != nil {
+			log.Fatalf("Failed to load breached passwords: %v", err)
+		}
+		log.Printf("Loaded %d breached password hashes", passwordPolicy.Breached.Len())
+	}
+
+	// MFA secrets are encrypted at rest with a 32-byte base64 key
+	var mfaKeyBytes []byte
+	if mfaKey != "" {
+		mfaKeyBytes, err = base64.StdEncoding.DecodeString(mfaKey)
+		if err != nil {
+			log.Fatalf("Invalid MFA_ENCRYPTION_KEY: %v", err)
+		}
+	} else if env == "development" {
+		log.Println("MFA_ENCRYPTION_KEY not set, using the development MFA key")
+		sum := sha256.Sum256([]byte(devMFAKeySeed))
+		mfaKeyBytes = sum[:]
+	} else {
+		log.Fatal("MFA_ENCRYPTION_KEY is required outside development")
+	}
+
+	secrets, err := secretbox.New(mfaKeyBytes)
+	if err != nil {
+		log.Fatalf("Invalid MFA_ENCRYPTION_KEY: %v", err)
+	}
+
 	// Connect to database
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", dbHost, dbPort, dbUser, dbPassword, dbName)
 
@@ -72,25 +203,172 @@ func main() {
 	defer kafkaProducer.Close()
 	log.Println("Connected to Kafka")
 
+	var redisClient *redis.Client
+	if revocationBackend == "redis" || loginLimitBackend == "redis" {
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:     redisHost + ":" + redisPort,
+			Password: redisPassword,
+		})
+		defer redisClient.Close()
+
+		if err := redisClient.Ping(context.Background()).Err(); err != nil {
+			log.Fatalf("Failed to ping Redis: %v", err)
+		}
+		log.Println("Connected to Redis")
+	}
+
+	// Revoked access tokens are kept in Postgres or Redis, with lookups
+	// cached in memory
+	var revocationStore revocation.Store
+	switch revocationBackend {
+	case "postgres":
+		revocationStore = repository.NewRevocationRepository(db)
+	case "redis":
+		revocationStore = revocation.NewRedisStore(redisClient, jwtDuration)
+	default:
+		log.Fatalf("Invalid REVOCATION_STORE: %q", revocationBackend)
+	}
+	revocations := revocation.NewCachedStore(revocationStore, cacheTTL)
+
+	// Failed logins are throttled by IP and email in memory, per instance,
+	// or in Redis, shared by every instance
+	var loginFailures ratelimit.Store
+	switch loginLimitBackend {
+	case "memory":
+		loginFailures = ratelimit.NewMemoryStore()
+	case "redis":
+		loginFailures = ratelimit.NewRedisStore(redisClient)
+	default:
+		log.Fatalf("Invalid LOGIN_RATE_LIMIT_STORE: %q", loginLimitBackend)
+	}
+
+	backoffBase := getEnvDuration("LOGIN_BACKOFF_BASE", "1s")
+	backoffMax := getEnvDuration("LOGIN_BACKOFF_MAX", "15m")
+	loginRule := func(thresholdKey string, fallback int) ratelimit.Rule {
+		return ratelimit.Rule{
+			Threshold: getEnvInt(thresholdKey, fallback),
+			BaseDelay: backoffBase,
+			MaxDelay:  backoffMax,
+		}
+	}
+	loginLimiter := ratelimit.NewLimiter(loginFailures, getEnvDuration("LOGIN_FAILURE_WINDOW", "15m"))
+	loginLimits := service.LoginLimits{
+		IP:      loginRule("LOGIN_IP_THRESHOLD", 20),
+		Email:   loginRule("LOGIN_EMAIL_THRESHOLD", 5),
+		IPEmail: loginRule("LOGIN_IP_EMAIL_THRESHOLD", 3),
+	}
+	lockoutPolicy := service.LockoutPolicy{
+		Threshold: getEnvInt("LOCKOUT_THRESHOLD", 5),
+		Duration:  getEnvDuration("LOCKOUT_DURATION", "30m"),
+	}
+
+	// Logins from new devices, impossible distances or unusual hours are
+	// reported and, with LOGIN_STEP_UP, need a second factor
+	loginRiskPolicy := service.LoginRiskPolicy{
+		MaxTravelSpeed:       float64(getEnvInt("LOGIN_MAX_TRAVEL_SPEED_KMH", 900)),
+		UnusualHourMinLogins: getEnvInt("LOGIN_UNUSUAL_HOUR_MIN_LOGINS", 10),
+	}
+	loginRiskPolicy.StepUp, err = strconv.ParseBool(loginStepUp)
+	if err != nil {
+		log.Fatalf("Invalid LOGIN_STEP_UP: %q", loginStepUp)
+	}
+
+	// Login locations come from a local GeoIP file, so no IP address is
+	// sent to a lookup service
+	var geoIP *geoip.Database
+	if geoIPFile != "" {
+		geoIP, err = geoip.Open(geoIPFile)
+		if err != nil {
+			log.Fatalf("Failed to load GeoIP database: %v", err)
+		}
+		log.Printf("Loaded %d GeoIP ranges", geoIP.Len())
+	}
+
 	// Initialize dependencies
-	jwtManager := jwt.NewJWTManager(jwtSecret, jwtDuration, refreshDuration)
+	jwtManager := jwt.NewJWTManager(keySet, jwtDuration, refreshDuration)
 	userRepo := repository.NewUserRepository(db)
-	authService := service.NewAuthService(userRepo, jwtManager, kafkaProducer)
+	outboxRepo := repository.NewOutboxRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+	roleRepo := repository.NewRoleRepository(db)
+	oauthRepo := repository.NewOAuthRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	authService := service.NewAuthService(userRepo, mfaRepo, roleRepo, oauthRepo, auditRepo, jwtManager, outboxRepo, secrets, revocations)
+	authService.SetLoginVerificationPolicy(verificationPolicy)
+	authService.SetPasswordPolicy(passwordPolicy)
+	authService.SetLoginLimiter(loginLimiter, loginLimits)
+	authService.SetLockoutPolicy(lockoutPolicy)
+	authService.SetLoginRiskPolicy(loginRiskPolicy)
+	authService.SetStepUpTokenDuration(getEnvDuration("STEP_UP_TOKEN_EXPIRY", "5m"))
+	if geoIP != nil {
+		authService.SetGeoIP(geoIP)
+	}
+	authService.SetOIDCIssuer(oidcIssuer)
+
+	// Give the first administrator the admin role; further roles are
+	// assigned through the admin API
+	if bootstrapAdmin != "" {
+		if err := authService.GrantRoleByEmail(context.Background(), bootstrapAdmin, service.RoleAdmin); err != nil {
+			log.Printf("Failed to grant admin role to %s: %v", bootstrapAdmin, err)
+		} else {
+			log.Printf("Granted admin role to %s", bootstrapAdmin)
+		}
+	}
 	authHandler := handlers.NewAuthHandler(authService)
 
+	// Relay outbox events to Kafka
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	relay := outbox.NewRelay(outboxRepo, kafkaProducer, time.Second, 100)
+	go relay.Run(workerCtx)
+
+	// Delete expired sessions on a schedule
+	cleaner := cleanup.NewSessionCleaner(userRepo, cleanupInterval)
+	go cleaner.Run(workerCtx)
+
+	revocationCleaner := cleanup.NewRevocationCleaner(revocations, cleanupInterval)
+	go revocationCleaner.Run(workerCtx)
+
+	codeCleaner := cleanup.NewAuthorizationCodeCleaner(oauthRepo, cleanupInterval)
+	go codeCleaner.Run(workerCtx)
+
 	// Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 
+	// Only trust X-Forwarded-For from known proxies, such as the Kong
+	// gateway, so clients cannot pick the IP that login throttling sees
+	var proxies []string
+	if trustedProxies != "" {
+		proxies = strings.Split(trustedProxies, ",")
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Middleware
 	router.Use(middleware.CORSMiddleware())
 
 	// Health check
 	router.GET("/health", authHandler.Health)
 
+	// Public signing keys for services that validate tokens
+	jwksHandler, err := handlers.JWKSHandler(keySet)
+	if err != nil {
+		log.Fatalf("Failed to build JWKS: %v", err)
+	}
+	router.GET("/.well-known/jwks.json", jwksHandler)
+
+	// OpenID Connect discovery
+	router.GET("/.well-known/openid-configuration", handlers.OpenIDConfigurationHandler(oidcIssuer, oidcLoginURL, keySet))
+
 	// API v1 routes
 	v1 := router.Group("/api/v1")
-	authHandler.RegisterRoutes(v1, jwtManager)
+	checker := revocation.NewChecker(revocations)
+	authHandler.RegisterRoutes(v1, jwtManager, checker, getEnvDuration("STEP_UP_MAX_AGE", "5m"))
+
+	// OAuth2 and OpenID Connect endpoints
+	authHandler.RegisterOAuthRoutes(router, jwtManager, checker, oidcLoginURL)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -101,9 +379,12 @@ func main() {
 	// Start server in goroutine
 	go func() {
 		log.Printf(" Identity Service starting on port %s", port)
-		log.Printf(" Environment: %s", getEnv("ENV", "development"))
+		log.Printf(" Environment: %s", env)
+		log.Printf(" Signing key: %s (%s)", keySet.Active().ID, keySet.Active().Method.Alg())
 		log.Printf(" Database: %s:%s/%s", dbHost, dbPort, dbName)
 		log.Printf(" Kafka: %s (topic: %s)", kafkaBrokers, kafkaTopic)
+		log.Printf(" Revocation store: %s", revocationBackend)
+		log.Printf(" Login rate limit store: %s", loginLimitBackend)
 
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
@@ -116,6 +397,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopWorkers()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -133,3 +415,21 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvInt reads a non-negative integer setting, exiting if it is invalid
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, strconv.Itoa(fallback)))
+	if err != nil || value < 0 {
+		log.Fatalf("Invalid %s: %q", key, os.Getenv(key))
+	}
+	return value
+}
+
+// getEnvDuration reads a duration setting, exiting if it is invalid
+func getEnvDuration(key, fallback string) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, fallback))
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return value
+}
@@ -0,0 +1,45 @@
+package cleanup
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+)
+
+// AuthorizationCodeCleaner periodically deletes expired OAuth authorization
+// codes. Redeemed codes are kept until they expire so a replay can still be
+// detected.
+type AuthorizationCodeCleaner struct {
+	repo     *repository.OAuthRepository
+	interval time.Duration
+}
+
+func NewAuthorizationCodeCleaner(repo *repository.OAuthRepository, interval time.Duration) *AuthorizationCodeCleaner {
+	return &AuthorizationCodeCleaner{
+		repo:     repo,
+		interval: interval,
+	}
+}
+
+// Run deletes expired codes every interval until ctx is cancelled
+func (c *AuthorizationCodeCleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := c.repo.DeleteExpiredAuthorizationCodes(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Authorization code cleanup failed: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d expired authorization codes", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package cleanup
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/revocation"
+)
+
+// RevocationCleaner periodically deletes revocations whose tokens have all
+// expired
+type RevocationCleaner struct {
+	store    revocation.Store
+	interval time.Duration
+}
+
+func NewRevocationCleaner(store revocation.Store, interval time.Duration) *RevocationCleaner {
+	return &RevocationCleaner{
+		store:    store,
+		interval: interval,
+	}
+}
+
+// Run purges expired revocations every interval until ctx is cancelled
+func (c *RevocationCleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := c.store.PurgeExpired(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Revocation cleanup failed: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d expired revocations", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package cleanup
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+)
+
+// SessionCleaner periodically deletes expired sessions. Rotated and revoked
+// sessions are kept until they expire so refresh token reuse can still be
+// detected.
+type SessionCleaner struct {
+	repo     *repository.UserRepository
+	interval time.Duration
+}
+
+func NewSessionCleaner(repo *repository.UserRepository, interval time.Duration) *SessionCleaner {
+	return &SessionCleaner{
+		repo:     repo,
+		interval: interval,
+	}
+}
+
+// Run deletes expired sessions every interval until ctx is cancelled
+func (c *SessionCleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := c.repo.DeleteExpiredSessions(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Session cleanup failed: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d expired sessions", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package events_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/events"
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/service"
+	"github.com/google/uuid"
+)
+
+// TestPayloadsMatchSchemas checks every payload identity-service produces
+// against its contract in proto/events/identity
+func TestPayloadsMatchSchemas(t *testing.T) {
+	phone := "+15555550100"
+	previousEmail := "old@example.com"
+	country, city, previousIP := "GB", "London", "203.0.113.9"
+	distance, speed := 5570.2, 11140.4
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		eventType string
+		data      interface{}
+	}{
+		{"registered without phone", events.TypeUserRegistered, events.UserRegistered{
+			UserID:    uuid.New(),
+			Email:     "user@example.com",
+			CreatedAt: now,
+		}},
+		{"registered with phone", events.TypeUserRegistered, events.UserRegistered{
+			UserID:     uuid.New(),
+			Email:      "user@example.com",
+			Phone:      &phone,
+			IsVerified: true,
+			CreatedAt:  now,
+		}},
+		{"logged in", events.TypeUserLoggedIn, events.UserLoggedIn{
+			UserID:    uuid.New(),
+			Email:     "user@example.com",
+			IPAddress: "198.51.100.7",
+			UserAgent: "curl/8.0",
+			LoginTime: now,
+		}},
+		{"password reset requested", events.TypeUserPasswordResetRequested, events.UserPasswordResetRequested{
+			UserID:      uuid.New(),
+			Email:       "user@example.com",
+			ResetToken:  "token",
+			ExpiresAt:   now.Add(time.Hour),
+			RequestedAt: now,
+		}},
+		{"email verification requested", events.TypeUserVerificationRequested, events.UserVerificationRequested{
+			UserID:      uuid.New(),
+			Channel:     string(models.VerificationChannelEmail),
+			Destination: "user@example.com",
+			Code:        "token",
+			ExpiresAt:   now.Add(time.Hour),
+		}},
+		{"phone verification requested", events.TypeUserVerificationRequested, events.UserVerificationRequested{
+			UserID:      uuid.New(),
+			Channel:     string(models.VerificationChannelPhone),
+			Destination: phone,
+			Code:        "123456",
+			ExpiresAt:   now.Add(10 * time.Minute),
+		}},
+		{"verified", events.TypeUserVerified, events.UserVerified{
+			UserID:      uuid.New(),
+			Channel:     string(models.VerificationChannelPhone),
+			Destination: phone,
+			VerifiedAt:  now,
+		}},
+		{"email updated", events.TypeUserUpdated, events.UserUpdated{
+			UserID:        uuid.New(),
+			Email:         "new@example.com",
+			ChangedFields: []string{"email"},
+			PreviousEmail: &previousEmail,
+			UpdatedAt:     now,
+		}},
+		{"phone updated", events.TypeUserUpdated, events.UserUpdated{
+			UserID:        uuid.New(),
+			Email:         "user@example.com",
+			Phone:         &phone,
+			EmailVerified: true,
+			ChangedFields: []string{"phone"},
+			UpdatedAt:     now,
+		}},
+		{"locked", events.TypeUserLocked, events.UserLocked{
+			UserID:      uuid.New(),
+			Email:       "user@example.com",
+			IPAddress:   "198.51.100.7",
+			LockedUntil: now.Add(15 * time.Minute),
+			LockedAt:    now,
+		}},
+		{"suspicious new device", events.TypeUserLoginSuspicious, events.UserLoginSuspicious{
+			UserID:            uuid.New(),
+			Email:             "user@example.com",
+			IPAddress:         "198.51.100.7",
+			UserAgent:         "curl/8.0",
+			DeviceFingerprint: "fp",
+			Reasons:           []string{service.LoginRiskNewDevice, service.LoginRiskUnusualHour},
+			DetectedAt:        now,
+		}},
+		{"suspicious travel", events.TypeUserLoginSuspicious, events.UserLoginSuspicious{
+			UserID:            uuid.New(),
+			Email:             "user@example.com",
+			IPAddress:         "198.51.100.7",
+			UserAgent:         "curl/8.0",
+			DeviceFingerprint: "fp",
+			Reasons:           []string{service.LoginRiskImpossibleTravel},
+			Country:           &country,
+			City:              &city,
+			PreviousIPAddress: &previousIP,
+			PreviousCountry:   &country,
+			DistanceKm:        &distance,
+			SpeedKmh:          &speed,
+			StepUpRequired:    true,
+			DetectedAt:        now,
+		}},
+		{"step-up requested", events.TypeUserLoginStepUpRequested, events.UserLoginStepUpRequested{
+			UserID:    uuid.New(),
+			Email:     "user@example.com",
+			Code:      "123456",
+			IPAddress: "198.51.100.7",
+			ExpiresAt: now.Add(10 * time.Minute),
+		}},
+		{"session compromised", events.TypeUserSessionCompromised, events.UserSessionCompromised{
+			UserID:     uuid.New(),
+			FamilyID:   uuid.New(),
+			SessionID:  uuid.New(),
+			IPAddress:  "198.51.100.7",
+			UserAgent:  "curl/8.0",
+			DetectedAt: now,
+		}},
+	}
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := events.New(tt.eventType, uuid.NewString(), tt.data)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if err := event.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if event.Source != events.Source {
+				t.Errorf("source = %q, want %q", event.Source, events.Source)
+			}
+		})
+		covered[tt.eventType] = true
+	}
+
+	for _, eventType := range events.Types() {
+		if strings.HasPrefix(eventType, "com.bankflow.user.") && !covered[eventType] {
+			t.Errorf("no payload tested for %s", eventType)
+		}
+	}
+}
+
+func TestNewRejectsPayloadsOffContract(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		data      interface{}
+	}{
+		{"unknown type", "com.bankflow.user.renamed.v1", events.UserVerified{UserID: uuid.New()}},
+		{"wrong payload", events.TypeUserLocked, events.UserLoggedIn{UserID: uuid.New()}},
+		{"bad channel", events.TypeUserVerified, events.UserVerified{
+			UserID:     uuid.New(),
+			Channel:    "SMS",
+			VerifiedAt: time.Now(),
+		}},
+		{"bad reason", events.TypeUserLoginSuspicious, events.UserLoginSuspicious{
+			UserID:     uuid.New(),
+			Reasons:    []string{"tor_exit_node"},
+			DetectedAt: time.Now(),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := events.New(tt.eventType, uuid.NewString(), tt.data); err == nil {
+				t.Fatal("New accepted a payload that breaks the contract")
+			}
+		})
+	}
+}
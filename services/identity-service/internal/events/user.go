@@ -0,0 +1,160 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// User event types
+const (
+	TypeUserRegistered = "com.bankflow.user.registered.v1"
+	TypeUserLoggedIn   = "com.bankflow.user.logged_in.v1"
+
+	TypeUserPasswordResetRequested = "com.bankflow.user.password_reset_requested.v1"
+	TypeUserVerificationRequested  = "com.bankflow.user.verification_requested.v1"
+	TypeUserVerified               = "com.bankflow.user.verified.v1"
+	TypeUserUpdated                = "com.bankflow.user.updated.v1"
+	TypeUserLocked                 = "com.bankflow.user.locked.v1"
+	TypeUserLoginSuspicious        = "com.bankflow.user.login.suspicious.v1"
+	TypeUserLoginStepUpRequested   = "com.bankflow.user.login.step_up_requested.v1"
+	TypeUserSessionCompromised     = "com.bankflow.user.session.compromised.v1"
+)
+
+// secretFields names the payload field of each event type that carries a
+// plaintext token or one-time code
+var secretFields = map[string]string{
+	TypeUserPasswordResetRequested: "reset_token",
+	TypeUserVerificationRequested:  "code",
+	TypeUserLoginStepUpRequested:   "code",
+}
+
+// SecretPath returns the path within a stored envelope of the secret an
+// event of eventType carries, or nil if it carries none. The outbox relay
+// removes it once the event is published.
+func SecretPath(eventType string) []string {
+	field, ok := secretFields[eventType]
+	if !ok {
+		return nil
+	}
+	return []string{"data", field}
+}
+
+// UserRegistered is the payload of user.registered
+type UserRegistered struct {
+	UserID     uuid.UUID `json:"user_id"`
+	Email      string    `json:"email"`
+	Phone      *string   `json:"phone"`
+	IsVerified bool      `json:"is_verified"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// UserLoggedIn is the payload of user.logged_in
+type UserLoggedIn struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	LoginTime time.Time `json:"login_time"`
+}
+
+// UserPasswordResetRequested is the payload of user.password_reset_requested.
+// It carries the plaintext reset token so the notification pipeline can send
+// the reset link; the token is single-use and short-lived, and is removed
+// from the outbox once published.
+type UserPasswordResetRequested struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Email       string    `json:"email"`
+	ResetToken  string    `json:"reset_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// UserVerificationRequested is the payload of user.verification_requested.
+// Code is the email link token or the SMS one-time code for the notifier to
+// deliver to Destination.
+type UserVerificationRequested struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Channel     string    `json:"channel"`
+	Destination string    `json:"destination"`
+	Code        string    `json:"code"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// UserVerified is the payload of user.verified
+type UserVerified struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Channel     string    `json:"channel"`
+	Destination string    `json:"destination"`
+	VerifiedAt  time.Time `json:"verified_at"`
+}
+
+// UserUpdated is the payload of user.updated, recorded when a user's email
+// or phone changes. It carries the user's current contact details so
+// consumers can sync, and the previous value of each changed field.
+type UserUpdated struct {
+	UserID        uuid.UUID `json:"user_id"`
+	Email         string    `json:"email"`
+	Phone         *string   `json:"phone"`
+	EmailVerified bool      `json:"email_verified"`
+	PhoneVerified bool      `json:"phone_verified"`
+	ChangedFields []string  `json:"changed_fields"`
+	PreviousEmail *string   `json:"previous_email,omitempty"`
+	PreviousPhone *string   `json:"previous_phone,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// UserLocked is the payload of user.locked, recorded when failed logins lock
+// an account. IPAddress is the client of the login that locked it.
+type UserLocked struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Email       string    `json:"email"`
+	IPAddress   string    `json:"ip_address"`
+	LockedUntil time.Time `json:"locked_until"`
+	LockedAt    time.Time `json:"locked_at"`
+}
+
+// UserLoginSuspicious is the payload of user.login.suspicious, recorded when
+// a login with the right password comes from a new device, an impossible
+// distance from the previous login, or at an unusual hour for the user. The
+// location fields are set when a GeoIP database is configured, and the
+// travel fields only for impossible_travel.
+type UserLoginSuspicious struct {
+	UserID            uuid.UUID `json:"user_id"`
+	Email             string    `json:"email"`
+	IPAddress         string    `json:"ip_address"`
+	UserAgent         string    `json:"user_agent"`
+	DeviceFingerprint string    `json:"device_fingerprint"`
+	Reasons           []string  `json:"reasons"`
+	Country           *string   `json:"country"`
+	City              *string   `json:"city"`
+	PreviousIPAddress *string   `json:"previous_ip_address,omitempty"`
+	PreviousCountry   *string   `json:"previous_country,omitempty"`
+	DistanceKm        *float64  `json:"distance_km,omitempty"`
+	SpeedKmh          *float64  `json:"speed_kmh,omitempty"`
+	StepUpRequired    bool      `json:"step_up_required"`
+	DetectedAt        time.Time `json:"detected_at"`
+}
+
+// UserLoginStepUpRequested is the payload of user.login.step_up_requested.
+// It carries the plaintext one-time code for the notifier to email to a user
+// without MFA whose login was suspicious.
+type UserLoginStepUpRequested struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	Code      string    `json:"code"`
+	IPAddress string    `json:"ip_address"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UserSessionCompromised is the payload of user.session.compromised, recorded
+// when an already-rotated refresh token is presented again. IPAddress and
+// UserAgent describe the client that replayed it.
+type UserSessionCompromised struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FamilyID   uuid.UUID `json:"family_id"`
+	SessionID  uuid.UUID `json:"session_id"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	DetectedAt time.Time `json:"detected_at"`
+}
@@ -0,0 +1,148 @@
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// earthRadiusKm is the mean radius of the Earth
+const earthRadiusKm = 6371.0
+
+// Location is where an IP address is registered
+type Location struct {
+	Country   string
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+// DistanceKm returns the great-circle distance between two locations
+func DistanceKm(a, b Location) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// ipRange is one row of the database: the addresses from start to end
+// inclusive are at location
+type ipRange struct {
+	start    netip.Addr
+	end      netip.Addr
+	location *Location
+}
+
+// Database is an offline IP to city database in the DB-IP "IP to City Lite"
+// CSV format, loaded into memory:
+//
+//	ip_start,ip_end,continent,country,stateprov,city,latitude,longitude
+//
+// Both IPv4 and IPv6 ranges are supported. Lookups never leave the process.
+type Database struct {
+	ranges []ipRange
+}
+
+// Open loads a database file
+func Open(path string) (*Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 8
+	reader.ReuseRecord = true
+
+	db := &Database{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row, err := parseRange(record)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		db.ranges = append(db.ranges, row)
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].start.Less(db.ranges[j].start)
+	})
+
+	return db, nil
+}
+
+func parseRange(record []string) (ipRange, error) {
+	start, err := netip.ParseAddr(record[0])
+	if err != nil {
+		return ipRange{}, errors.New("invalid start address")
+	}
+	end, err := netip.ParseAddr(record[1])
+	if err != nil || end.Is4() != start.Is4() || end.Less(start) {
+		return ipRange{}, errors.New("invalid end address")
+	}
+
+	latitude, err := strconv.ParseFloat(record[6], 64)
+	if err != nil {
+		return ipRange{}, errors.New("invalid latitude")
+	}
+	longitude, err := strconv.ParseFloat(record[7], 64)
+	if err != nil {
+		return ipRange{}, errors.New("invalid longitude")
+	}
+
+	return ipRange{
+		start: start,
+		end:   end,
+		location: &Location{
+			Country:   record[3],
+			City:      record[5],
+			Latitude:  latitude,
+			Longitude: longitude,
+		},
+	}, nil
+}
+
+// Len returns the number of ranges in the database
+func (d *Database) Len() int {
+	return len(d.ranges)
+}
+
+// Lookup returns the location of an IP address, or nil if the address is
+// invalid or not in the database, as private addresses usually are
+func (d *Database) Lookup(ip string) *Location {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+
+	// The last range starting at or before the address is the only one
+	// that can contain it
+	i := sort.Search(len(d.ranges), func(i int) bool {
+		return addr.Less(d.ranges[i].start)
+	}) - 1
+	if i < 0 || d.ranges[i].end.Less(addr) || d.ranges[i].start.Is4() != addr.Is4() {
+		return nil
+	}
+
+	return d.ranges[i].location
+}
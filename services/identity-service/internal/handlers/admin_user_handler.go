@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// PermissionUsersManage lets admins manage other users' accounts
+const PermissionUsersManage = "users:manage"
+
+// ListUsers searches users by email or phone number, with optional filters
+// @Summary List users
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Part of an email or phone number"
+// @Param verified query bool false "Only verified or unverified users"
+// @Param active query bool false "Only active or deactivated users"
+// @Param locked query bool false "Only locked or unlocked users"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Users per page, up to 100"
+// @Success 200 {object} models.UserList
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users [get]
+func (h *AuthHandler) ListUsers(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var query models.UserListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	users, err := h.authService.ListUsers(c.Request.Context(), admin, &query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// GetLoginHistory lists a user's most recent logins
+// @Summary List a user's logins
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param limit query int false "Logins to return, up to 200"
+// @Success 200 {array} models.LoginRecord
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/logins [get]
+func (h *AuthHandler) GetLoginHistory(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	var query models.LoginHistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	history, err := h.authService.GetLoginHistory(c.Request.Context(), admin, userID, query.Limit)
+	if err != nil {
+		respondAdminUserError(c, err, "fetch_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// DeactivateUser stops a user logging in and signs them out everywhere
+// @Summary Deactivate a user
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.AdminActionRequest false "Reason for the audit log"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/deactivate [post]
+func (h *AuthHandler) DeactivateUser(c *gin.Context) {
+	admin, userID, req, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.DeactivateUser(c.Request.Context(), admin, userID, req.Reason); err != nil {
+		respondAdminUserError(c, err, "deactivate_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "User deactivated",
+	})
+}
+
+// ReactivateUser lets a deactivated user log in again
+// @Summary Reactivate a user
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.AdminActionRequest false "Reason for the audit log"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/reactivate [post]
+func (h *AuthHandler) ReactivateUser(c *gin.Context) {
+	admin, userID, req, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.ReactivateUser(c.Request.Context(), admin, userID, req.Reason); err != nil {
+		respondAdminUserError(c, err, "reactivate_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "User reactivated",
+	})
+}
+
+// ForcePasswordReset signs a user out everywhere and makes them reset their
+// password before they can log in again
+// @Summary Force a password reset
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.AdminActionRequest false "Reason for the audit log"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/password-reset [post]
+func (h *AuthHandler) ForcePasswordReset(c *gin.Context) {
+	admin, userID, req, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.ForcePasswordReset(c.Request.Context(), admin, userID, req.Reason); err != nil {
+		respondAdminUserError(c, err, "password_reset_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Password reset required",
+	})
+}
+
+// UnlockUser clears a user's lockout after failed logins
+// @Summary Unlock a user
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.AdminActionRequest false "Reason for the audit log"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/unlock [post]
+func (h *AuthHandler) UnlockUser(c *gin.Context) {
+	admin, userID, req, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.UnlockUser(c.Request.Context(), admin, userID, req.Reason); err != nil {
+		respondAdminUserError(c, err, "unlock_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "User unlocked",
+	})
+}
+
+// GetAuditLog lists the actions admins have taken on users
+// @Summary List the admin audit log
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param admin_id query string false "Only actions by this admin"
+// @Param user_id query string false "Only actions on this user"
+// @Param action query string false "Only this action, e.g. users.deactivate"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Entries per page, up to 100"
+// @Success 200 {object} models.AuditLog
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/audit-log [get]
+func (h *AuthHandler) GetAuditLog(c *gin.Context) {
+	var query models.AuditLogQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	auditLog, err := h.authService.GetAuditLog(c.Request.Context(), &query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, auditLog)
+}
+
+// currentAdmin returns the admin making the request, writing an error
+// response if there is none
+func currentAdmin(c *gin.Context) (service.Admin, bool) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return service.Admin{}, false
+	}
+
+	return service.Admin{ID: adminID, IPAddress: c.ClientIP()}, true
+}
+
+// bindAdminAction reads the admin, target user and optional body of an
+// admin action on a user, writing an error response if any is invalid
+func bindAdminAction(c *gin.Context) (service.Admin, uuid.UUID, *models.AdminActionRequest, bool) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return service.Admin{}, uuid.Nil, nil, false
+	}
+
+	userID, ok := pathUUID(c, "id")
+	if !ok {
+		return service.Admin{}, uuid.Nil, nil, false
+	}
+
+	var req models.AdminActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return service.Admin{}, uuid.Nil, nil, false
+	}
+
+	return admin, userID, &req, true
+}
+
+func respondAdminUserError(c *gin.Context, err error, code string) {
+	switch err {
+	case service.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: err.Error(),
+		})
+	case service.ErrSelfDeactivation:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "self_deactivation",
+			Message: err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   code,
+			Message: err.Error(),
+		})
+	}
+}
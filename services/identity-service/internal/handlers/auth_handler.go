@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Caesarsage/bankflow/identity-service/internal/middleware"
 	"github.com/Caesarsage/bankflow/identity-service/internal/models"
@@ -29,6 +34,7 @@ func NewAuthHandler(authService *service.AuthService) *AuthHandler {
 // @Param request body models.RegisterRequest true "Registration details"
 // @Success 201 {object} models.User
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 422 {object} models.PasswordPolicyErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /api/v1/auth/register [post]
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -43,6 +49,10 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	user, err := h.authService.Register(c.Request.Context(), &req)
 	if err != nil {
+		if writePasswordPolicyError(c, err) {
+			return
+		}
+
 		if err == service.ErrEmailAlreadyExists {
 			c.JSON(http.StatusConflict, models.ErrorResponse{
 				Error:   "email_exists",
@@ -61,7 +71,9 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	c.JSON(http.StatusCreated, user)
 }
 
-// Login handles user login
+// Login handles user login. Users with MFA enabled, and suspicious logins
+// when step-up is on, get an mfa_token to complete with /auth/mfa/verify
+// instead of tokens.
 // @Summary Login user
 // @Tags auth
 // @Accept json
@@ -70,6 +82,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 // @Success 200 {object} models.LoginResponse
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /api/v1/auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -88,6 +102,10 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	response, err := h.authService.Login(c.Request.Context(), &req, ipAddress, userAgent)
 	if err != nil {
+		if writeLoginThrottledError(c, err) {
+			return
+		}
+
 		switch err {
 		case service.ErrInvalidCredentials:
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
@@ -104,6 +122,21 @@ func (h *AuthHandler) Login(c *gin.Context) {
 				Error:   "account_inactive",
 				Message: "Account is inactive",
 			})
+		case service.ErrPasswordResetRequired:
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "password_reset_required",
+				Message: "Password must be reset before logging in",
+			})
+		case service.ErrEmailNotVerified:
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "email_not_verified",
+				Message: "Email address must be verified before logging in",
+			})
+		case service.ErrPhoneNotVerified:
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "phone_not_verified",
+				Message: "Phone number must be verified before logging in",
+			})
 		default:
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 				Error:   "login_failed",
@@ -137,8 +170,16 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.RefreshToken(c.Request.Context(), req.RefreshToken)
+	response, err := h.authService.RefreshToken(c.Request.Context(), req.RefreshToken, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
+		if err == service.ErrRefreshTokenReused {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   "token_reused",
+				Message: "Refresh token was already used; all sessions from this login have been revoked",
+			})
+			return
+		}
+
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 			Error:   "invalid_token",
 			Message: "Invalid or expired refresh token",
@@ -149,7 +190,8 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// Logout handles user logout
+// Logout handles user logout. A bearer access token, if sent, is revoked
+// along with the refresh token's session.
 // @Summary Logout user
 // @Tags auth
 // @Accept json
@@ -169,7 +211,12 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		return
 	}
 
-	err := h.authService.Logout(c.Request.Context(), req.RefreshToken)
+	var accessToken string
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		accessToken = token
+	}
+
+	err := h.authService.Logout(c.Request.Context(), req.RefreshToken, accessToken)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "logout_failed",
@@ -183,6 +230,291 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	})
 }
 
+// RequestPasswordReset handles password reset requests
+// @Summary Request a password reset
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.PasswordResetRequest true "Account email"
+// @Success 202 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/password/reset [post]
+func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
+	var req models.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.RequestPasswordReset(c.Request.Context(), &req); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "reset_request_failed",
+			Message: "Could not process password reset request",
+		})
+		return
+	}
+
+	// Same response whether or not the email is registered
+	c.JSON(http.StatusAccepted, models.SuccessResponse{
+		Message: "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+// ConfirmPasswordReset handles password reset confirmation
+// @Summary Reset password with a reset token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.PasswordResetConfirm true "Reset token and new password"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 422 {object} models.PasswordPolicyErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/password/reset/confirm [post]
+func (h *AuthHandler) ConfirmPasswordReset(c *gin.Context) {
+	var req models.PasswordResetConfirm
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	err := h.authService.ResetPassword(c.Request.Context(), &req)
+	if err != nil {
+		if writePasswordPolicyError(c, err) {
+			return
+		}
+
+		if err == service.ErrInvalidResetToken {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_token",
+				Message: "Invalid or expired reset token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "reset_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Password reset successful",
+	})
+}
+
+// VerifyEmail handles email verification
+// @Summary Verify email address
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.VerifyEmailRequest true "Verification link token"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/verify/email [post]
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.VerifyEmail(c.Request.Context(), &req); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Email verified",
+	})
+}
+
+// ResendEmailVerification handles requests for a new email verification link
+// @Summary Resend email verification link
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResendVerificationRequest true "Account email"
+// @Success 202 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/verify/email/resend [post]
+func (h *AuthHandler) ResendEmailVerification(c *gin.Context) {
+	var req models.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.ResendEmailVerification(c.Request.Context(), &req); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "resend_failed",
+			Message: "Could not process verification request",
+		})
+		return
+	}
+
+	// Same response whether or not the email is registered
+	c.JSON(http.StatusAccepted, models.SuccessResponse{
+		Message: "If an unverified account exists for this email, a verification link has been sent",
+	})
+}
+
+// SendPhoneVerification sends a one-time code to the current user's phone
+// @Summary Send phone verification code
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/verify/phone/send [post]
+func (h *AuthHandler) SendPhoneVerification(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.SendPhoneVerification(c.Request.Context(), userID); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.SuccessResponse{
+		Message: "Verification code sent",
+	})
+}
+
+// VerifyPhone verifies the current user's phone with a one-time code
+// @Summary Verify phone number
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.VerifyPhoneRequest true "One-time code"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/verify/phone [post]
+func (h *AuthHandler) VerifyPhone(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.VerifyPhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.VerifyPhone(c.Request.Context(), userID, &req); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Phone number verified",
+	})
+}
+
+func respondVerificationError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrInvalidVerificationCode:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_code",
+			Message: "Invalid or expired verification code",
+		})
+	case service.ErrNoPhoneNumber:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "no_phone_number",
+			Message: "No phone number on this account",
+		})
+	case service.ErrAlreadyVerified:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "already_verified",
+			Message: "Already verified",
+		})
+	case service.ErrVerificationThrottled:
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+			Error:   "too_many_requests",
+			Message: "Verification code requested too recently, try again later",
+		})
+	case service.ErrEmailAlreadyExists:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "email_exists",
+			Message: "Email already registered",
+		})
+	case service.ErrPhoneAlreadyExists:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "phone_exists",
+			Message: "Phone number already in use",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "verification_failed",
+			Message: err.Error(),
+		})
+	}
+}
+
+// writeLoginThrottledError writes a 429 with Retry-After for a throttled
+// login and reports whether err was one
+func writeLoginThrottledError(c *gin.Context, err error) bool {
+	var throttled *service.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+
+	seconds := int(math.Ceil(throttled.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+		Error:   "too_many_attempts",
+		Message: "Too many failed login attempts, try again in " + strconv.Itoa(seconds) + " seconds",
+	})
+	return true
+}
+
+// writePasswordPolicyError writes the violations of a password rejected by
+// the password policy and reports whether err was such a rejection
+func writePasswordPolicyError(c *gin.Context, err error) bool {
+	var policyErr *service.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	c.JSON(http.StatusUnprocessableEntity, models.PasswordPolicyErrorResponse{
+		Error:      "password_policy",
+		Message:    "Password does not meet the password policy",
+		Violations: policyErr.Violations,
+	})
+	return true
+}
+
 // GetMe returns current user info
 // @Summary Get current user
 // @Tags auth
@@ -193,14 +525,33 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 // @Failure 500 {object} models.ErrorResponse
 // @Router /api/v1/auth/me [get]
 func (h *AuthHandler) GetMe(c *gin.Context) {
-	// Get user ID from context (set by auth middleware)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.authService.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// currentUserID returns the user ID set by the auth middleware, writing an
+// error response if it is missing or malformed
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
 	userIDStr, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 			Error:   "unauthorized",
 			Message: "User not authenticated",
 		})
-		return
+		return uuid.Nil, false
 	}
 
 	userID, err := uuid.Parse(userIDStr.(string))
@@ -209,19 +560,10 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 			Error:   "invalid_user_id",
 			Message: err.Error(),
 		})
-		return
-	}
-
-	user, err := h.authService.GetUserByID(c.Request.Context(), userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "fetch_failed",
-			Message: err.Error(),
-		})
-		return
+		return uuid.Nil, false
 	}
 
-	c.JSON(http.StatusOK, user)
+	return userID, true
 }
 
 // Health check
@@ -232,8 +574,9 @@ func (h *AuthHandler) Health(c *gin.Context) {
 	})
 }
 
-// Register routes
-func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup, jwtManager *jwt.JWTManager) {
+// Register routes. Sensitive routes require the user to have logged in or
+// stepped up within stepUpMaxAge.
+func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup, jwtManager *jwt.JWTManager, checker middleware.RevocationChecker, stepUpMaxAge time.Duration) {
 	auth := router.Group("/auth")
 	{
 		// Public routes
@@ -241,13 +584,68 @@ func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup, jwtManager *jwt.JW
 		auth.POST("/login", h.Login)
 		auth.POST("/refresh", h.RefreshToken)
 		auth.POST("/logout", h.Logout)
+		auth.POST("/password/reset", h.RequestPasswordReset)
+		auth.POST("/password/reset/confirm", h.ConfirmPasswordReset)
+		auth.POST("/verify/email", h.VerifyEmail)
+		auth.POST("/verify/email/resend", h.ResendEmailVerification)
+		auth.POST("/mfa/verify", h.VerifyMFA)
 
-		// Protected routes
+		// Protected routes, for interactive sign-ins only
 		authenticated := auth.Group("")
-		authenticated.Use(middleware.AuthMiddleware(jwtManager))
+		authenticated.Use(middleware.AuthMiddleware(jwtManager, checker), middleware.RejectClientTokens())
 		{
 			authenticated.GET("/me", h.GetMe)
+			authenticated.PUT("/me/password", h.ChangePassword)
+			authenticated.POST("/me/email", h.ChangeEmail)
+			authenticated.POST("/me/phone", middleware.RequireStepUp(stepUpMaxAge), h.ChangePhone)
+			authenticated.POST("/step-up", h.StepUp)
+			authenticated.POST("/verify/phone/send", h.SendPhoneVerification)
+			authenticated.POST("/verify/phone", h.VerifyPhone)
+			authenticated.POST("/mfa/enroll", h.EnrollMFA)
+			authenticated.POST("/mfa/enroll/confirm", h.ConfirmMFA)
+			authenticated.POST("/mfa/recovery-codes", h.RegenerateRecoveryCodes)
+			authenticated.POST("/mfa/disable", h.DisableMFA)
+			authenticated.GET("/sessions", h.GetSessions)
+			authenticated.DELETE("/sessions", h.RevokeAllSessions)
+			authenticated.DELETE("/sessions/:sessionId", h.RevokeSession)
+			authenticated.GET("/api-keys", h.ListAPIKeys)
+			authenticated.POST("/api-keys", h.CreateAPIKey)
+			authenticated.DELETE("/api-keys/:id", h.RevokeAPIKey)
+			authenticated.GET("/consents", h.ListConsents)
+			authenticated.DELETE("/consents/:clientId", h.RevokeConsent)
 		}
 	}
 
+	// Admin routes, each requiring a permission from the caller's roles
+	admin := router.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(jwtManager, checker), middleware.RejectClientTokens())
+	{
+		sessions := middleware.RequirePermission(PermissionSessionsManage)
+		admin.GET("/users/:id/sessions", sessions, h.AdminGetSessions)
+		admin.DELETE("/users/:id/sessions", sessions, h.AdminRevokeAllSessions)
+		admin.DELETE("/users/:id/sessions/:sessionId", sessions, h.AdminRevokeSession)
+
+		roles := middleware.RequirePermission(PermissionRolesManage)
+		admin.GET("/roles", roles, h.ListRoles)
+		admin.POST("/roles", roles, h.CreateRole)
+		admin.PUT("/roles/:role/permissions", roles, h.SetRolePermissions)
+		admin.GET("/permissions", roles, h.ListPermissions)
+		admin.GET("/users/:id/roles", roles, h.GetUserRoles)
+		admin.POST("/users/:id/roles", roles, h.AssignRole)
+		admin.DELETE("/users/:id/roles/:role", roles, h.RemoveRole)
+
+		users := middleware.RequirePermission(PermissionUsersManage)
+		admin.GET("/users", users, h.ListUsers)
+		admin.GET("/users/:id/logins", users, h.GetLoginHistory)
+		admin.POST("/users/:id/deactivate", users, h.DeactivateUser)
+		admin.POST("/users/:id/reactivate", users, h.ReactivateUser)
+		admin.POST("/users/:id/password-reset", users, h.ForcePasswordReset)
+		admin.POST("/users/:id/unlock", users, h.UnlockUser)
+		admin.GET("/audit-log", users, h.GetAuditLog)
+
+		clients := middleware.RequirePermission(PermissionClientsManage)
+		admin.GET("/oauth/clients", clients, h.ListOAuthClients)
+		admin.POST("/oauth/clients", clients, h.CreateOAuthClient)
+		admin.DELETE("/oauth/clients/:clientId", clients, h.RevokeOAuthClient)
+	}
 }
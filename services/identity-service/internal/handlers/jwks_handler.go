@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Caesarsage/bankflow/identity-service/pkg/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSHandler serves the public signing keys at /.well-known/jwks.json. The
+// key set is fixed for the life of the process, so the document is built once.
+func JWKSHandler(keys *jwt.KeySet) (gin.HandlerFunc, error) {
+	set, err := keys.JWKS()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		// Validators cache keys and refetch on an unknown kid, so a short
+		// max-age is enough to pick up rotations
+		c.Header("Cache-Control", "public, max-age=300")
+		c.Data(http.StatusOK, "application/json", body)
+	}, nil
+}
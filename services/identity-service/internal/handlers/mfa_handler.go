@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyMFA completes a login that requires MFA
+// @Summary Complete login with a TOTP, recovery or emailed code
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body models.MFAVerifyRequest true "MFA token from login and code"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/mfa/verify [post]
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response, err := h.authService.VerifyMFA(c.Request.Context(), &req)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// EnrollMFA starts TOTP enrollment for the current user
+// @Summary Start MFA enrollment
+// @Tags mfa
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.MFAEnrollment
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/mfa/enroll [post]
+func (h *AuthHandler) EnrollMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.authService.EnrollMFA(c.Request.Context(), userID)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmMFA confirms TOTP enrollment and returns recovery codes
+// @Summary Confirm MFA enrollment
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.MFACodeRequest true "Code from the authenticator"
+// @Success 200 {object} models.MFARecoveryCodes
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/mfa/enroll/confirm [post]
+func (h *AuthHandler) ConfirmMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	codes, err := h.authService.ConfirmMFA(c.Request.Context(), userID, &req)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+// @Summary Regenerate MFA recovery codes
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.MFACodeRequest true "Code from the authenticator"
+// @Success 200 {object} models.MFARecoveryCodes
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/mfa/recovery-codes [post]
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(c.Request.Context(), userID, &req, c.ClientIP())
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+// DisableMFA turns MFA off for the current user
+// @Summary Disable MFA
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.MFADisableRequest true "Password and TOTP or recovery code"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/mfa/disable [post]
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.MFADisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.DisableMFA(c.Request.Context(), userID, &req, c.ClientIP()); err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "MFA disabled",
+	})
+}
+
+func respondMFAError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrInvalidMFAToken:
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "invalid_mfa_token",
+			Message: "Invalid or expired MFA token, log in again",
+		})
+	case service.ErrInvalidMFACode:
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "invalid_mfa_code",
+			Message: "Invalid MFA code",
+		})
+	case service.ErrInvalidCredentials:
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "invalid_credentials",
+			Message: "Invalid password",
+		})
+	case service.ErrMFAAlreadyEnabled:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "mfa_already_enabled",
+			Message: "MFA is already enabled",
+		})
+	case service.ErrMFANotEnabled:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "mfa_not_enabled",
+			Message: "MFA is not enabled",
+		})
+	case service.ErrMFANotEnrolled:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "mfa_not_enrolled",
+			Message: "Start MFA enrollment first",
+		})
+	case service.ErrAccountLocked:
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "account_locked",
+			Message: "Account is temporarily locked due to multiple failed login attempts",
+		})
+	case service.ErrAccountInactive:
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "account_inactive",
+			Message: "Account is inactive",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "mfa_failed",
+			Message: err.Error(),
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// PermissionClientsManage lets admins register and revoke OAuth clients
+const PermissionClientsManage = "clients:manage"
+
+// Grant types accepted by the token endpoint. API keys use an extension
+// grant (RFC 6749 section 4.5) with the key in the api_key parameter.
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeAPIKey            = "urn:bankflow:params:oauth:grant-type:api-key"
+)
+
+// Token is the OAuth2 token endpoint. Confidential clients authenticate with
+// HTTP Basic or client_id and client_secret form parameters; public clients
+// send only client_id.
+// @Summary Issue an access token
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, client_credentials or urn:bankflow:params:oauth:grant-type:api-key"
+// @Param client_id formData string false "Client ID"
+// @Param client_secret formData string false "Client secret"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI of the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param api_key formData string false "API key"
+// @Param scope formData string false "Space-separated scopes"
+// @Success 200 {object} models.OAuthTokenResponse
+// @Failure 400 {object} models.OAuthErrorResponse
+// @Failure 401 {object} models.OAuthErrorResponse
+// @Failure 500 {object} models.OAuthErrorResponse
+// @Router /oauth/token [post]
+func (h *AuthHandler) Token(c *gin.Context) {
+	// Token responses must not be cached (RFC 6749 section 5.1)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var (
+		response *models.OAuthTokenResponse
+		err      error
+	)
+
+	clientID, clientSecret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	switch grantType := c.PostForm("grant_type"); grantType {
+	case GrantTypeAuthorizationCode:
+		code := c.PostForm("code")
+		if clientID == "" {
+			writeOAuthError(c, http.StatusUnauthorized, "invalid_client", "client_id is required")
+			return
+		}
+		if code == "" {
+			writeOAuthError(c, http.StatusBadRequest, "invalid_request", "code is required")
+			return
+		}
+		response, err = h.authService.AuthorizationCodeToken(c.Request.Context(),
+			clientID, clientSecret, code, c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+	case GrantTypeClientCredentials:
+		if clientID == "" || clientSecret == "" {
+			writeOAuthError(c, http.StatusUnauthorized, "invalid_client", "Client authentication required")
+			return
+		}
+		response, err = h.authService.ClientCredentialsToken(c.Request.Context(), clientID, clientSecret, c.PostForm("scope"))
+	case GrantTypeAPIKey:
+		apiKey := c.PostForm("api_key")
+		if apiKey == "" {
+			writeOAuthError(c, http.StatusBadRequest, "invalid_request", "api_key is required")
+			return
+		}
+		response, err = h.authService.APIKeyToken(c.Request.Context(), apiKey, c.PostForm("scope"))
+	case "":
+		writeOAuthError(c, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	default:
+		writeOAuthError(c, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type "+grantType)
+		return
+	}
+
+	if err != nil {
+		switch err {
+		case service.ErrInvalidClient:
+			writeOAuthError(c, http.StatusUnauthorized, "invalid_client", "Invalid client credentials")
+		case service.ErrInvalidGrant:
+			writeOAuthError(c, http.StatusBadRequest, "invalid_grant", "Invalid, expired or already used authorization code")
+		case service.ErrInvalidAPIKey, service.ErrAccountInactive:
+			writeOAuthError(c, http.StatusBadRequest, "invalid_grant", "Invalid, expired or revoked API key")
+		case service.ErrInvalidScope:
+			writeOAuthError(c, http.StatusBadRequest, "invalid_scope", "Requested scope is not allowed")
+		default:
+			writeOAuthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// writeOAuthError writes a token endpoint error response. Failed client
+// authentication asks for HTTP Basic credentials (RFC 6749 section 5.2).
+func writeOAuthError(c *gin.Context, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.JSON(status, models.OAuthErrorResponse{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
+
+// CreateOAuthClient registers an OAuth client
+// @Summary Register an OAuth client
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateOAuthClientRequest true "Client"
+// @Success 201 {object} models.OAuthClientCredentials
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/oauth/clients [post]
+func (h *AuthHandler) CreateOAuthClient(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	credentials, err := h.authService.CreateOAuthClient(c.Request.Context(), admin, &req)
+	if err != nil {
+		writeOAuthAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, credentials)
+}
+
+// ListOAuthClients lists OAuth clients
+// @Summary List OAuth clients
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.OAuthClient
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/oauth/clients [get]
+func (h *AuthHandler) ListOAuthClients(c *gin.Context) {
+	clients, err := h.authService.ListOAuthClients(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, clients)
+}
+
+// RevokeOAuthClient revokes an OAuth client and its tokens
+// @Summary Revoke an OAuth client
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param clientId path string true "Client ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/oauth/clients/{clientId} [delete]
+func (h *AuthHandler) RevokeOAuthClient(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.RevokeOAuthClient(c.Request.Context(), admin, c.Param("clientId")); err != nil {
+		writeOAuthAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Client revoked",
+	})
+}
+
+// CreateAPIKey creates an API key for the current user
+// @Summary Create an API key
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateAPIKeyRequest true "API key"
+// @Success 201 {object} models.CreatedAPIKey
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/api-keys [post]
+func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	key, err := h.authService.CreateAPIKey(c.Request.Context(), userID, &req)
+	if err != nil {
+		writeOAuthAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// ListAPIKeys lists the current user's API keys
+// @Summary List API keys
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.APIKey
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/api-keys [get]
+func (h *AuthHandler) ListAPIKeys(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.authService.ListAPIKeys(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey revokes one of the current user's API keys
+// @Summary Revoke an API key
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "API key ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/api-keys/{id} [delete]
+func (h *AuthHandler) RevokeAPIKey(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	keyID, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.authService.RevokeAPIKey(c.Request.Context(), userID, keyID); err != nil {
+		writeOAuthAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "API key revoked",
+	})
+}
+
+// writeOAuthAdminError writes the response for a client or API key
+// management error
+func writeOAuthAdminError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrInvalidScope:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_scope",
+			Message: "Scopes must be permissions that can be granted",
+		})
+	case service.ErrOAuthClientNotFound:
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "client_not_found",
+			Message: err.Error(),
+		})
+	case service.ErrAPIKeyNotFound:
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "api_key_not_found",
+			Message: err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "request_failed",
+			Message: err.Error(),
+		})
+	}
+}
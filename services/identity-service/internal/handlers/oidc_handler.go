@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/middleware"
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/service"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// OpenIDConfigurationHandler serves the OpenID Provider metadata at
+// /.well-known/openid-configuration for the given issuer URL. The
+// authorization endpoint is only advertised if there is a sign-in page for
+// it to send browsers to.
+func OpenIDConfigurationHandler(issuer, loginURL string, keys *jwt.KeySet) gin.HandlerFunc {
+	issuer = strings.TrimSuffix(issuer, "/")
+	config := models.OpenIDConfiguration{
+		Issuer:                            issuer,
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   []string{service.ScopeOpenID, service.ScopeEmail, service.ScopePhone},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantTypeAuthorizationCode, GrantTypeClientCredentials, GrantTypeAPIKey},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  keys.Algorithms(),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "nonce", "email", "email_verified", "phone_number", "phone_number_verified"},
+	}
+	if loginURL != "" {
+		config.AuthorizationEndpoint = issuer + "/oauth/authorize"
+	}
+
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=3600")
+		c.JSON(http.StatusOK, config)
+	}
+}
+
+// Authorize handles an authorization request on behalf of the signed-in
+// user. The app hosting the sign-in and consent screens calls it with the
+// user's access token and the client's request parameters, then sends the
+// browser to the returned redirect_uri, or first asks the user to consent
+// and calls again with approve=true.
+// @Summary Authorize a client (authorization code with PKCE)
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.AuthorizeRequest true "Authorization request"
+// @Success 200 {object} models.AuthorizeResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /oauth/authorize [post]
+func (h *AuthHandler) Authorize(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.AuthorizeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response, err := h.authService.Authorize(c.Request.Context(), userID, &req)
+	if err != nil {
+		respondAuthorizeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AuthorizeRedirect is the front-channel authorization endpoint clients send
+// browsers to. It checks the client and redirect URI, then sends the browser
+// on to the sign-in page at loginURL with the request's query, where the
+// user signs in and consents before the page posts it to /oauth/authorize.
+// @Summary Start an authorization (authorization code with PKCE)
+// @Tags oauth
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string false "Registered redirect URI"
+// @Param response_type query string true "code"
+// @Success 302
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /oauth/authorize [get]
+func (h *AuthHandler) AuthorizeRedirect(loginURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		err := h.authService.CheckAuthorizeRequest(c.Request.Context(), query.Get("client_id"), query.Get("redirect_uri"))
+		if err != nil {
+			respondAuthorizeError(c, err)
+			return
+		}
+
+		target, err := url.Parse(loginURL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "authorization_failed",
+				Message: "Sign-in page is misconfigured",
+			})
+			return
+		}
+		target.RawQuery = c.Request.URL.RawQuery
+
+		c.Redirect(http.StatusFound, target.String())
+	}
+}
+
+// respondAuthorizeError writes the error of an authorization request that
+// cannot be answered at the client's redirect URI
+func respondAuthorizeError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrInvalidClient:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_client",
+			Message: "Unknown or revoked client",
+		})
+	case service.ErrInvalidRedirectURI:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_redirect_uri",
+			Message: err.Error(),
+		})
+	case service.ErrAccountInactive:
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "account_inactive",
+			Message: "Account is inactive",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "authorization_failed",
+			Message: err.Error(),
+		})
+	}
+}
+
+// UserInfo returns the OpenID claims of the token's user
+// @Summary OpenID Connect UserInfo
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.UserInfo
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /userinfo [get]
+func (h *AuthHandler) UserInfo(c *gin.Context) {
+	// OAuth client tokens have no user to describe
+	if c.GetString("user_id") == "" {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "insufficient_scope",
+			Message: "Token does not belong to a user",
+		})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	// Tokens issued to clients are limited to their scopes
+	var scopes []string
+	if c.GetString("client_id") != "" {
+		scopes = strings.Fields(c.GetString("scope"))
+	}
+
+	info, err := h.authService.UserInfo(c.Request.Context(), userID, scopes)
+	if err != nil {
+		if err == service.ErrInsufficientScope {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "insufficient_scope",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// ListConsents lists the clients the current user has authorized
+// @Summary List authorized apps
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.OAuthConsent
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/consents [get]
+func (h *AuthHandler) ListConsents(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	consents, err := h.authService.ListConsents(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, consents)
+}
+
+// RevokeConsent withdraws the current user's consent to a client
+// @Summary Revoke an app's authorization
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Param clientId path string true "Client ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/consents/{clientId} [delete]
+func (h *AuthHandler) RevokeConsent(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	err := h.authService.RevokeConsent(c.Request.Context(), userID, c.Param("clientId"))
+	if err == service.ErrConsentNotFound {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "consent_not_found",
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "revoke_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Consent revoked",
+	})
+}
+
+// RegisterOAuthRoutes registers the OAuth2 and OpenID Connect endpoints,
+// which live at the root rather than under /api/v1. Browsers are only taken
+// in at GET /oauth/authorize if there is a sign-in page at loginURL.
+func (h *AuthHandler) RegisterOAuthRoutes(router gin.IRouter, jwtManager *jwt.JWTManager, checker middleware.RevocationChecker, loginURL string) {
+	router.POST("/oauth/token", h.Token)
+	if loginURL != "" {
+		router.GET("/oauth/authorize", h.AuthorizeRedirect(loginURL))
+	}
+	router.POST("/oauth/authorize", middleware.AuthMiddleware(jwtManager, checker), middleware.RejectClientTokens(), h.Authorize)
+
+	userInfo := middleware.AuthMiddleware(jwtManager, checker)
+	router.GET("/userinfo", userInfo, h.UserInfo)
+	router.POST("/userinfo", userInfo, h.UserInfo)
+}
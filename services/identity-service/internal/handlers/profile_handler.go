@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ChangePassword changes the current user's password and signs out every
+// other session
+// @Summary Change password
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 422 {object} models.PasswordPolicyErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/me/password [put]
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var keep *uuid.UUID
+	if current := currentSessionID(c); current != uuid.Nil {
+		keep = &current
+	}
+
+	if err := h.authService.ChangePassword(c.Request.Context(), userID, keep, &req, c.ClientIP()); err != nil {
+		respondProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Password changed",
+	})
+}
+
+// ChangeEmail starts an email change by sending a verification link to the
+// new address, which replaces the current one once verified through
+// /auth/verify/email
+// @Summary Change email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ChangeEmailRequest true "New email and current password"
+// @Success 202 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/me/email [post]
+func (h *AuthHandler) ChangeEmail(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.RequestEmailChange(c.Request.Context(), userID, &req, c.ClientIP()); err != nil {
+		respondProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.SuccessResponse{
+		Message: "Verification link sent to the new email",
+	})
+}
+
+// ChangePhone starts a phone number change by sending a code to the new
+// number, which replaces the current one once verified through
+// /auth/verify/phone. It requires a recent login or step-up.
+// @Summary Change phone number
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ChangePhoneRequest true "New phone number and current password"
+// @Success 202 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse "Also when step-up is required"
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/me/phone [post]
+func (h *AuthHandler) ChangePhone(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ChangePhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.RequestPhoneChange(c.Request.Context(), userID, &req, c.ClientIP()); err != nil {
+		respondProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.SuccessResponse{
+		Message: "Verification code sent to the new phone number",
+	})
+}
+
+// StepUp re-authenticates the current user with their password or a TOTP
+// code and returns a short-lived access token for routes that require
+// recent authentication
+// @Summary Step up authentication
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.StepUpRequest true "Password or TOTP code"
+// @Success 200 {object} models.StepUpResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/step-up [post]
+func (h *AuthHandler) StepUp(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.StepUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response, err := h.authService.StepUp(c.Request.Context(), userID, currentSessionID(c), &req, c.ClientIP())
+	if err != nil {
+		switch err {
+		case service.ErrInvalidCredentials:
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   "invalid_password",
+				Message: "Password is incorrect",
+			})
+		case service.ErrInvalidMFACode:
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   "invalid_mfa_code",
+				Message: "Invalid MFA code",
+			})
+		case service.ErrMFANotEnabled:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "mfa_not_enabled",
+				Message: "MFA is not enabled, step up with the password",
+			})
+		case service.ErrAccountLocked:
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "account_locked",
+				Message: "Account is temporarily locked due to multiple failed login attempts",
+			})
+		case service.ErrAccountInactive:
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "account_inactive",
+				Message: "Account is inactive",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "step_up_failed",
+				Message: err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func respondProfileError(c *gin.Context, err error) {
+	if writePasswordPolicyError(c, err) || writeLoginThrottledError(c, err) {
+		return
+	}
+
+	switch err {
+	case service.ErrInvalidPassword:
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "invalid_password",
+			Message: "Current password is incorrect",
+		})
+	case service.ErrAccountLocked:
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "account_locked",
+			Message: "Account is temporarily locked due to multiple failed login attempts",
+		})
+	case service.ErrAccountInactive:
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "account_inactive",
+			Message: "Account is inactive",
+		})
+	case service.ErrContactUnchanged:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "unchanged",
+			Message: err.Error(),
+		})
+	case service.ErrEmailAlreadyExists:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "email_exists",
+			Message: "Email already registered",
+		})
+	case service.ErrPhoneAlreadyExists:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "phone_exists",
+			Message: "Phone number already in use",
+		})
+	case service.ErrVerificationThrottled:
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+			Error:   "too_many_requests",
+			Message: "Verification code requested too recently, try again later",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "update_failed",
+			Message: err.Error(),
+		})
+	}
+}
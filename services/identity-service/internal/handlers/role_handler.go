@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Permissions checked by identity-service's own admin routes
+const (
+	PermissionRolesManage    = "roles:manage"
+	PermissionSessionsManage = "sessions:manage"
+)
+
+// ListRoles lists all roles with their permissions
+// @Summary List roles
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Role
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/roles [get]
+func (h *AuthHandler) ListRoles(c *gin.Context) {
+	roles, err := h.authService.ListRoles(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// ListPermissions lists the permissions roles can grant
+// @Summary List permissions
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Permission
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/permissions [get]
+func (h *AuthHandler) ListPermissions(c *gin.Context) {
+	permissions, err := h.authService.ListPermissions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// CreateRole creates a role
+// @Summary Create a role
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateRoleRequest true "Role"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/roles [post]
+func (h *AuthHandler) CreateRole(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	role, err := h.authService.CreateRole(c.Request.Context(), admin, &req)
+	if err != nil {
+		writeRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// SetRolePermissions replaces a role's permissions
+// @Summary Set a role's permissions
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param role path string true "Role name"
+// @Param request body models.SetRolePermissionsRequest true "Permissions"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/roles/{role}/permissions [put]
+func (h *AuthHandler) SetRolePermissions(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetRolePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.SetRolePermissions(c.Request.Context(), admin, c.Param("role"), req.Permissions); err != nil {
+		writeRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Role permissions updated",
+	})
+}
+
+// GetUserRoles returns a user's roles and permissions
+// @Summary Get a user's roles
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.UserRoles
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/roles [get]
+func (h *AuthHandler) GetUserRoles(c *gin.Context) {
+	userID, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	roles, err := h.authService.GetUserRoles(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// AssignRole gives a user a role
+// @Summary Assign a role to a user
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.AssignRoleRequest true "Role"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/roles [post]
+func (h *AuthHandler) AssignRole(c *gin.Context) {
+	userID, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req models.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.AssignRole(c.Request.Context(), admin, userID, req.Role); err != nil {
+		writeRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Role assigned",
+	})
+}
+
+// RemoveRole takes a role away from a user
+// @Summary Remove a role from a user
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param role path string true "Role name"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/roles/{role} [delete]
+func (h *AuthHandler) RemoveRole(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.authService.RemoveRole(c.Request.Context(), admin, userID, c.Param("role")); err != nil {
+		writeRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Role removed",
+	})
+}
+
+// writeRoleError writes the response for a role service error
+func writeRoleError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrRoleNotFound:
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "role_not_found",
+			Message: err.Error(),
+		})
+	case service.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: err.Error(),
+		})
+	case service.ErrRoleExists:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "role_exists",
+			Message: err.Error(),
+		})
+	case service.ErrUnknownPermission:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "unknown_permission",
+			Message: err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "role_update_failed",
+			Message: err.Error(),
+		})
+	}
+}
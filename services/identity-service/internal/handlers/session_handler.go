@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetSessions lists the current user's signed-in sessions
+// @Summary List sessions
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.ActiveSession
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/sessions [get]
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.authService.GetSessions(c.Request.Context(), userID, currentSessionID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession signs the current user out of one session
+// @Summary Revoke a session
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	h.revokeSession(c, nil, userID)
+}
+
+// RevokeAllSessions signs the current user out everywhere. With
+// ?keep_current=true the session making the request stays signed in.
+// @Summary Log out everywhere
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Param keep_current query bool false "Keep the current session"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/sessions [delete]
+func (h *AuthHandler) RevokeAllSessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var keep *uuid.UUID
+	if c.Query("keep_current") == "true" {
+		current := currentSessionID(c)
+		keep = &current
+	}
+
+	h.revokeAllSessions(c, nil, userID, keep)
+}
+
+// AdminGetSessions lists a user's signed-in sessions
+// @Summary List a user's sessions
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {array} models.ActiveSession
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/sessions [get]
+func (h *AuthHandler) AdminGetSessions(c *gin.Context) {
+	userID, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	sessions, err := h.authService.GetSessions(c.Request.Context(), userID, uuid.Nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "fetch_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// AdminRevokeSession signs a user out of one session
+// @Summary Revoke a user's session
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Param sessionId path string true "Session ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/sessions/{sessionId} [delete]
+func (h *AuthHandler) AdminRevokeSession(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	h.revokeSession(c, &admin, userID)
+}
+
+// AdminRevokeAllSessions signs a user out everywhere
+// @Summary Revoke all of a user's sessions
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/admin/users/{id}/sessions [delete]
+func (h *AuthHandler) AdminRevokeAllSessions(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	h.revokeAllSessions(c, &admin, userID, nil)
+}
+
+// revokeSession revokes one of a user's sessions, auditing it if admin is
+// set
+func (h *AuthHandler) revokeSession(c *gin.Context, admin *service.Admin, userID uuid.UUID) {
+	sessionID, ok := pathUUID(c, "sessionId")
+	if !ok {
+		return
+	}
+
+	var err error
+	if admin != nil {
+		err = h.authService.AdminRevokeSession(c.Request.Context(), *admin, userID, sessionID)
+	} else {
+		err = h.authService.RevokeSession(c.Request.Context(), userID, sessionID)
+	}
+	if err != nil {
+		if err == service.ErrSessionNotFound {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "session_not_found",
+				Message: "Session not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "revoke_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Session revoked",
+	})
+}
+
+// revokeAllSessions revokes a user's sessions, except keep if given,
+// auditing it if admin is set
+func (h *AuthHandler) revokeAllSessions(c *gin.Context, admin *service.Admin, userID uuid.UUID, keep *uuid.UUID) {
+	var revoked int
+	var err error
+	if admin != nil {
+		revoked, err = h.authService.AdminRevokeAllSessions(c.Request.Context(), *admin, userID)
+	} else {
+		revoked, err = h.authService.RevokeAllSessions(c.Request.Context(), userID, keep)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "revoke_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Sessions revoked",
+		Data:    gin.H{"revoked": revoked},
+	})
+}
+
+// currentSessionID returns the session the request's access token was
+// issued for, or uuid.Nil if the token has none
+func currentSessionID(c *gin.Context) uuid.UUID {
+	value, _ := c.Get("session_id")
+	sessionID, _ := value.(string)
+
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// pathUUID parses a UUID path parameter, writing an error response if it is
+// malformed
+func pathUUID(c *gin.Context, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param(name))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: err.Error(),
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,81 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/events"
+	"github.com/segmentio/kafka-go"
+)
+
+// CloudEvents Kafka protocol binding headers for binary content mode
+const (
+	headerID          = "ce_id"
+	headerSource      = "ce_source"
+	headerType        = "ce_type"
+	headerSpecVersion = "ce_specversion"
+	headerTime        = "ce_time"
+	headerSubject     = "ce_subject"
+	headerDataSchema  = "ce_dataschema"
+	headerContentType = "content-type"
+)
+
+// ToMessage maps an envelope to a binary-mode Kafka message: attributes go
+// in headers, the payload is the message value and the subject is the key
+func ToMessage(event *events.Envelope) kafka.Message {
+	headers := []kafka.Header{
+		{Key: headerID, Value: []byte(event.ID)},
+		{Key: headerSource, Value: []byte(event.Source)},
+		{Key: headerType, Value: []byte(event.Type)},
+		{Key: headerSpecVersion, Value: []byte(event.SpecVersion)},
+		{Key: headerTime, Value: []byte(event.Time.Format(time.RFC3339Nano))},
+		{Key: headerContentType, Value: []byte(event.DataContentType)},
+	}
+	if event.Subject != "" {
+		headers = append(headers, kafka.Header{Key: headerSubject, Value: []byte(event.Subject)})
+	}
+	if event.DataSchema != "" {
+		headers = append(headers, kafka.Header{Key: headerDataSchema, Value: []byte(event.DataSchema)})
+	}
+
+	return kafka.Message{
+		Key:     []byte(event.Subject),
+		Value:   event.Data,
+		Headers: headers,
+	}
+}
+
+// FromMessage rebuilds an envelope from a binary-mode Kafka message
+func FromMessage(msg kafka.Message) (*events.Envelope, error) {
+	event := &events.Envelope{Data: msg.Value}
+
+	for _, h := range msg.Headers {
+		value := string(h.Value)
+		switch h.Key {
+		case headerID:
+			event.ID = value
+		case headerSource:
+			event.Source = value
+		case headerType:
+			event.Type = value
+		case headerSpecVersion:
+			event.SpecVersion = value
+		case headerSubject:
+			event.Subject = value
+		case headerDataSchema:
+			event.DataSchema = value
+		case headerContentType:
+			event.DataContentType = value
+		case headerTime:
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, err
+			}
+			event.Time = t
+		}
+	}
+
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -2,23 +2,13 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/Caesarsage/bankflow/identity-service/internal/events"
 	"github.com/segmentio/kafka-go"
 )
 
-type Event struct {
-	EventID   string                 `json:"event_id"`
-	EventType string                 `json:"event_type"`
-	UserID    uuid.UUID              `json:"user_id"`
-	Email     string                 `json:"email"`
-	Data      map[string]interface{} `json:"data"`
-	Timestamp time.Time              `json:"timestamp"`
-}
-
 type Producer struct {
 	writer *kafka.Writer
 }
@@ -27,35 +17,38 @@ func NewProducer(brokers []string, topic string) *Producer {
 	writer := &kafka.Writer{
 		Addr:         kafka.TCP(brokers...),
 		Topic:        topic,
-		Balancer:     &kafka.LeastBytes{},
+		Balancer:     &kafka.Hash{}, // same key, same partition, preserving per-user order
 		BatchSize:    100,
 		BatchTimeout: 10 * time.Millisecond,
-		RequiredAcks: kafka.RequireOne,
+		RequiredAcks: kafka.RequireAll, // an acknowledged event survives leader failover
 	}
 
 	return &Producer{writer: writer}
 }
 
-// PublishEvent publishes an event to Kafka
-func (p *Producer) PublishEvent(ctx context.Context, event *Event) error {
-	eventJSON, err := json.Marshal(event)
-	if err != nil {
-		return err
-	}
-
-	message := kafka.Message{
-		Key:   []byte(event.UserID.String()),
-		Value: eventJSON,
-		Time:  time.Now(),
+// WriteErrors is returned by PublishEvents when only some events failed,
+// holding the error of each event in order, nil for those published
+type WriteErrors = kafka.WriteErrors
+
+// PublishEvents publishes events to Kafka in CloudEvents binary mode in a
+// single write, so they share produce requests instead of each waiting out
+// the batch timeout. Events with the same subject go to the same partition
+// in the order given.
+func (p *Producer) PublishEvents(ctx context.Context, envelopes []*events.Envelope) error {
+	now := time.Now()
+	messages := make([]kafka.Message, len(envelopes))
+	for i, event := range envelopes {
+		messages[i] = ToMessage(event)
+		messages[i].Time = now
 	}
 
-	err = p.writer.WriteMessages(ctx, message)
+	err := p.writer.WriteMessages(ctx, messages...)
 	if err != nil {
-		log.Printf("Failed to publish event: %v", err)
+		log.Printf("Failed to publish events: %v", err)
 		return err
 	}
 
-	log.Printf("Published event: %s for user: %s", event.EventType, event.UserID)
+	log.Printf("Published %d event(s)", len(envelopes))
 	return nil
 }
 
@@ -1,15 +1,28 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/revocation"
 	"github.com/Caesarsage/bankflow/identity-service/pkg/jwt"
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(jwtManager *jwt.JWTManager) gin.HandlerFunc {
+// RevocationChecker rejects validated access tokens that have since been
+// revoked
+type RevocationChecker interface {
+	CheckAccessToken(ctx context.Context, claims *jwt.Claims) error
+}
+
+// AuthMiddleware validates the bearer token with the given validator: a
+// *jwt.JWTManager inside identity-service, or a *jwt.JWKSValidator elsewhere.
+// Valid tokens are then checked for revocation by checker, if not nil.
+func AuthMiddleware(validator jwt.AccessTokenValidator, checker RevocationChecker) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		// Get Authorization header
 		authHeader := ctx.GetHeader("Authorization")
@@ -35,7 +48,7 @@ func AuthMiddleware(jwtManager *jwt.JWTManager) gin.HandlerFunc {
 
 		// Validate token
 		token := parts[1]
-		claims, err := jwtManager.ValidateAccessToken(token)
+		claims, err := validator.ValidateAccessToken(token)
 		if err != nil {
 			ctx.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Error: "invalid_token",
@@ -45,14 +58,109 @@ func AuthMiddleware(jwtManager *jwt.JWTManager) gin.HandlerFunc {
 			return
 		}
 
+		if checker != nil {
+			if err := checker.CheckAccessToken(ctx.Request.Context(), claims); err == revocation.ErrTokenRevoked {
+				ctx.JSON(http.StatusUnauthorized, models.ErrorResponse{
+					Error:   "token_revoked",
+					Message: err.Error(),
+				})
+				ctx.Abort()
+				return
+			} else if err != nil {
+				// Fail closed, a revoked token must not slip through
+				ctx.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+					Error:   "revocation_check_failed",
+					Message: "Unable to verify token, try again later",
+				})
+				ctx.Abort()
+				return
+			}
+		}
+
 		// Set user info in context
 		ctx.Set("user_id", claims.UserID)
 		ctx.Set("email", claims.Email)
+		ctx.Set("email_verified", claims.EmailVerified)
+		ctx.Set("phone_verified", claims.PhoneVerified)
+		ctx.Set("session_id", claims.SessionID)
+		ctx.Set("roles", claims.Roles)
+		ctx.Set("permissions", claims.Permissions)
+		ctx.Set("client_id", claims.ClientID)
+		ctx.Set("scope", claims.Scope)
+		ctx.Set("amr", claims.AMR)
+		if claims.AuthTime != nil {
+			ctx.Set("auth_time", claims.AuthTime.Time)
+		}
 
 		ctx.Next()
 	}
 }
 
+// RequirePermission allows only requests whose access token grants
+// permission. It must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		value, _ := ctx.Get("permissions")
+		permissions, _ := value.([]string)
+
+		for _, p := range permissions {
+			if p == permission {
+				ctx.Next()
+				return
+			}
+		}
+
+		ctx.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "forbidden",
+			Message: "Missing permission " + permission,
+		})
+		ctx.Abort()
+	}
+}
+
+// RejectClientTokens allows only tokens from an interactive sign-in,
+// rejecting those issued to OAuth clients and API keys, so a leaked machine
+// credential cannot manage the account it belongs to. It must run after
+// AuthMiddleware.
+func RejectClientTokens() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if clientID := ctx.GetString("client_id"); clientID != "" {
+			ctx.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "client_token_not_allowed",
+				Message: "This endpoint requires a user sign-in, not a client token",
+			})
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// RequireStepUp allows only tokens whose user authenticated within maxAge,
+// at login or through /auth/step-up. Other requests get the step-up
+// challenge of RFC 9470, so clients know to step up and retry. It must run
+// after AuthMiddleware.
+func RequireStepUp(maxAge time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authTime := ctx.GetTime("auth_time")
+		if !authTime.IsZero() && time.Since(authTime) <= maxAge {
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("WWW-Authenticate", fmt.Sprintf(
+			`Bearer error="insufficient_user_authentication", error_description="A more recent authentication is required", max_age="%d"`,
+			int(maxAge.Seconds()),
+		))
+		ctx.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "step_up_required",
+			Message: "Re-authenticate with /auth/step-up and retry with the new token",
+		})
+		ctx.Abort()
+	}
+}
+
 // CORS middleware
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserListQuery filters and pages the admin user list. Q matches part of an
+// email or phone number; unset filters match every user.
+type UserListQuery struct {
+	Q        string `json:"q" form:"q" binding:"max=255"`
+	Verified *bool  `json:"verified" form:"verified"`
+	Active   *bool  `json:"active" form:"active"`
+	Locked   *bool  `json:"locked" form:"locked"`
+	Page     int    `json:"page" form:"page" binding:"omitempty,min=1"`
+	PageSize int    `json:"page_size" form:"page_size" binding:"omitempty,min=1,max=100"`
+}
+
+// UserList is one page of users, newest first
+type UserList struct {
+	Users    []*User `json:"users"`
+	Total    int     `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"page_size"`
+}
+
+// LoginHistoryQuery limits how many of a user's logins are returned
+type LoginHistoryQuery struct {
+	Limit int `json:"limit" form:"limit" binding:"omitempty,min=1,max=200"`
+}
+
+// AdminActionRequest is the optional body of an admin action on a user
+type AdminActionRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// AuditLogQuery filters and pages the admin audit log
+type AuditLogQuery struct {
+	AdminID  string `json:"admin_id" form:"admin_id" binding:"omitempty,uuid"`
+	UserID   string `json:"user_id" form:"user_id" binding:"omitempty,uuid"`
+	Action   string `json:"action" form:"action"`
+	Page     int    `json:"page" form:"page" binding:"omitempty,min=1"`
+	PageSize int    `json:"page_size" form:"page_size" binding:"omitempty,min=1,max=100"`
+}
+
+// AuditEntry records one action an admin took, who it was taken on and
+// anything needed to tell what it did
+type AuditEntry struct {
+	ID           uuid.UUID       `json:"id" db:"id"`
+	AdminID      uuid.UUID       `json:"admin_id" db:"admin_id"`
+	Action       string          `json:"action" db:"action"`
+	TargetUserID *uuid.UUID      `json:"target_user_id,omitempty" db:"target_user_id"`
+	Details      json.RawMessage `json:"details" db:"details" swaggertype:"object"`
+	IPAddress    *string         `json:"ip_address,omitempty" db:"ip_address"`
+	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+}
+
+// AuditLog is one page of the admin audit log, newest first
+type AuditLog struct {
+	Entries  []*AuditEntry `json:"entries"`
+	Total    int           `json:"total"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserMFA represents a user's TOTP enrollment. The secret is encrypted at
+// rest; ConfirmedAt is nil until the user proves they can generate codes.
+type UserMFA struct {
+	UserID          uuid.UUID  `json:"user_id" db:"user_id"`
+	SecretEncrypted string     `json:"-" db:"secret_encrypted"`
+	ConfirmedAt     *time.Time `json:"confirmed_at,omitempty" db:"confirmed_at"`
+	LastUsedStep    int64      `json:"-" db:"last_used_step"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+}
+
+// MFA challenge methods
+const (
+	MFAMethodTOTP  = "totp"
+	MFAMethodEmail = "email"
+)
+
+// MFAChallenge represents a login that passed the password check and is
+// waiting for a second factor. Email challenges are answered with the code
+// in CodeHash, which was sent to the user; TOTP challenges with a code from
+// their authenticator or a recovery code.
+type MFAChallenge struct {
+	ID                uuid.UUID  `json:"id" db:"id"`
+	UserID            uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenHash         string     `json:"-" db:"token_hash"`
+	Attempts          int        `json:"attempts" db:"attempts"`
+	IPAddress         *string    `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent         *string    `json:"user_agent,omitempty" db:"user_agent"`
+	DeviceFingerprint *string    `json:"device_fingerprint,omitempty" db:"device_fingerprint"`
+	Method            string     `json:"method" db:"method"`
+	CodeHash          *string    `json:"-" db:"code_hash"`
+	ExpiresAt         time.Time  `json:"expires_at" db:"expires_at"`
+	ConsumedAt        *time.Time `json:"consumed_at,omitempty" db:"consumed_at"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+}
+
+// MFAEnrollment represents a pending TOTP enrollment
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFACodeRequest represents a TOTP code input
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// MFARecoveryCodes represents newly issued recovery codes, shown once
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAVerifyRequest represents the second login step. Either Code or
+// RecoveryCode is required; Code is the emailed code when the challenge's
+// method is email.
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code"`
+}
+
+// MFADisableRequest represents MFA disable input. The password and a TOTP
+// or recovery code are both required.
+type MFADisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
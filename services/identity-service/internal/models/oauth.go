@@ -0,0 +1,168 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuthClient is an application registered with identity-service. Machine
+// clients use the client_credentials grant; web and mobile apps use the
+// authorization code grant with their registered redirect URIs. Public
+// clients (mobile apps, SPAs) have no secret. Only a hash of the secret is
+// stored.
+type OAuthClient struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	ClientID     string     `json:"client_id" db:"client_id"`
+	SecretHash   string     `json:"-" db:"secret_hash"`
+	Name         string     `json:"name" db:"name"`
+	Scopes       []string   `json:"scopes" db:"scopes"`
+	RedirectURIs []string   `json:"redirect_uris" db:"redirect_uris"`
+	Public       bool       `json:"public" db:"public"`
+	CreatedBy    *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// APIKey is a long-lived credential a user creates for scripts and batch
+// jobs. Keys are looked up by their public prefix; only a hash of the full
+// key is stored.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	KeyHash    string     `json:"-" db:"key_hash"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreateOAuthClientRequest represents OAuth client registration input.
+// Scopes are the permissions and OpenID scopes the client may request.
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	Scopes       []string `json:"scopes" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris" binding:"dive,url"`
+	Public       bool     `json:"public"`
+}
+
+// OAuthClientCredentials represents a newly registered client. The secret
+// is shown once; public clients have none.
+type OAuthClientCredentials struct {
+	Client       *OAuthClient `json:"client"`
+	ClientSecret string       `json:"client_secret,omitempty"`
+}
+
+// AuthorizationCode is a single-use code issued to a client when a user
+// authorizes it, bound to the redirect URI and PKCE challenge of the request.
+// RedirectURI is empty if the request left it to the client's only one.
+type AuthorizationCode struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	CodeHash      string     `json:"-" db:"code_hash"`
+	ClientID      string     `json:"client_id" db:"client_id"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
+	RedirectURI   string     `json:"redirect_uri" db:"redirect_uri"`
+	Scopes        []string   `json:"scopes" db:"scopes"`
+	Nonce         *string    `json:"nonce,omitempty" db:"nonce"`
+	CodeChallenge string     `json:"-" db:"code_challenge"`
+	ExpiresAt     time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt        *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// OAuthConsent records the scopes a user has allowed a client, so later
+// authorizations within them need no prompt
+type OAuthConsent struct {
+	UserID     uuid.UUID `json:"user_id" db:"user_id"`
+	ClientID   string    `json:"client_id" db:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes" db:"scopes"`
+	GrantedAt  time.Time `json:"granted_at" db:"granted_at"`
+}
+
+// AuthorizeRequest is an OAuth2 authorization request (RFC 6749 section
+// 4.1.1) with PKCE (RFC 7636), made by the signed-in user's app. Approve
+// records consent for the requested scopes.
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type" form:"response_type" binding:"required"`
+	ClientID            string `json:"client_id" form:"client_id" binding:"required"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	Nonce               string `json:"nonce" form:"nonce"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+	Prompt              string `json:"prompt" form:"prompt"`
+	Approve             bool   `json:"approve" form:"approve"`
+}
+
+// AuthorizeResponse tells the user's app where to send the browser, or that
+// the user must first consent to the listed scopes
+type AuthorizeResponse struct {
+	RedirectURI     string   `json:"redirect_uri,omitempty"`
+	ConsentRequired bool     `json:"consent_required,omitempty"`
+	ClientName      string   `json:"client_name,omitempty"`
+	Scopes          []string `json:"scopes,omitempty"`
+}
+
+// UserInfo is the OpenID Connect UserInfo response. Claims beyond sub
+// depend on the scopes granted to the token.
+type UserInfo struct {
+	Subject             string `json:"sub"`
+	Email               string `json:"email,omitempty"`
+	EmailVerified       *bool  `json:"email_verified,omitempty"`
+	PhoneNumber         string `json:"phone_number,omitempty"`
+	PhoneNumberVerified *bool  `json:"phone_number_verified,omitempty"`
+}
+
+// OpenIDConfiguration is the OpenID Provider metadata served at
+// /.well-known/openid-configuration
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// CreateAPIKeyRequest represents API key creation input. Scopes must be
+// permissions the user holds; ExpiresIn is in days, never expiring if zero.
+type CreateAPIKeyRequest struct {
+	Name      string   `json:"name" binding:"required,max=100"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int      `json:"expires_in_days" binding:"min=0,max=365"`
+}
+
+// CreatedAPIKey represents a newly created API key. The key is shown once.
+type CreatedAPIKey struct {
+	APIKey *APIKey `json:"api_key"`
+	Key    string  `json:"key"`
+}
+
+// OAuthTokenResponse is the token endpoint response (RFC 6749 section 5.1)
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// OAuthErrorResponse is the token endpoint error response (RFC 6749
+// section 5.2)
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxEvent represents an event recorded alongside a state change and
+// waiting to be relayed to Kafka
+type OutboxEvent struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	AggregateID   uuid.UUID  `json:"aggregate_id" db:"aggregate_id"`
+	EventType     string     `json:"event_type" db:"event_type"`
+	Payload       []byte     `json:"payload" db:"payload"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	LastError     *string    `json:"last_error,omitempty" db:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
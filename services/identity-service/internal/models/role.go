@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Role is a named set of permissions that can be assigned to users
+type Role struct {
+	Name        string    `json:"name" db:"name"`
+	Description *string   `json:"description,omitempty" db:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// Permission is a single action a role can grant, e.g. accounts:freeze
+type Permission struct {
+	Name        string  `json:"name" db:"name"`
+	Description *string `json:"description,omitempty" db:"description"`
+}
+
+// UserRoles represents a user's roles and the permissions they grant
+type UserRoles struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Roles       []string  `json:"roles"`
+	Permissions []string  `json:"permissions"`
+}
+
+// CreateRoleRequest represents role creation input
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Description *string  `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// SetRolePermissionsRequest replaces a role's permissions
+type SetRolePermissionsRequest struct {
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// AssignRoleRequest represents role assignment input
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
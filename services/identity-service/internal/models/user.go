@@ -7,48 +7,135 @@ import (
 )
 
 type User struct {
-	ID                  uuid.UUID  `json:"id" db:"id"`
-	Email               string     `json:"email" db:"email"`
-	Phone               *string    `json:"phone,omitempty" db:"phone"`
-	PasswordHash        string     `json:"-" db:"password_hash"`
-	IsVerified          bool       `json:"is_verified" db:"is_verified"`
-	IsActive            bool       `json:"is_active" db:"is_active"`
-	FailedLoginAttempts int        `json:"failed_login_attempts" db:"failed_login_attempts"`
-	LockedUntil         *time.Time `json:"locked_until,omitempty" db:"locked_until"`
-	LastLogin           *time.Time `json:"last_login,omitempty" db:"last_login"`
-	CreatedAt           time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt           time.Time  `json:"updated_at" db:"updated_at"`
+	ID                    uuid.UUID  `json:"id" db:"id"`
+	Email                 string     `json:"email" db:"email"`
+	Phone                 *string    `json:"phone,omitempty" db:"phone"`
+	PasswordHash          string     `json:"-" db:"password_hash"`
+	IsVerified            bool       `json:"is_verified" db:"is_verified"`
+	EmailVerified         bool       `json:"email_verified" db:"email_verified"`
+	PhoneVerified         bool       `json:"phone_verified" db:"phone_verified"`
+	MFAEnabled            bool       `json:"mfa_enabled" db:"mfa_enabled"`
+	IsActive              bool       `json:"is_active" db:"is_active"`
+	PasswordResetRequired bool       `json:"password_reset_required" db:"password_reset_required"`
+	FailedLoginAttempts   int        `json:"failed_login_attempts" db:"failed_login_attempts"`
+	LockedUntil           *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+	LastLogin             *time.Time `json:"last_login,omitempty" db:"last_login"`
+	CreatedAt             time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at" db:"updated_at"`
 }
 
+// Session represents one refresh token. Each refresh rotates the token into
+// a new session in the same family; the old session is kept, marked rotated,
+// so a replay of its token can be detected. AuthTime and AMR record the
+// login that started the family and are carried into its access tokens.
 type Session struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	UserID       uuid.UUID `json:"user_id" db:"user_id"`
-	RefreshToken string    `json:"refresh_token" db:"refresh_token"`
-	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
-	IPAddress    *string   `json:"ip_address,omitempty" db:"ip_address"`
-	UserAgent    *string   `json:"user_agent,omitempty" db:"user_agent"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	ID               uuid.UUID  `json:"id" db:"id"`
+	UserID           uuid.UUID  `json:"user_id" db:"user_id"`
+	RefreshTokenHash string     `json:"-" db:"refresh_token_hash"`
+	FamilyID         uuid.UUID  `json:"family_id" db:"family_id"`
+	ParentID         *uuid.UUID `json:"parent_id,omitempty" db:"parent_id"`
+	RotatedAt        *time.Time `json:"rotated_at,omitempty" db:"rotated_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	ExpiresAt        time.Time  `json:"expires_at" db:"expires_at"`
+	IPAddress        *string    `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent        *string    `json:"user_agent,omitempty" db:"user_agent"`
+	AuthTime         *time.Time `json:"auth_time,omitempty" db:"auth_time"`
+	AMR              []string   `json:"amr" db:"amr"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ActiveSession represents a signed-in device: the live session of a
+// refresh token family. ID is the family ID, which stays the same across
+// refreshes.
+type ActiveSession struct {
+	ID         uuid.UUID `json:"id"`
+	IPAddress  *string   `json:"ip_address,omitempty"`
+	UserAgent  *string   `json:"user_agent,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// LoginRecord represents a completed login: the client it came from, where
+// its IP address is registered when a GeoIP database is configured, and why
+// it looked suspicious, if it did
+type LoginRecord struct {
+	ID                uuid.UUID  `json:"id" db:"id"`
+	UserID            uuid.UUID  `json:"user_id" db:"user_id"`
+	SessionID         *uuid.UUID `json:"session_id,omitempty" db:"session_id"`
+	IPAddress         *string    `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent         *string    `json:"user_agent,omitempty" db:"user_agent"`
+	DeviceFingerprint *string    `json:"device_fingerprint,omitempty" db:"device_fingerprint"`
+	Country           *string    `json:"country,omitempty" db:"country"`
+	City              *string    `json:"city,omitempty" db:"city"`
+	Latitude          *float64   `json:"latitude,omitempty" db:"latitude"`
+	Longitude         *float64   `json:"longitude,omitempty" db:"longitude"`
+	SuspiciousReasons []string   `json:"suspicious_reasons" db:"suspicious_reasons"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+}
+
+// PasswordResetToken represents a single-use password reset token. Only the
+// SHA-256 of the token is stored.
+type PasswordResetToken struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// VerificationChannel represents where a verification code is delivered
+type VerificationChannel string
+
+const (
+	VerificationChannelEmail VerificationChannel = "EMAIL"
+	VerificationChannelPhone VerificationChannel = "PHONE"
+)
+
+// VerificationCode represents an email verification link token or a phone
+// one-time code. Only the SHA-256 of the code is stored.
+type VerificationCode struct {
+	ID          uuid.UUID           `json:"id" db:"id"`
+	UserID      uuid.UUID           `json:"user_id" db:"user_id"`
+	Channel     VerificationChannel `json:"channel" db:"channel"`
+	Destination string              `json:"destination" db:"destination"`
+	CodeHash    string              `json:"-" db:"code_hash"`
+	Attempts    int                 `json:"attempts" db:"attempts"`
+	ExpiresAt   time.Time           `json:"expires_at" db:"expires_at"`
+	ConsumedAt  *time.Time          `json:"consumed_at,omitempty" db:"consumed_at"`
+	CreatedAt   time.Time           `json:"created_at" db:"created_at"`
 }
 
 // RegisterRequest represents registration input
 type RegisterRequest struct {
 	Email    string  `json:"email" binding:"required,email"`
 	Phone    *string `json:"phone"`
-	Password string  `json:"password" binding:"required,min=8"`
+	Password string  `json:"password" binding:"required"`
 }
 
-// LoginRequest represents login input
+// LoginRequest represents login input. DeviceID is an optional identifier
+// the app keeps on the device, such as a per-install UUID; without it the
+// device is recognised by its user agent.
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	DeviceID string `json:"device_id" binding:"omitempty,max=128"`
 }
 
-// LoginResponse represents login output
+// LoginResponse represents login output. When MFA is required it carries
+// only the challenge token to pass to the MFA verify endpoint, and the
+// method that produces the code: totp, or email for a suspicious login
+// stepped up with a code sent to a user without MFA.
 type LoginResponse struct {
-	User         *User  `json:"user"`
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int64  `json:"expires_in"`
+	User         *User  `json:"user,omitempty"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+	MFAMethod    string `json:"mfa_method,omitempty"`
 }
 
 // RefreshTokenRequest represents refresh token input
@@ -64,7 +151,57 @@ type PasswordResetRequest struct {
 // PasswordResetConfirm represents password reset confirmation
 type PasswordResetConfirm struct {
 	Token       string `json:"token" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=8"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ChangePasswordRequest represents a signed-in user's password change
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangeEmailRequest starts an email change. The new address takes effect
+// once the link sent to it is verified.
+type ChangeEmailRequest struct {
+	Email           string `json:"email" binding:"required,email"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+// ChangePhoneRequest starts a phone number change. The new number takes
+// effect once the code sent to it is verified.
+type ChangePhoneRequest struct {
+	Phone           string `json:"phone" binding:"required,e164"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+// StepUpRequest re-authenticates a signed-in user with either their
+// password or a TOTP code
+type StepUpRequest struct {
+	Password string `json:"password" binding:"required_without=Code"`
+	Code     string `json:"code" binding:"required_without=Password,omitempty,len=6,numeric"`
+}
+
+// StepUpResponse carries a short-lived access token whose auth_time is the
+// moment of the step-up, for operations that need recent authentication
+type StepUpResponse struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresIn   int64     `json:"expires_in"`
+	AuthTime    time.Time `json:"auth_time"`
+}
+
+// VerifyEmailRequest represents email verification input
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResendVerificationRequest represents a request to resend the email verification link
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// VerifyPhoneRequest represents phone verification input
+type VerifyPhoneRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
 }
 
 // ErrorResponse represents error output
@@ -73,6 +210,20 @@ type ErrorResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
+// PasswordViolation is a password policy rule a new password breaks
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyErrorResponse represents a rejected password with the rules
+// it breaks
+type PasswordPolicyErrorResponse struct {
+	Error      string              `json:"error"`
+	Message    string              `json:"message,omitempty"`
+	Violations []PasswordViolation `json:"violations"`
+}
+
 // SuccessResponse represents success output
 type SuccessResponse struct {
 	Message string      `json:"message"`
@@ -0,0 +1,103 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rangePrefixLength is the length of the hash prefix that selects a range,
+// as in the Pwned Passwords range API
+const rangePrefixLength = 5
+
+// BreachedList is an offline list of breached passwords in the Pwned
+// Passwords download format: one uppercase SHA-1 hash per line, optionally
+// followed by a colon and the number of times it was seen. Like the range
+// API, lookups use the k-anonymity model: the first five hex characters of
+// the hash select a range and only the suffixes in that range are compared,
+// so the list can later be served from a range service without changing
+// callers.
+type BreachedList struct {
+	ranges map[string][]string
+	size   int
+}
+
+// LoadBreachedList loads a hash list file, skipping hashes seen fewer than
+// minCount times. Blank lines and lines starting with # are ignored.
+func LoadBreachedList(path string, minCount int) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &BreachedList{ranges: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash, countText, hasCount := strings.Cut(text, ":")
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("%s:%d: invalid SHA-1 hash", path, line)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid SHA-1 hash", path, line)
+		}
+
+		if hasCount {
+			count, err := strconv.Atoi(countText)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid count", path, line)
+			}
+			if count < minCount {
+				continue
+			}
+		}
+
+		hash = strings.ToUpper(hash)
+		prefix := hash[:rangePrefixLength]
+		list.ranges[prefix] = append(list.ranges[prefix], hash[rangePrefixLength:])
+		list.size++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, suffixes := range list.ranges {
+		sort.Strings(suffixes)
+	}
+
+	return list, nil
+}
+
+// Len returns the number of hashes in the list
+func (l *BreachedList) Len() int {
+	return l.size
+}
+
+// Range returns the sorted hash suffixes for a five-character prefix
+func (l *BreachedList) Range(prefix string) []string {
+	return l.ranges[strings.ToUpper(prefix)]
+}
+
+// Contains reports whether a password is in the list
+func (l *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes := l.Range(hash[:rangePrefixLength])
+	suffix := hash[rangePrefixLength:]
+	i := sort.SearchStrings(suffixes, suffix)
+	return i < len(suffixes) && suffixes[i] == suffix
+}
@@ -0,0 +1,162 @@
+package password
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+)
+
+// MaxBytes is the longest password bcrypt accepts
+const MaxBytes = 72
+
+// Violation codes returned to clients
+const (
+	ViolationTooShort      = "too_short"
+	ViolationTooLong       = "too_long"
+	ViolationMissingLower  = "missing_lowercase"
+	ViolationMissingUpper  = "missing_uppercase"
+	ViolationMissingDigit  = "missing_digit"
+	ViolationMissingSymbol = "missing_symbol"
+	ViolationContainsEmail = "contains_email"
+	ViolationBreached      = "breached"
+	ViolationReused        = "reused"
+)
+
+// Class is a character class a password can be required to contain
+type Class string
+
+const (
+	ClassLower  Class = "lower"
+	ClassUpper  Class = "upper"
+	ClassDigit  Class = "digit"
+	ClassSymbol Class = "symbol"
+)
+
+// ParseClasses parses a comma-separated list of character classes
+func ParseClasses(value string) ([]Class, error) {
+	classes := []Class{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		switch Class(name) {
+		case "":
+			continue
+		case ClassLower, ClassUpper, ClassDigit, ClassSymbol:
+			classes = append(classes, Class(name))
+		default:
+			return nil, errors.New("unknown character class " + name)
+		}
+	}
+	return classes, nil
+}
+
+// Policy is the set of rules new passwords must follow. Reuse of the last
+// History passwords is checked by the caller, which holds the hashes.
+type Policy struct {
+	MinLength int
+	Require   []Class
+	History   int
+	Breached  *BreachedList
+}
+
+// DefaultPolicy is the policy used when none is configured
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinLength: 8,
+		Require:   []Class{},
+	}
+}
+
+// Check returns the rules a password breaks, or nil if it follows them all.
+// The password must not contain the user's email or its local part.
+func (p *Policy) Check(password, email string) []models.PasswordViolation {
+	var violations []models.PasswordViolation
+	add := func(code, message string) {
+		violations = append(violations, models.PasswordViolation{Code: code, Message: message})
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		add(ViolationTooShort, "Password must be at least "+strconv.Itoa(p.MinLength)+" characters")
+	}
+	if len(password) > MaxBytes {
+		add(ViolationTooLong, "Password must be at most "+strconv.Itoa(MaxBytes)+" bytes")
+	}
+
+	for _, class := range p.Require {
+		if !containsClass(password, class) {
+			switch class {
+			case ClassLower:
+				add(ViolationMissingLower, "Password must contain a lowercase letter")
+			case ClassUpper:
+				add(ViolationMissingUpper, "Password must contain an uppercase letter")
+			case ClassDigit:
+				add(ViolationMissingDigit, "Password must contain a digit")
+			case ClassSymbol:
+				add(ViolationMissingSymbol, "Password must contain a symbol")
+			}
+		}
+	}
+
+	if containsEmail(password, email) {
+		add(ViolationContainsEmail, "Password must not contain your email address")
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		add(ViolationBreached, "Password has appeared in a data breach")
+	}
+
+	return violations
+}
+
+// ReusedViolation is the violation for a password in the user's history
+func ReusedViolation() models.PasswordViolation {
+	return models.PasswordViolation{
+		Code:    ViolationReused,
+		Message: "Password must not match a recently used password",
+	}
+}
+
+func containsClass(password string, class Class) bool {
+	for _, r := range password {
+		switch class {
+		case ClassLower:
+			if unicode.IsLower(r) {
+				return true
+			}
+		case ClassUpper:
+			if unicode.IsUpper(r) {
+				return true
+			}
+		case ClassDigit:
+			if unicode.IsDigit(r) {
+				return true
+			}
+		case ClassSymbol:
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsEmail reports whether a password contains an email address or
+// its local part, ignoring case. Local parts under three characters are too
+// common to check.
+func containsEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+
+	password = strings.ToLower(password)
+	email = strings.ToLower(email)
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 3 && strings.Contains(password, local)
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Store counts failures per key and records how long a key is blocked.
+// Counts and blocks expire on their own.
+type Store interface {
+	// Fail records a failure for key and returns the number of failures
+	// within window of the first one
+	Fail(ctx context.Context, key string, window time.Duration) (int, error)
+	// Block blocks key for d
+	Block(ctx context.Context, key string, d time.Duration) error
+	// Blocked returns how much longer key is blocked, or zero
+	Blocked(ctx context.Context, key string) (time.Duration, error)
+	// Reset clears key's failures and block
+	Reset(ctx context.Context, key string) error
+}
+
+// Rule is the backoff for one kind of key. Once a key has Threshold
+// failures, each further failure blocks it for BaseDelay doubled per failure
+// past the threshold, up to MaxDelay. A zero Threshold disables the rule.
+type Rule struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Delay returns how long a key with the given number of failures is blocked
+func (r Rule) Delay(failures int) time.Duration {
+	if r.Threshold <= 0 || failures < r.Threshold {
+		return 0
+	}
+
+	delay := r.BaseDelay
+	for i := r.Threshold; i < failures && delay < r.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.MaxDelay {
+		delay = r.MaxDelay
+	}
+	return delay
+}
+
+// Key is a rate-limited key with the rule that applies to it
+type Key struct {
+	Name string
+	Rule Rule
+}
+
+// Limiter applies exponential backoff to keys that keep failing
+type Limiter struct {
+	store  Store
+	window time.Duration
+}
+
+// NewLimiter creates a limiter that forgets failures window after the first
+// one of a run
+func NewLimiter(store Store, window time.Duration) *Limiter {
+	return &Limiter{
+		store:  store,
+		window: window,
+	}
+}
+
+// Check returns how long until every key may be tried again, or zero if none
+// is blocked
+func (l *Limiter) Check(ctx context.Context, keys ...Key) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range keys {
+		if key.Rule.Threshold <= 0 {
+			continue
+		}
+
+		blocked, err := l.store.Blocked(ctx, key.Name)
+		if err != nil {
+			return 0, err
+		}
+		if blocked > wait {
+			wait = blocked
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failure for each key and blocks those past their threshold
+func (l *Limiter) Fail(ctx context.Context, keys ...Key) error {
+	for _, key := range keys {
+		if key.Rule.Threshold <= 0 {
+			continue
+		}
+
+		failures, err := l.store.Fail(ctx, key.Name, l.window)
+		if err != nil {
+			return err
+		}
+
+		if delay := key.Rule.Delay(failures); delay > 0 {
+			if err := l.store.Block(ctx, key.Name, delay); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Reset clears the failures and blocks of each key
+func (l *Limiter) Reset(ctx context.Context, keys ...Key) error {
+	for _, key := range keys {
+		if err := l.store.Reset(ctx, key.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/ratelimit"
+)
+
+func TestRuleDelay(t *testing.T) {
+	rule := ratelimit.Rule{
+		Threshold: 5,
+		BaseDelay: time.Second,
+		MaxDelay:  time.Minute,
+	}
+
+	tests := []struct {
+		name     string
+		rule     ratelimit.Rule
+		failures int
+		want     time.Duration
+	}{
+		{"no failures", rule, 0, 0},
+		{"below threshold", rule, 4, 0},
+		{"at threshold", rule, 5, time.Second},
+		{"one past threshold", rule, 6, 2 * time.Second},
+		{"two past threshold", rule, 7, 4 * time.Second},
+		{"five past threshold", rule, 10, 32 * time.Second},
+		{"reaches cap", rule, 11, time.Minute},
+		{"stays at cap", rule, 1000, time.Minute},
+		{"base above cap", ratelimit.Rule{Threshold: 1, BaseDelay: time.Hour, MaxDelay: time.Minute}, 1, time.Minute},
+		{"disabled", ratelimit.Rule{BaseDelay: time.Second, MaxDelay: time.Minute}, 100, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Delay(tt.failures); got != tt.want {
+				t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimiterBlocksPastThreshold(t *testing.T) {
+	ctx := context.Background()
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), time.Hour)
+	key := ratelimit.Key{
+		Name: "login:user@example.com",
+		Rule: ratelimit.Rule{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour},
+	}
+
+	for i := 1; i <= 3; i++ {
+		if wait, err := limiter.Check(ctx, key); err != nil || wait != 0 {
+			t.Fatalf("Check before failure %d = %v, %v, want 0, nil", i, wait, err)
+		}
+		if err := limiter.Fail(ctx, key); err != nil {
+			t.Fatalf("Fail: %v", err)
+		}
+	}
+
+	wait, err := limiter.Check(ctx, key)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if wait <= 0 || wait > time.Minute {
+		t.Errorf("Check at threshold = %v, want up to %v", wait, time.Minute)
+	}
+
+	if err := limiter.Reset(ctx, key); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if wait, err := limiter.Check(ctx, key); err != nil || wait != 0 {
+		t.Errorf("Check after reset = %v, %v, want 0, nil", wait, err)
+	}
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxMemoryEntries bounds the memory store; expired entries are swept when
+// it grows past this
+const maxMemoryEntries = 100000
+
+type memoryEntry struct {
+	failures     int
+	expiresAt    time.Time
+	blockedUntil time.Time
+}
+
+// MemoryStore keeps failures in process memory. Each instance counts on its
+// own, so limits are per instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]*memoryEntry{},
+	}
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry := s.entries[key]
+	if entry == nil || now.After(entry.expiresAt) {
+		if len(s.entries) >= maxMemoryEntries {
+			s.sweep(now)
+		}
+		entry = &memoryEntry{expiresAt: now.Add(window), blockedUntil: blockedUntil(entry)}
+		s.entries[key] = entry
+	}
+
+	entry.failures++
+	return entry.failures, nil
+}
+
+func (s *MemoryStore) Block(ctx context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry := s.entries[key]
+	if entry == nil {
+		entry = &memoryEntry{expiresAt: now}
+		s.entries[key] = entry
+	}
+	entry.blockedUntil = now.Add(d)
+	return nil
+}
+
+func (s *MemoryStore) Blocked(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entries[key]
+	if entry == nil {
+		return 0, nil
+	}
+
+	if wait := time.Until(entry.blockedUntil); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep deletes entries whose window and block have both passed
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, entry := range s.entries {
+		if now.After(entry.expiresAt) && now.After(entry.blockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func blockedUntil(entry *memoryEntry) time.Time {
+	if entry == nil {
+		return time.Time{}
+	}
+	return entry.blockedUntil
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps failures in Redis, so limits are shared by every
+// instance. Counts and blocks are separate keys that expire on their own.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{
+		client: client,
+	}
+}
+
+func failuresKey(key string) string {
+	return "login_failures:" + key
+}
+
+func blockKey(key string) string {
+	return "login_blocked:" + key
+}
+
+func (s *RedisStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, failuresKey(key))
+		// Only the first failure of a run starts the window
+		pipe.ExpireNX(ctx, failuresKey(key), window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+func (s *RedisStore) Block(ctx context.Context, key string, d time.Duration) error {
+	return s.client.Set(ctx, blockKey(key), 1, d).Err()
+}
+
+func (s *RedisStore) Blocked(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, blockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// PTTL is negative for missing keys
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, failuresKey(key), blockKey(key)).Err()
+}
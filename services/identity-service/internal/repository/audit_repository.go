@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+)
+
+type AuditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{
+		db: db,
+	}
+}
+
+func (r *AuditRepository) conn(ctx context.Context) dbtx {
+	return conn(ctx, r.db)
+}
+
+// CreateEntry adds an entry to the admin audit log. Inside a transaction it
+// is only kept if the action it records is.
+func (r *AuditRepository) CreateEntry(ctx context.Context, entry *models.AuditEntry) error {
+	query := `
+		INSERT INTO admin_audit_log (id, admin_id, action, target_user_id, details, ip_address, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query,
+		entry.ID,
+		entry.AdminID,
+		entry.Action,
+		entry.TargetUserID,
+		[]byte(entry.Details),
+		entry.IPAddress,
+		entry.CreatedAt,
+	)
+
+	return err
+}
+
+// ListEntries returns a page of the audit log entries matching the query,
+// newest first, and how many match in all
+func (r *AuditRepository) ListEntries(ctx context.Context, filter *models.AuditLogQuery, limit, offset int) ([]*models.AuditEntry, int, error) {
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.AdminID != "" {
+		conditions = append(conditions, "admin_id = "+arg(filter.AdminID))
+	}
+	if filter.UserID != "" {
+		conditions = append(conditions, "target_user_id = "+arg(filter.UserID))
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = "+arg(filter.Action))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	err := r.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM admin_audit_log "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, admin_id, action, target_user_id, details, ip_address, created_at
+		FROM admin_audit_log
+		` + where + `
+		ORDER BY created_at DESC, id
+		LIMIT ` + arg(limit) + ` OFFSET ` + arg(offset)
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []*models.AuditEntry{}
+	for rows.Next() {
+		entry := &models.AuditEntry{}
+		var details []byte
+		err := rows.Scan(
+			&entry.ID,
+			&entry.AdminID,
+			&entry.Action,
+			&entry.TargetUserID,
+			&details,
+			&entry.IPAddress,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		entry.Details = details
+		entries = append(entries, entry)
+	}
+
+	return entries, total, rows.Err()
+}
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMFANotFound          = errors.New("mfa enrollment not found")
+	ErrMFAChallengeNotFound = errors.New("mfa challenge not found")
+)
+
+type MFARepository struct {
+	db *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{
+		db: db,
+	}
+}
+
+func (r *MFARepository) conn(ctx context.Context) dbtx {
+	return conn(ctx, r.db)
+}
+
+// SaveEnrollment stores a new unconfirmed enrollment, replacing any existing one
+func (r *MFARepository) SaveEnrollment(ctx context.Context, mfa *models.UserMFA) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret_encrypted, confirmed_at, last_used_step, created_at)
+		VALUES ($1, $2, NULL, 0, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypted = EXCLUDED.secret_encrypted,
+		    confirmed_at = NULL,
+		    last_used_step = 0,
+		    created_at = EXCLUDED.created_at
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, mfa.UserID, mfa.SecretEncrypted, mfa.CreatedAt)
+	return err
+}
+
+// GetEnrollment retrieves and locks a user's enrollment
+func (r *MFARepository) GetEnrollment(ctx context.Context, userID uuid.UUID) (*models.UserMFA, error) {
+	query := `
+		SELECT user_id, secret_encrypted, confirmed_at, last_used_step, created_at
+		FROM user_mfa
+		WHERE user_id = $1
+		FOR UPDATE
+	`
+
+	mfa := &models.UserMFA{}
+	err := r.conn(ctx).QueryRowContext(ctx, query, userID).Scan(
+		&mfa.UserID,
+		&mfa.SecretEncrypted,
+		&mfa.ConfirmedAt,
+		&mfa.LastUsedStep,
+		&mfa.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrMFANotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return mfa, nil
+}
+
+// ConfirmEnrollment confirms an enrollment and enables MFA for the user
+func (r *MFARepository) ConfirmEnrollment(ctx context.Context, userID uuid.UUID, step int64) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE user_mfa SET confirmed_at = $1, last_used_step = $2 WHERE user_id = $3",
+		now, step, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE users SET mfa_enabled = TRUE, updated_at = $1 WHERE id = $2",
+		now, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateLastUsedStep records the time step of the last accepted code
+func (r *MFARepository) UpdateLastUsedStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	query := `UPDATE user_mfa SET last_used_step = $1 WHERE user_id = $2`
+	_, err := r.conn(ctx).ExecContext(ctx, query, step, userID)
+	return err
+}
+
+// DeleteEnrollment removes a user's enrollment and recovery codes and
+// disables MFA
+func (r *MFARepository) DeleteEnrollment(ctx context.Context, userID uuid.UUID) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_mfa WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE users SET mfa_enabled = FALSE, updated_at = $1 WHERE id = $2",
+		time.Now(), userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes replaces a user's recovery codes with new hashes
+func (r *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO mfa_recovery_codes (id, user_id, code_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	now := time.Now()
+	for _, codeHash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, query, uuid.New(), userID, codeHash, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused recovery code as used, reporting whether
+// one matched
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL
+	`
+
+	result, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// CreateChallenge stores a new login challenge
+func (r *MFARepository) CreateChallenge(ctx context.Context, challenge *models.MFAChallenge) error {
+	query := `
+		INSERT INTO mfa_challenges
+			(id, user_id, token_hash, attempts, ip_address, user_agent, device_fingerprint, method, code_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, 0, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query,
+		challenge.ID,
+		challenge.UserID,
+		challenge.TokenHash,
+		challenge.IPAddress,
+		challenge.UserAgent,
+		challenge.DeviceFingerprint,
+		challenge.Method,
+		challenge.CodeHash,
+		challenge.ExpiresAt,
+		challenge.CreatedAt,
+	)
+
+	return err
+}
+
+// GetActiveChallenge retrieves and locks an unconsumed, unexpired challenge
+func (r *MFARepository) GetActiveChallenge(ctx context.Context, tokenHash string) (*models.MFAChallenge, error) {
+	query := `
+		SELECT id, user_id, token_hash, attempts, ip_address, user_agent, device_fingerprint,
+		       method, code_hash, expires_at, consumed_at, created_at
+		FROM mfa_challenges
+		WHERE token_hash = $1 AND consumed_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`
+
+	challenge := &models.MFAChallenge{}
+	err := r.conn(ctx).QueryRowContext(ctx, query, tokenHash).Scan(
+		&challenge.ID,
+		&challenge.UserID,
+		&challenge.TokenHash,
+		&challenge.Attempts,
+		&challenge.IPAddress,
+		&challenge.UserAgent,
+		&challenge.DeviceFingerprint,
+		&challenge.Method,
+		&challenge.CodeHash,
+		&challenge.ExpiresAt,
+		&challenge.ConsumedAt,
+		&challenge.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrMFAChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// RecordChallengeAttempt counts a failed attempt against a challenge,
+// consuming it once maxAttempts is reached
+func (r *MFARepository) RecordChallengeAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) error {
+	query := `
+		UPDATE mfa_challenges
+		SET attempts = attempts + 1,
+		    consumed_at = CASE WHEN attempts + 1 >= $1 THEN NOW() ELSE consumed_at END
+		WHERE id = $2
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, maxAttempts, id)
+	return err
+}
+
+// ConsumeChallenge marks a challenge as used
+func (r *MFARepository) ConsumeChallenge(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE mfa_challenges SET consumed_at = $1 WHERE id = $2`
+	_, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), id)
+	return err
+}
@@ -0,0 +1,428 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrOAuthClientNotFound       = errors.New("oauth client not found")
+	ErrAPIKeyNotFound            = errors.New("api key not found")
+	ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
+	ErrConsentNotFound           = errors.New("consent not found")
+)
+
+// OAuthRepository stores OAuth clients, authorization codes, consents and
+// API keys
+type OAuthRepository struct {
+	db *sql.DB
+}
+
+func NewOAuthRepository(db *sql.DB) *OAuthRepository {
+	return &OAuthRepository{
+		db: db,
+	}
+}
+
+func (r *OAuthRepository) conn(ctx context.Context) dbtx {
+	return conn(ctx, r.db)
+}
+
+// CreateClient creates an OAuth client
+func (r *OAuthRepository) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	query := `
+		INSERT INTO oauth_clients (id, client_id, secret_hash, name, scopes, redirect_uris, public, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query,
+		client.ID,
+		client.ClientID,
+		client.SecretHash,
+		client.Name,
+		pq.StringArray(client.Scopes),
+		pq.StringArray(client.RedirectURIs),
+		client.Public,
+		client.CreatedBy,
+		client.CreatedAt,
+	)
+	return err
+}
+
+const oauthClientColumns = `id, client_id, secret_hash, name, scopes, redirect_uris, public, created_by, last_used_at, revoked_at, created_at`
+
+func scanOAuthClient(row interface{ Scan(...interface{}) error }) (*models.OAuthClient, error) {
+	client := &models.OAuthClient{}
+	var scopes, redirectURIs pq.StringArray
+	err := row.Scan(
+		&client.ID,
+		&client.ClientID,
+		&client.SecretHash,
+		&client.Name,
+		&scopes,
+		&redirectURIs,
+		&client.Public,
+		&client.CreatedBy,
+		&client.LastUsedAt,
+		&client.RevokedAt,
+		&client.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	client.Scopes = scopes
+	client.RedirectURIs = redirectURIs
+
+	return client, nil
+}
+
+// GetClientByClientID retrieves an OAuth client, revoked or not
+func (r *OAuthRepository) GetClientByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE client_id = $1`
+
+	client, err := scanOAuthClient(r.conn(ctx).QueryRowContext(ctx, query, clientID))
+	if err == sql.ErrNoRows {
+		return nil, ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// ListClients retrieves all OAuth clients, newest first
+func (r *OAuthRepository) ListClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients ORDER BY created_at DESC`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []*models.OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+// RevokeClient revokes an OAuth client and returns its record ID
+func (r *OAuthRepository) RevokeClient(ctx context.Context, clientID string) (uuid.UUID, error) {
+	query := `
+		UPDATE oauth_clients
+		SET revoked_at = $1
+		WHERE client_id = $2 AND revoked_at IS NULL
+		RETURNING id
+	`
+
+	var id uuid.UUID
+	err := r.conn(ctx).QueryRowContext(ctx, query, time.Now(), clientID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrOAuthClientNotFound
+	}
+	return id, err
+}
+
+// TouchClient records that a client was just used
+func (r *OAuthRepository) TouchClient(ctx context.Context, id uuid.UUID) error {
+	_, err := r.conn(ctx).ExecContext(ctx, "UPDATE oauth_clients SET last_used_at = $1 WHERE id = $2", time.Now(), id)
+	return err
+}
+
+// CreateAPIKey creates an API key
+func (r *OAuthRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query,
+		key.ID,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		pq.StringArray(key.Scopes),
+		key.ExpiresAt,
+		key.CreatedAt,
+	)
+	return err
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	var scopes pq.StringArray
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = scopes
+
+	return key, nil
+}
+
+// GetAPIKeyByPrefix retrieves an API key by its public prefix, revoked or not
+func (r *OAuthRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix = $1`
+
+	key, err := scanAPIKey(r.conn(ctx).QueryRowContext(ctx, query, prefix))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys retrieves a user's unrevoked API keys, newest first
+func (r *OAuthRepository) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes one of a user's API keys
+func (r *OAuthRepository) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID) error {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL
+	`
+
+	result, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// TouchAPIKey records that a key was just used
+func (r *OAuthRepository) TouchAPIKey(ctx context.Context, id uuid.UUID) error {
+	_, err := r.conn(ctx).ExecContext(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", time.Now(), id)
+	return err
+}
+
+// CreateAuthorizationCode stores an authorization code
+func (r *OAuthRepository) CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	query := `
+		INSERT INTO oauth_authorization_codes
+			(id, code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query,
+		code.ID,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		pq.StringArray(code.Scopes),
+		code.Nonce,
+		code.CodeChallenge,
+		code.ExpiresAt,
+		code.CreatedAt,
+	)
+	return err
+}
+
+// GetAuthorizationCode retrieves and locks an authorization code by hash,
+// used or not
+func (r *OAuthRepository) GetAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	query := `
+		SELECT id, code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, expires_at, used_at, created_at
+		FROM oauth_authorization_codes
+		WHERE code_hash = $1
+		FOR UPDATE
+	`
+
+	code := &models.AuthorizationCode{}
+	var scopes pq.StringArray
+	err := r.conn(ctx).QueryRowContext(ctx, query, codeHash).Scan(
+		&code.ID,
+		&code.CodeHash,
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		&scopes,
+		&code.Nonce,
+		&code.CodeChallenge,
+		&code.ExpiresAt,
+		&code.UsedAt,
+		&code.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrAuthorizationCodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	code.Scopes = scopes
+
+	return code, nil
+}
+
+// MarkAuthorizationCodeUsed marks an authorization code as redeemed
+func (r *OAuthRepository) MarkAuthorizationCodeUsed(ctx context.Context, id uuid.UUID) error {
+	_, err := r.conn(ctx).ExecContext(ctx, "UPDATE oauth_authorization_codes SET used_at = $1 WHERE id = $2", time.Now(), id)
+	return err
+}
+
+// DeleteExpiredAuthorizationCodes deletes expired authorization codes and
+// returns how many were deleted
+func (r *OAuthRepository) DeleteExpiredAuthorizationCodes(ctx context.Context) (int64, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM oauth_authorization_codes WHERE expires_at < $1", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetConsent retrieves the scopes a user has allowed a client
+func (r *OAuthRepository) GetConsent(ctx context.Context, userID uuid.UUID, clientID string) (*models.OAuthConsent, error) {
+	query := `
+		SELECT c.user_id, c.client_id, oc.name, c.scopes, c.granted_at
+		FROM oauth_consents c
+		JOIN oauth_clients oc ON oc.client_id = c.client_id
+		WHERE c.user_id = $1 AND c.client_id = $2
+	`
+
+	consent := &models.OAuthConsent{}
+	var scopes pq.StringArray
+	err := r.conn(ctx).QueryRowContext(ctx, query, userID, clientID).Scan(
+		&consent.UserID,
+		&consent.ClientID,
+		&consent.ClientName,
+		&scopes,
+		&consent.GrantedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrConsentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	consent.Scopes = scopes
+
+	return consent, nil
+}
+
+// SaveConsent adds scopes to the consent a user has given a client
+func (r *OAuthRepository) SaveConsent(ctx context.Context, userID uuid.UUID, clientID string, scopes []string) error {
+	query := `
+		INSERT INTO oauth_consents (user_id, client_id, scopes, granted_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, client_id) DO UPDATE
+		SET scopes = ARRAY(SELECT DISTINCT unnest(oauth_consents.scopes || EXCLUDED.scopes) ORDER BY 1),
+		    granted_at = EXCLUDED.granted_at
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, userID, clientID, pq.StringArray(scopes), time.Now())
+	return err
+}
+
+// ListConsents retrieves the clients a user has consented to
+func (r *OAuthRepository) ListConsents(ctx context.Context, userID uuid.UUID) ([]*models.OAuthConsent, error) {
+	query := `
+		SELECT c.user_id, c.client_id, oc.name, c.scopes, c.granted_at
+		FROM oauth_consents c
+		JOIN oauth_clients oc ON oc.client_id = c.client_id
+		WHERE c.user_id = $1
+		ORDER BY c.granted_at DESC
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	consents := []*models.OAuthConsent{}
+	for rows.Next() {
+		consent := &models.OAuthConsent{}
+		var scopes pq.StringArray
+		if err := rows.Scan(&consent.UserID, &consent.ClientID, &consent.ClientName, &scopes, &consent.GrantedAt); err != nil {
+			return nil, err
+		}
+		consent.Scopes = scopes
+		consents = append(consents, consent)
+	}
+
+	return consents, rows.Err()
+}
+
+// DeleteConsent withdraws a user's consent to a client
+func (r *OAuthRepository) DeleteConsent(ctx context.Context, userID uuid.UUID, clientID string) error {
+	result, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM oauth_consents WHERE user_id = $1 AND client_id = $2", userID, clientID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrConsentNotFound
+	}
+
+	return nil
+}
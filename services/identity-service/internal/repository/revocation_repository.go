@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/revocation"
+	"github.com/google/uuid"
+)
+
+// RevocationRepository is the Postgres revocation.Store. Revoked tokens are
+// kept in revoked_tokens and valid-after times on the users table.
+type RevocationRepository struct {
+	db *sql.DB
+}
+
+func NewRevocationRepository(db *sql.DB) *RevocationRepository {
+	return &RevocationRepository{
+		db: db,
+	}
+}
+
+func (r *RevocationRepository) conn(ctx context.Context) dbtx {
+	return conn(ctx, r.db)
+}
+
+// Revoke records a revoked jti or sid, extending an existing revocation if
+// the new one lasts longer
+func (r *RevocationRepository) Revoke(ctx context.Context, kind revocation.Kind, id string, userID uuid.UUID, until time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (kind, token_id, user_id, expires_at, revoked_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (kind, token_id) DO UPDATE
+		SET expires_at = GREATEST(revoked_tokens.expires_at, EXCLUDED.expires_at)
+	`
+
+	// Tokens of OAuth clients belong to no user
+	var owner *uuid.UUID
+	if userID != uuid.Nil {
+		owner = &userID
+	}
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, string(kind), id, owner, until.UTC(), time.Now().UTC())
+	return err
+}
+
+// IsRevoked reports whether a jti or sid has an unexpired revocation
+func (r *RevocationRepository) IsRevoked(ctx context.Context, kind revocation.Kind, id string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM revoked_tokens
+			WHERE kind = $1 AND token_id = $2 AND expires_at > $3
+		)
+	`
+
+	var revoked bool
+	err := r.conn(ctx).QueryRowContext(ctx, query, string(kind), id, time.Now().UTC()).Scan(&revoked)
+	return revoked, err
+}
+
+// SetValidAfter sets the time before which a user's tokens are rejected
+func (r *RevocationRepository) SetValidAfter(ctx context.Context, userID uuid.UUID, t time.Time) error {
+	query := `UPDATE users SET tokens_valid_after = $1 WHERE id = $2`
+
+	result, err := r.conn(ctx).ExecContext(ctx, query, t.UTC(), userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// ValidAfter returns a user's valid-after time, or the zero time if none
+// is set
+func (r *RevocationRepository) ValidAfter(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	query := `SELECT tokens_valid_after FROM users WHERE id = $1`
+
+	var validAfter sql.NullTime
+	err := r.conn(ctx).QueryRowContext(ctx, query, userID).Scan(&validAfter)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return validAfter.Time, nil
+}
+
+// PurgeExpired deletes revocations whose tokens have all expired
+func (r *RevocationRepository) PurgeExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM revoked_tokens WHERE expires_at < $1`
+	result, err := r.conn(ctx).ExecContext(ctx, query, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
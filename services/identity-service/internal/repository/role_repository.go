@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleExists        = errors.New("role already exists")
+	ErrUnknownPermission = errors.New("unknown permission")
+)
+
+// Postgres error codes
+const (
+	pqForeignKeyViolation = "23503"
+	pqUniqueViolation     = "23505"
+)
+
+type RoleRepository struct {
+	db *sql.DB
+}
+
+func NewRoleRepository(db *sql.DB) *RoleRepository {
+	return &RoleRepository{
+		db: db,
+	}
+}
+
+func (r *RoleRepository) conn(ctx context.Context) dbtx {
+	return conn(ctx, r.db)
+}
+
+// pqErrorCode returns the Postgres error code of err, if it has one
+func pqErrorCode(err error) pq.ErrorCode {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code
+	}
+	return ""
+}
+
+// ListRoles retrieves all roles with their permissions
+func (r *RoleRepository) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	query := `
+		SELECT r.name, r.description, r.created_at,
+		       COALESCE(array_agg(rp.permission_name ORDER BY rp.permission_name)
+		                FILTER (WHERE rp.permission_name IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_name = r.name
+		GROUP BY r.name
+		ORDER BY r.name
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*models.Role{}
+	for rows.Next() {
+		role := &models.Role{}
+		var permissions pq.StringArray
+		if err := rows.Scan(&role.Name, &role.Description, &role.CreatedAt, &permissions); err != nil {
+			return nil, err
+		}
+		role.Permissions = permissions
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// CreateRole creates a role with the given permissions
+func (r *RoleRepository) CreateRole(ctx context.Context, role *models.Role) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO roles (name, description, created_at) VALUES ($1, $2, $3)",
+		role.Name, role.Description, role.CreatedAt,
+	)
+	if pqErrorCode(err) == pqUniqueViolation {
+		return ErrRoleExists
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := insertRolePermissions(ctx, tx, role.Name, role.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetRolePermissions replaces the permissions of a role
+func (r *RoleRepository) SetRolePermissions(ctx context.Context, roleName string, permissions []string) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the role so concurrent updates do not interleave
+	var name string
+	err = tx.QueryRowContext(ctx, "SELECT name FROM roles WHERE name = $1 FOR UPDATE", roleName).Scan(&name)
+	if err == sql.ErrNoRows {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE role_name = $1", roleName); err != nil {
+		return err
+	}
+
+	if err := insertRolePermissions(ctx, tx, roleName, permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertRolePermissions(ctx context.Context, tx dbtx, roleName string, permissions []string) error {
+	for _, permission := range permissions {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO role_permissions (role_name, permission_name) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			roleName, permission,
+		)
+		if pqErrorCode(err) == pqForeignKeyViolation {
+			return ErrUnknownPermission
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListPermissions retrieves all permissions roles can grant
+func (r *RoleRepository) ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, "SELECT name, description FROM permissions ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*models.Permission{}
+	for rows.Next() {
+		permission := &models.Permission{}
+		if err := rows.Scan(&permission.Name, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+// GetUserRoles retrieves a user's roles and the union of their permissions
+func (r *RoleRepository) GetUserRoles(ctx context.Context, userID uuid.UUID) (*models.UserRoles, error) {
+	query := `
+		SELECT
+			COALESCE((SELECT array_agg(role_name ORDER BY role_name) FROM user_roles WHERE user_id = $1), '{}'),
+			COALESCE((
+				SELECT array_agg(DISTINCT rp.permission_name ORDER BY rp.permission_name)
+				FROM user_roles ur
+				JOIN role_permissions rp ON rp.role_name = ur.role_name
+				WHERE ur.user_id = $1
+			), '{}')
+	`
+
+	var roles, permissions pq.StringArray
+	if err := r.conn(ctx).QueryRowContext(ctx, query, userID).Scan(&roles, &permissions); err != nil {
+		return nil, err
+	}
+
+	return &models.UserRoles{
+		UserID:      userID,
+		Roles:       roles,
+		Permissions: permissions,
+	}, nil
+}
+
+// AssignRole gives a user a role. Assigning a role the user already has is
+// a no-op.
+func (r *RoleRepository) AssignRole(ctx context.Context, userID uuid.UUID, roleName string, assignedBy *uuid.UUID) error {
+	// Check first rather than catching the foreign key violation, which would
+	// abort a surrounding transaction
+	var userExists, roleExists bool
+	err := r.conn(ctx).QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM users WHERE id = $1), EXISTS (SELECT 1 FROM roles WHERE name = $2)",
+		userID, roleName,
+	).Scan(&userExists, &roleExists)
+	if err != nil {
+		return err
+	}
+	if !userExists {
+		return ErrUserNotFound
+	}
+	if !roleExists {
+		return ErrRoleNotFound
+	}
+
+	query := `
+		INSERT INTO user_roles (user_id, role_name, assigned_by, assigned_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, role_name) DO NOTHING
+	`
+
+	_, err = r.conn(ctx).ExecContext(ctx, query, userID, roleName, assignedBy, time.Now())
+	return err
+}
+
+// RemoveRole takes a role away from a user
+func (r *RoleRepository) RemoveRole(ctx context.Context, userID uuid.UUID, roleName string) error {
+	result, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM user_roles WHERE user_id = $1 AND role_name = $2", userID, roleName)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRoleNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type txKey struct{}
+
+// dbtx is the subset of *sql.DB and *sql.Tx used by the repositories
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// txn is a transaction that may be shared with an outer withTx call, in which
+// case Commit and Rollback are left to the outermost caller
+type txn struct {
+	*sql.Tx
+	owned bool
+}
+
+func (t *txn) Commit() error {
+	if !t.owned {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+func (t *txn) Rollback() error {
+	if !t.owned {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
+
+// begin joins the transaction carried on ctx or starts a new one
+func begin(ctx context.Context, db *sql.DB) (*txn, error) {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return &txn{Tx: tx}, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &txn{Tx: tx, owned: true}, nil
+}
+
+// withTx runs fn inside a transaction carried on the context passed to fn
+func withTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) error {
+	tx, err := begin(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx.Tx)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// conn returns the transaction carried on ctx, or db when there is none
+func conn(ctx context.Context, db *sql.DB) dbtx {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
@@ -4,16 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Caesarsage/bankflow/identity-service/internal/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrUserAlreadyExists = errors.New("user already exists")
 	ErrSessionNotFound   = errors.New("session not found")
+	ErrResetTokenInvalid = errors.New("password reset token is invalid or expired")
+	ErrPhoneTaken        = errors.New("phone number already in use")
+
+	ErrVerificationCodeNotFound = errors.New("verification code not found")
 )
 
 type UserRepository struct {
@@ -26,13 +33,23 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	}
 }
 
+// WithTx runs fn in a single database transaction. Repository calls made with
+// the context passed to fn take part in that transaction.
+func (r *UserRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withTx(ctx, r.db, fn)
+}
+
+func (r *UserRepository) conn(ctx context.Context) dbtx {
+	return conn(ctx, r.db)
+}
+
 func (r *UserRepository) CreateUser(ctx context.Context, user *models.User) error {
 	query := `
 		INSERT INTO users (id, email, phone, password_hash, is_verified, is_active, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := r.conn(ctx).ExecContext(ctx, query,
 		user.ID,
 		user.Email,
 		user.Phone,
@@ -56,20 +73,24 @@ func (r *UserRepository) CreateUser(ctx context.Context, user *models.User) erro
 
 func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, email, phone, password_hash, is_verified, is_active,
-		       failed_login_attempts, locked_until, last_login, created_at, updated_at
+		SELECT id, email, phone, password_hash, is_verified, email_verified, phone_verified, mfa_enabled, is_active,
+		       password_reset_required, failed_login_attempts, locked_until, last_login, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
 
 	user := &models.User{}
-	err := r.db.QueryRowContext(ctx, query, email).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Phone,
 		&user.PasswordHash,
 		&user.IsVerified,
+		&user.EmailVerified,
+		&user.PhoneVerified,
+		&user.MFAEnabled,
 		&user.IsActive,
+		&user.PasswordResetRequired,
 		&user.FailedLoginAttempts,
 		&user.LockedUntil,
 		&user.LastLogin,
@@ -89,20 +110,24 @@ func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*mod
 
 func (r *UserRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT id, email, phone, password_hash, is_verified, is_active,
-		       failed_login_attempts, locked_until, last_login, created_at, updated_at
+		SELECT id, email, phone, password_hash, is_verified, email_verified, phone_verified, mfa_enabled, is_active,
+		       password_reset_required, failed_login_attempts, locked_until, last_login, created_at, updated_at
 		FROM users
-		WHERE email = $1
+		WHERE id = $1
 	`
 
 	user := &models.User{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Phone,
 		&user.PasswordHash,
 		&user.IsVerified,
+		&user.EmailVerified,
+		&user.PhoneVerified,
+		&user.MFAEnabled,
 		&user.IsActive,
+		&user.PasswordResetRequired,
 		&user.FailedLoginAttempts,
 		&user.LockedUntil,
 		&user.LastLogin,
@@ -128,64 +153,252 @@ func (r *UserRepository) UpdateLastLogin(ctx context.Context, userID uuid.UUID)
 		WHERE id = $2
 	`
 
-	_, err := r.db.ExecContext(ctx, query, time.Now(), userID)
+	_, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), userID)
 	return err
 }
 
-// IncrementFailedLoginAttempts increments failed login attempts
-func (r *UserRepository) IncrementFailedLoginAttempts(ctx context.Context, userID uuid.UUID) error {
+// IncrementFailedLoginAttempts counts a failed login. Reaching threshold
+// consecutive failures locks the account for lockFor and starts the count
+// again; it reports whether this failure locked the account. A zero
+// threshold never locks.
+func (r *UserRepository) IncrementFailedLoginAttempts(ctx context.Context, userID uuid.UUID, threshold int, lockFor time.Duration) (bool, error) {
 	query := `
 		UPDATE users
-		SET failed_login_attempts = failed_login_attempts + 1,
+		SET failed_login_attempts = CASE
+		        WHEN $2 > 0 AND failed_login_attempts + 1 >= $2 THEN 0
+		        ELSE failed_login_attempts + 1
+		    END,
 		    locked_until = CASE
-		        WHEN failed_login_attempts >= 5 THEN NOW() + INTERVAL '30 minutes'
-		        ELSE NULL
+		        WHEN $2 > 0 AND failed_login_attempts + 1 >= $2 THEN $3
+		        ELSE locked_until
 		    END,
 		    updated_at = NOW()
 		WHERE id = $1
+		RETURNING $2 > 0 AND failed_login_attempts = 0
 	`
 
-	_, err := r.db.ExecContext(ctx, query, userID)
-	return err
+	var locked bool
+	err := r.conn(ctx).QueryRowContext(ctx, query, userID, threshold, time.Now().Add(lockFor)).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return false, ErrUserNotFound
+	}
+	return locked, err
+}
+
+// UnlockUser clears a user's lockout and failed login count
+func (r *UserRepository) UnlockUser(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET failed_login_attempts = 0, locked_until = NULL, updated_at = $1
+		WHERE id = $2
+	`
+
+	result, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetUserActive activates or deactivates a user
+func (r *UserRepository) SetUserActive(ctx context.Context, userID uuid.UUID, active bool) error {
+	query := `
+		UPDATE users
+		SET is_active = $1, updated_at = $2
+		WHERE id = $3
+	`
+
+	result, err := r.conn(ctx).ExecContext(ctx, query, active, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// RequirePasswordReset stops a user logging in with their password until
+// they set a new one
+func (r *UserRepository) RequirePasswordReset(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET password_reset_required = TRUE, updated_at = $1
+		WHERE id = $2
+	`
+
+	result, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// ListUsers returns a page of the users matching the query, newest first,
+// and how many match in all
+func (r *UserRepository) ListUsers(ctx context.Context, filter *models.UserListQuery, limit, offset int) ([]*models.User, int, error) {
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Q != "" {
+		pattern := arg("%" + likeEscaper.Replace(filter.Q) + "%")
+		conditions = append(conditions, fmt.Sprintf("(email ILIKE %s OR phone ILIKE %s)", pattern, pattern))
+	}
+	if filter.Verified != nil {
+		conditions = append(conditions, "is_verified = "+arg(*filter.Verified))
+	}
+	if filter.Active != nil {
+		conditions = append(conditions, "is_active = "+arg(*filter.Active))
+	}
+	if filter.Locked != nil {
+		now := arg(time.Now())
+		if *filter.Locked {
+			conditions = append(conditions, "locked_until > "+now)
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(locked_until IS NULL OR locked_until <= %s)", now))
+		}
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	err := r.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM users "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, email, phone, password_hash, is_verified, email_verified, phone_verified, mfa_enabled, is_active,
+		       password_reset_required, failed_login_attempts, locked_until, last_login, created_at, updated_at
+		FROM users
+		` + where + `
+		ORDER BY created_at DESC, id
+		LIMIT ` + arg(limit) + ` OFFSET ` + arg(offset)
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.Phone,
+			&user.PasswordHash,
+			&user.IsVerified,
+			&user.EmailVerified,
+			&user.PhoneVerified,
+			&user.MFAEnabled,
+			&user.IsActive,
+			&user.PasswordResetRequired,
+			&user.FailedLoginAttempts,
+			&user.LockedUntil,
+			&user.LastLogin,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
 }
 
+// likeEscaper escapes the LIKE wildcards in a search term so they match
+// literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
 
 // CreateSession creates a new session
 func (r *UserRepository) CreateSession(ctx context.Context, session *models.Session) error {
 	query := `
-		INSERT INTO sessions (id, user_id, refresh_token, expires_at, ip_address, user_agent, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO sessions
+			(id, user_id, refresh_token_hash, family_id, parent_id, expires_at, ip_address, user_agent, auth_time, amr, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := r.conn(ctx).ExecContext(ctx, query,
 		session.ID,
 		session.UserID,
-		session.RefreshToken,
+		session.RefreshTokenHash,
+		session.FamilyID,
+		session.ParentID,
 		session.ExpiresAt,
 		session.IPAddress,
 		session.UserAgent,
+		session.AuthTime,
+		pq.StringArray(session.AMR),
 		session.CreatedAt,
 	)
 
 	return err
 }
 
-// GetSessionByRefreshToken retrieves a session by refresh token
-func (r *UserRepository) GetSessionByRefreshToken(ctx context.Context, refreshToken string) (*models.Session, error) {
+// GetSessionByRefreshTokenHash retrieves and locks a session by the hash of
+// its refresh token, including rotated, revoked and expired sessions
+func (r *UserRepository) GetSessionByRefreshTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
 	query := `
-		SELECT id, user_id, refresh_token, expires_at, ip_address, user_agent, created_at
+		SELECT id, user_id, refresh_token_hash, family_id, parent_id, rotated_at, revoked_at,
+		       expires_at, ip_address, user_agent, auth_time, amr, created_at
 		FROM sessions
-		WHERE refresh_token = $1 AND expires_at > NOW()
+		WHERE refresh_token_hash = $1
+		FOR UPDATE
 	`
 
 	session := &models.Session{}
-	err := r.db.QueryRowContext(ctx, query, refreshToken).Scan(
+	var amr pq.StringArray
+	err := r.conn(ctx).QueryRowContext(ctx, query, tokenHash).Scan(
 		&session.ID,
 		&session.UserID,
-		&session.RefreshToken,
+		&session.RefreshTokenHash,
+		&session.FamilyID,
+		&session.ParentID,
+		&session.RotatedAt,
+		&session.RevokedAt,
 		&session.ExpiresAt,
 		&session.IPAddress,
 		&session.UserAgent,
+		&session.AuthTime,
+		&amr,
 		&session.CreatedAt,
 	)
 
@@ -196,19 +409,579 @@ func (r *UserRepository) GetSessionByRefreshToken(ctx context.Context, refreshTo
 		return nil, err
 	}
 
+	session.AMR = amr
 	return session, nil
 }
 
-// DeleteSession deletes a session
-func (r *UserRepository) DeleteSession(ctx context.Context, refreshToken string) error {
-	query := `DELETE FROM sessions WHERE refresh_token = $1`
-	_, err := r.db.ExecContext(ctx, query, refreshToken)
+// MarkSessionRotated marks a session as replaced by a newer one in its family
+func (r *UserRepository) MarkSessionRotated(ctx context.Context, sessionID uuid.UUID) error {
+	query := `UPDATE sessions SET rotated_at = $1 WHERE id = $2`
+	_, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), sessionID)
 	return err
 }
 
-// DeleteExpiredSessions deletes all expired sessions
-func (r *UserRepository) DeleteExpiredSessions(ctx context.Context) error {
+// RevokeSessionFamily revokes every session in a refresh token family
+func (r *UserRepository) RevokeSessionFamily(ctx context.Context, familyID uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+	_, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), familyID)
+	return err
+}
+
+// GetActiveSessions retrieves the live session of each of a user's
+// unrevoked, unexpired refresh token families, most recently used first
+func (r *UserRepository) GetActiveSessions(ctx context.Context, userID uuid.UUID) ([]*models.ActiveSession, error) {
+	query := `
+		SELECT s.family_id, s.ip_address, s.user_agent, f.started_at, s.created_at, s.expires_at
+		FROM sessions s
+		JOIN (
+			SELECT family_id, MIN(created_at) AS started_at
+			FROM sessions
+			WHERE user_id = $1
+			GROUP BY family_id
+		) f ON f.family_id = s.family_id
+		WHERE s.user_id = $1 AND s.rotated_at IS NULL AND s.revoked_at IS NULL AND s.expires_at > NOW()
+		ORDER BY s.created_at DESC
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.ActiveSession{}
+	for rows.Next() {
+		session := &models.ActiveSession{}
+		err := rows.Scan(
+			&session.ID,
+			&session.IPAddress,
+			&session.UserAgent,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeUserSession revokes one of a user's session families
+func (r *UserRepository) RevokeUserSession(ctx context.Context, userID, familyID uuid.UUID) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = $1
+		WHERE user_id = $2 AND family_id = $3 AND revoked_at IS NULL AND expires_at > $1
+	`
+
+	result, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), userID, familyID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeUserSessions revokes all of a user's session families except
+// exceptFamilyID, if given. It returns the IDs of the families revoked.
+func (r *UserRepository) RevokeUserSessions(ctx context.Context, userID uuid.UUID, exceptFamilyID *uuid.UUID) ([]uuid.UUID, error) {
+	query := `
+		UPDATE sessions
+		SET revoked_at = $1
+		WHERE user_id = $2 AND revoked_at IS NULL AND expires_at > $1
+		  AND ($3::uuid IS NULL OR family_id <> $3)
+		RETURNING family_id
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, time.Now(), userID, exceptFamilyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := map[uuid.UUID]bool{}
+	families := []uuid.UUID{}
+	for rows.Next() {
+		var familyID uuid.UUID
+		if err := rows.Scan(&familyID); err != nil {
+			return nil, err
+		}
+		if !seen[familyID] {
+			seen[familyID] = true
+			families = append(families, familyID)
+		}
+	}
+
+	return families, rows.Err()
+}
+
+// DeleteExpiredSessions deletes all expired sessions and returns how many
+// were deleted
+func (r *UserRepository) DeleteExpiredSessions(ctx context.Context) (int64, error) {
 	query := `DELETE FROM sessions WHERE expires_at < NOW()`
-	_, err := r.db.ExecContext(ctx, query)
+	result, err := r.conn(ctx).ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteUserSessions deletes all sessions of a user
+func (r *UserRepository) DeleteUserSessions(ctx context.Context, userID uuid.UUID) error {
+	query := `DELETE FROM sessions WHERE user_id = $1`
+	_, err := r.conn(ctx).ExecContext(ctx, query, userID)
+	return err
+}
+
+// GetDeviceStatus reports whether a user has logged in from a device before,
+// and whether they have any known devices at all
+func (r *UserRepository) GetDeviceStatus(ctx context.Context, userID uuid.UUID, fingerprint string) (known bool, hasDevices bool, err error) {
+	query := `
+		SELECT COALESCE(BOOL_OR(fingerprint = $2), FALSE), COUNT(*) > 0
+		FROM user_devices
+		WHERE user_id = $1
+	`
+
+	err = r.conn(ctx).QueryRowContext(ctx, query, userID, fingerprint).Scan(&known, &hasDevices)
+	return known, hasDevices, err
+}
+
+// SaveDevice records a login from a device, adding it to the user's known
+// devices the first time
+func (r *UserRepository) SaveDevice(ctx context.Context, userID uuid.UUID, fingerprint, userAgent, ipAddress string) error {
+	query := `
+		INSERT INTO user_devices (user_id, fingerprint, user_agent, last_ip_address, first_seen_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (user_id, fingerprint) DO UPDATE
+		SET user_agent = EXCLUDED.user_agent,
+		    last_ip_address = EXCLUDED.last_ip_address,
+		    last_seen_at = EXCLUDED.last_seen_at
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, userID, fingerprint, userAgent, ipAddress, time.Now())
+	return err
+}
+
+// CreateLoginRecord stores a completed login
+func (r *UserRepository) CreateLoginRecord(ctx context.Context, record *models.LoginRecord) error {
+	query := `
+		INSERT INTO login_history
+			(id, user_id, session_id, ip_address, user_agent, device_fingerprint,
+			 country, city, latitude, longitude, suspicious_reasons, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query,
+		record.ID,
+		record.UserID,
+		record.SessionID,
+		record.IPAddress,
+		record.UserAgent,
+		record.DeviceFingerprint,
+		record.Country,
+		record.City,
+		record.Latitude,
+		record.Longitude,
+		pq.StringArray(record.SuspiciousReasons),
+		record.CreatedAt,
+	)
+
+	return err
+}
+
+// GetLoginHistory returns up to limit of a user's most recent logins, newest
+// first
+func (r *UserRepository) GetLoginHistory(ctx context.Context, userID uuid.UUID, limit int) ([]*models.LoginRecord, error) {
+	query := `
+		SELECT id, user_id, session_id, ip_address, user_agent, device_fingerprint,
+		       country, city, latitude, longitude, suspicious_reasons, created_at
+		FROM login_history
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*models.LoginRecord{}
+	for rows.Next() {
+		record := &models.LoginRecord{}
+		var reasons pq.StringArray
+		err := rows.Scan(
+			&record.ID,
+			&record.UserID,
+			&record.SessionID,
+			&record.IPAddress,
+			&record.UserAgent,
+			&record.DeviceFingerprint,
+			&record.Country,
+			&record.City,
+			&record.Latitude,
+			&record.Longitude,
+			&reasons,
+			&record.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		record.SuspiciousReasons = reasons
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// UpdatePassword replaces a user's password hash and clears any lockout or
+// required reset
+func (r *UserRepository) UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1, failed_login_attempts = 0, locked_until = NULL, password_reset_required = FALSE,
+		    updated_at = $2
+		WHERE id = $3
+	`
+
+	result, err := r.conn(ctx).ExecContext(ctx, query, passwordHash, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// AddPasswordHistory records a user's previous password hash and deletes
+// all but the newest keep entries
+func (r *UserRepository) AddPasswordHistory(ctx context.Context, userID uuid.UUID, passwordHash string, keep int) error {
+	_, err := r.conn(ctx).ExecContext(ctx,
+		"INSERT INTO password_history (user_id, password_hash, created_at) VALUES ($1, $2, $3)",
+		userID, passwordHash, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		DELETE FROM password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history
+			WHERE user_id = $1
+			ORDER BY created_at DESC
+			LIMIT $2
+		)
+	`
+	_, err = r.conn(ctx).ExecContext(ctx, query, userID, keep)
+	return err
+}
+
+// GetPasswordHistory returns up to limit of a user's previous password
+// hashes, newest first
+func (r *UserRepository) GetPasswordHistory(ctx context.Context, userID uuid.UUID, limit int) ([]string, error) {
+	query := `
+		SELECT password_hash FROM password_history
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := []string{}
+	for rows.Next() {
+		var passwordHash string
+		if err := rows.Scan(&passwordHash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, passwordHash)
+	}
+
+	return hashes, rows.Err()
+}
+
+// CreatePasswordResetToken stores a new reset token and invalidates any
+// earlier unused tokens of the same user
+func (r *UserRepository) CreatePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE password_reset_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL",
+		token.CreatedAt, token.UserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err = tx.ExecContext(ctx, query,
+		token.ID,
+		token.UserID,
+		token.TokenHash,
+		token.ExpiresAt,
+		token.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumePasswordResetToken marks an unused, unexpired reset token as used
+// and returns it. A token can be consumed at most once.
+func (r *UserRepository) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	query := `
+		UPDATE password_reset_tokens
+		SET used_at = $1
+		WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1
+		RETURNING id, user_id, token_hash, expires_at, used_at, created_at
+	`
+
+	token := &models.PasswordResetToken{}
+	err := r.conn(ctx).QueryRowContext(ctx, query, time.Now(), tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// CreateVerificationCode stores a new verification code and invalidates any
+// earlier unconsumed code for the same user and channel
+func (r *UserRepository) CreateVerificationCode(ctx context.Context, code *models.VerificationCode) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE verification_codes SET consumed_at = $1 WHERE user_id = $2 AND channel = $3 AND consumed_at IS NULL",
+		code.CreatedAt, code.UserID, code.Channel,
+	)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO verification_codes (id, user_id, channel, destination, code_hash, attempts, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, 0, $6, $7)
+	`
+
+	_, err = tx.ExecContext(ctx, query,
+		code.ID,
+		code.UserID,
+		code.Channel,
+		code.Destination,
+		code.CodeHash,
+		code.ExpiresAt,
+		code.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetVerificationSendStats returns how many codes were sent to a user on a
+// channel since the given time, and when the latest one was sent
+func (r *UserRepository) GetVerificationSendStats(ctx context.Context, userID uuid.UUID, channel models.VerificationChannel, since time.Time) (int, *time.Time, error) {
+	query := `
+		SELECT COUNT(*) FILTER (WHERE created_at > $3), MAX(created_at)
+		FROM verification_codes
+		WHERE user_id = $1 AND channel = $2
+	`
+
+	var count int
+	var last *time.Time
+	err := r.conn(ctx).QueryRowContext(ctx, query, userID, channel, since).Scan(&count, &last)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return count, last, nil
+}
+
+// GetActiveVerificationCode retrieves and locks the current unconsumed,
+// unexpired code of a user on a channel
+func (r *UserRepository) GetActiveVerificationCode(ctx context.Context, userID uuid.UUID, channel models.VerificationChannel) (*models.VerificationCode, error) {
+	query := `
+		SELECT id, user_id, channel, destination, code_hash, attempts, expires_at, consumed_at, created_at
+		FROM verification_codes
+		WHERE user_id = $1 AND channel = $2 AND consumed_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC
+		LIMIT 1
+		FOR UPDATE
+	`
+
+	return r.scanVerificationCode(r.conn(ctx).QueryRowContext(ctx, query, userID, channel))
+}
+
+// GetActiveVerificationCodeByHash retrieves and locks an unconsumed,
+// unexpired code by its hash
+func (r *UserRepository) GetActiveVerificationCodeByHash(ctx context.Context, channel models.VerificationChannel, codeHash string) (*models.VerificationCode, error) {
+	query := `
+		SELECT id, user_id, channel, destination, code_hash, attempts, expires_at, consumed_at, created_at
+		FROM verification_codes
+		WHERE code_hash = $1 AND channel = $2 AND consumed_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`
+
+	return r.scanVerificationCode(r.conn(ctx).QueryRowContext(ctx, query, codeHash, channel))
+}
+
+func (r *UserRepository) scanVerificationCode(row *sql.Row) (*models.VerificationCode, error) {
+	code := &models.VerificationCode{}
+	err := row.Scan(
+		&code.ID,
+		&code.UserID,
+		&code.Channel,
+		&code.Destination,
+		&code.CodeHash,
+		&code.Attempts,
+		&code.ExpiresAt,
+		&code.ConsumedAt,
+		&code.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrVerificationCodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return code, nil
+}
+
+// RecordVerificationAttempt counts a failed attempt against a code, consuming
+// it once maxAttempts is reached. It returns the new attempt count.
+func (r *UserRepository) RecordVerificationAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) (int, error) {
+	query := `
+		UPDATE verification_codes
+		SET attempts = attempts + 1,
+		    consumed_at = CASE WHEN attempts + 1 >= $1 THEN NOW() ELSE consumed_at END
+		WHERE id = $2
+		RETURNING attempts
+	`
+
+	var attempts int
+	err := r.conn(ctx).QueryRowContext(ctx, query, maxAttempts, id).Scan(&attempts)
+	return attempts, err
+}
+
+// ConsumeVerificationCode marks a code as used
+func (r *UserRepository) ConsumeVerificationCode(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE verification_codes SET consumed_at = $1 WHERE id = $2`
+	_, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), id)
+	return err
+}
+
+// MarkEmailVerified marks a user's email as verified. A verified email also
+// marks the user as verified.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET email_verified = TRUE, is_verified = TRUE, updated_at = $1
+		WHERE id = $2
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), userID)
+	return err
+}
+
+// UpdateEmail switches a user to a new, verified email
+func (r *UserRepository) UpdateEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	query := `
+		UPDATE users
+		SET email = $1, email_verified = TRUE, is_verified = TRUE, updated_at = $2
+		WHERE id = $3
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, email, time.Now(), userID)
+	if pqErrorCode(err) == pqUniqueViolation {
+		return ErrUserAlreadyExists
+	}
+	return err
+}
+
+// UpdatePhone switches a user to a new, verified phone number
+func (r *UserRepository) UpdatePhone(ctx context.Context, userID uuid.UUID, phone string) error {
+	query := `
+		UPDATE users
+		SET phone = $1, phone_verified = TRUE, updated_at = $2
+		WHERE id = $3
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, phone, time.Now(), userID)
+	if pqErrorCode(err) == pqUniqueViolation {
+		return ErrPhoneTaken
+	}
+	return err
+}
+
+// PhoneInUse reports whether any user has the given phone number
+func (r *UserRepository) PhoneInUse(ctx context.Context, phone string) (bool, error) {
+	var exists bool
+	err := r.conn(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE phone = $1)", phone).Scan(&exists)
+	return exists, err
+}
+
+// MarkPhoneVerified marks a user's phone as verified
+func (r *UserRepository) MarkPhoneVerified(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET phone_verified = TRUE, updated_at = $1
+		WHERE id = $2
+	`
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, time.Now(), userID)
 	return err
 }
@@ -0,0 +1,116 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxCacheEntries bounds the cache; it is cleared when it grows past this
+const maxCacheEntries = 100000
+
+type cachedRevocation struct {
+	revoked   bool
+	fetchedAt time.Time
+}
+
+type cachedValidAfter struct {
+	validAfter time.Time
+	fetchedAt  time.Time
+}
+
+// CachedStore keeps lookups from another Store in memory for ttl, so the
+// middleware does not query the backing store on every request. Writes
+// through the cache take effect locally at once; writes by other instances
+// are seen once the cached entry expires.
+type CachedStore struct {
+	Store
+	ttl time.Duration
+
+	mu         sync.Mutex
+	revoked    map[string]cachedRevocation
+	validAfter map[uuid.UUID]cachedValidAfter
+}
+
+func NewCachedStore(store Store, ttl time.Duration) *CachedStore {
+	return &CachedStore{
+		Store:      store,
+		ttl:        ttl,
+		revoked:    map[string]cachedRevocation{},
+		validAfter: map[uuid.UUID]cachedValidAfter{},
+	}
+}
+
+func revocationKey(kind Kind, id string) string {
+	return string(kind) + ":" + id
+}
+
+func (s *CachedStore) Revoke(ctx context.Context, kind Kind, id string, userID uuid.UUID, until time.Time) error {
+	if err := s.Store.Revoke(ctx, kind, id, userID, until); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[revocationKey(kind, id)] = cachedRevocation{revoked: true, fetchedAt: time.Now()}
+	return nil
+}
+
+func (s *CachedStore) IsRevoked(ctx context.Context, kind Kind, id string) (bool, error) {
+	key := revocationKey(kind, id)
+
+	s.mu.Lock()
+	entry, ok := s.revoked[key]
+	s.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < s.ttl {
+		return entry.revoked, nil
+	}
+
+	revoked, err := s.Store.IsRevoked(ctx, kind, id)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.revoked) >= maxCacheEntries {
+		s.revoked = map[string]cachedRevocation{}
+	}
+	s.revoked[key] = cachedRevocation{revoked: revoked, fetchedAt: time.Now()}
+	return revoked, nil
+}
+
+func (s *CachedStore) SetValidAfter(ctx context.Context, userID uuid.UUID, t time.Time) error {
+	if err := s.Store.SetValidAfter(ctx, userID, t); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.validAfter[userID] = cachedValidAfter{validAfter: t, fetchedAt: time.Now()}
+	return nil
+}
+
+func (s *CachedStore) ValidAfter(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	s.mu.Lock()
+	entry, ok := s.validAfter[userID]
+	s.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < s.ttl {
+		return entry.validAfter, nil
+	}
+
+	validAfter, err := s.Store.ValidAfter(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.validAfter) >= maxCacheEntries {
+		s.validAfter = map[uuid.UUID]cachedValidAfter{}
+	}
+	s.validAfter[userID] = cachedValidAfter{validAfter: validAfter, fetchedAt: time.Now()}
+	return validAfter, nil
+}
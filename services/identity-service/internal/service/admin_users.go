@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+	"github.com/google/uuid"
+)
+
+var ErrSelfDeactivation = errors.New("admins cannot deactivate themselves")
+
+// Actions recorded in the admin audit log
+const (
+	AuditListUsers          = "users.list"
+	AuditViewLoginHistory   = "users.view_login_history"
+	AuditDeactivateUser     = "users.deactivate"
+	AuditReactivateUser     = "users.reactivate"
+	AuditForcePasswordReset = "users.force_password_reset"
+	AuditUnlockUser         = "users.unlock"
+	AuditAssignRole         = "users.assign_role"
+	AuditRemoveRole         = "users.remove_role"
+	AuditRevokeSession      = "users.revoke_session"
+	AuditRevokeAllSessions  = "users.revoke_all_sessions"
+	AuditCreateRole         = "roles.create"
+	AuditSetRolePermissions = "roles.set_permissions"
+	AuditCreateOAuthClient  = "oauth_clients.create"
+	AuditRevokeOAuthClient  = "oauth_clients.revoke"
+)
+
+const (
+	defaultPageSize          = 20
+	maxPageSize              = 100
+	defaultLoginHistoryLimit = 50
+	maxLoginHistoryLimit     = 200
+)
+
+// Admin is the admin taking an action, as recorded in the audit log
+type Admin struct {
+	ID        uuid.UUID
+	IPAddress string
+}
+
+// ListUsers returns a page of the users matching the query
+func (s *AuthService) ListUsers(ctx context.Context, admin Admin, query *models.UserListQuery) (*models.UserList, error) {
+	page, pageSize := pageOf(query.Page, query.PageSize)
+
+	var list *models.UserList
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		users, total, err := s.userRepo.ListUsers(ctx, query, pageSize, (page-1)*pageSize)
+		if err != nil {
+			return err
+		}
+
+		list = &models.UserList{
+			Users:    users,
+			Total:    total,
+			Page:     page,
+			PageSize: pageSize,
+		}
+
+		return s.audit(ctx, admin, AuditListUsers, nil, map[string]interface{}{
+			"q":         query.Q,
+			"verified":  query.Verified,
+			"active":    query.Active,
+			"locked":    query.Locked,
+			"page":      page,
+			"page_size": pageSize,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// GetLoginHistory returns a user's most recent logins, newest first
+func (s *AuthService) GetLoginHistory(ctx context.Context, admin Admin, userID uuid.UUID, limit int) ([]*models.LoginRecord, error) {
+	if limit <= 0 {
+		limit = defaultLoginHistoryLimit
+	}
+	if limit > maxLoginHistoryLimit {
+		limit = maxLoginHistoryLimit
+	}
+
+	var history []*models.LoginRecord
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if _, err := s.userRepo.GetUserByID(ctx, userID); err != nil {
+			return err
+		}
+
+		var err error
+		history, err = s.userRepo.GetLoginHistory(ctx, userID, limit)
+		if err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditViewLoginHistory, &userID, map[string]interface{}{
+			"limit": limit,
+		})
+	})
+	if err == repository.ErrUserNotFound {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// DeactivateUser stops a user logging in and signs them out everywhere,
+// revoking all of their access tokens
+func (s *AuthService) DeactivateUser(ctx context.Context, admin Admin, userID uuid.UUID, reason string) error {
+	if userID == admin.ID {
+		return ErrSelfDeactivation
+	}
+
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.SetUserActive(ctx, userID, false); err != nil {
+			return err
+		}
+
+		revoked, err := s.RevokeAllSessions(ctx, userID, nil)
+		if err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditDeactivateUser, &userID, map[string]interface{}{
+			"reason":           reason,
+			"sessions_revoked": revoked,
+		})
+	})
+	if err == repository.ErrUserNotFound {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// ReactivateUser lets a deactivated user log in again
+func (s *AuthService) ReactivateUser(ctx context.Context, admin Admin, userID uuid.UUID, reason string) error {
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.SetUserActive(ctx, userID, true); err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditReactivateUser, &userID, map[string]interface{}{
+			"reason": reason,
+		})
+	})
+	if err == repository.ErrUserNotFound {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// ForcePasswordReset stops a user logging in with their current password,
+// signs them out everywhere and, if the account is active, sends them a
+// password reset link. They can log in again once they have reset their
+// password.
+func (s *AuthService) ForcePasswordReset(ctx context.Context, admin Admin, userID uuid.UUID, reason string) error {
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		user, err := s.userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.userRepo.RequirePasswordReset(ctx, userID); err != nil {
+			return err
+		}
+
+		revoked, err := s.RevokeAllSessions(ctx, userID, nil)
+		if err != nil {
+			return err
+		}
+
+		// Inactive users get no link, as with RequestPasswordReset
+		if user.IsActive {
+			if err := s.issuePasswordReset(ctx, user); err != nil {
+				return err
+			}
+		}
+
+		return s.audit(ctx, admin, AuditForcePasswordReset, &userID, map[string]interface{}{
+			"reason":           reason,
+			"sessions_revoked": revoked,
+			"reset_link_sent":  user.IsActive,
+		})
+	})
+	if err == repository.ErrUserNotFound {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// GetAuditLog returns a page of the admin audit log entries matching the
+// query
+func (s *AuthService) GetAuditLog(ctx context.Context, query *models.AuditLogQuery) (*models.AuditLog, error) {
+	page, pageSize := pageOf(query.Page, query.PageSize)
+
+	entries, total, err := s.auditRepo.ListEntries(ctx, query, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuditLog{
+		Entries:  entries,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// audit adds an entry to the admin audit log. Run inside the transaction of
+// the action it records, so one is never kept without the other.
+func (s *AuthService) audit(ctx context.Context, admin Admin, action string, targetUserID *uuid.UUID, details map[string]interface{}) error {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	entry := &models.AuditEntry{
+		ID:           uuid.New(),
+		AdminID:      admin.ID,
+		Action:       action,
+		TargetUserID: targetUserID,
+		Details:      data,
+		CreatedAt:    time.Now(),
+	}
+	if admin.IPAddress != "" {
+		entry.IPAddress = &admin.IPAddress
+	}
+
+	return s.auditRepo.CreateEntry(ctx, entry)
+}
+
+// pageOf fills in the defaults of an optional page number and size, and
+// caps the size
+func pageOf(page, pageSize int) (int, int) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	return page, pageSize
+}
@@ -2,42 +2,91 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
-	"log"
 	"time"
 
-	"github.com/Caesarsage/bankflow/identity-service/internal/kafka"
+	"github.com/Caesarsage/bankflow/identity-service/internal/events"
+	"github.com/Caesarsage/bankflow/identity-service/internal/geoip"
 	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/password"
+	"github.com/Caesarsage/bankflow/identity-service/internal/ratelimit"
 	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+	"github.com/Caesarsage/bankflow/identity-service/internal/revocation"
 	"github.com/Caesarsage/bankflow/identity-service/pkg/hash"
 	"github.com/Caesarsage/bankflow/identity-service/pkg/jwt"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/secretbox"
 	"github.com/google/uuid"
 )
 
 var (
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrAccountLocked      = errors.New("account is locked")
-	ErrAccountInactive    = errors.New("account is inactive")
-	ErrEmailAlreadyExists = errors.New("email already exists")
+	ErrInvalidCredentials    = errors.New("invalid credentials")
+	ErrAccountLocked         = errors.New("account is locked")
+	ErrAccountInactive       = errors.New("account is inactive")
+	ErrEmailAlreadyExists    = errors.New("email already exists")
+	ErrInvalidResetToken     = errors.New("invalid or expired reset token")
+	ErrPasswordResetRequired = errors.New("password must be reset")
+
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
 )
 
+// passwordResetExpiry is how long a password reset token stays valid
+const passwordResetExpiry = 30 * time.Minute
+
 // AuthService handles authentication business logic
 type AuthService struct {
 	userRepo   *repository.UserRepository
+	mfaRepo    *repository.MFARepository
+	roleRepo   *repository.RoleRepository
+	oauthRepo  *repository.OAuthRepository
+	auditRepo  *repository.AuditRepository
 	jwtManager *jwt.JWTManager
-	kafkaProducer *kafka.Producer
+	outbox     *repository.OutboxRepository
+	secrets    *secretbox.Box
+	revoked    revocation.Store
+
+	verificationPolicy  LoginVerificationPolicy
+	passwordPolicy      *password.Policy
+	loginLimiter        *ratelimit.Limiter
+	loginLimits         LoginLimits
+	lockoutPolicy       LockoutPolicy
+	loginRiskPolicy     LoginRiskPolicy
+	geoIP               *geoip.Database
+	stepUpTokenDuration time.Duration
+	oidcIssuer          string
 }
 
 // NewAuthService creates a new auth service
 func NewAuthService(
 	userRepo *repository.UserRepository,
+	mfaRepo *repository.MFARepository,
+	roleRepo *repository.RoleRepository,
+	oauthRepo *repository.OAuthRepository,
+	auditRepo *repository.AuditRepository,
 	jwtManager *jwt.JWTManager,
-	kafkaProducer *kafka.Producer) *AuthService {
+	outbox *repository.OutboxRepository,
+	secrets *secretbox.Box,
+	revoked revocation.Store) *AuthService {
 
 	return &AuthService{
 		userRepo:   userRepo,
+		mfaRepo:    mfaRepo,
+		roleRepo:   roleRepo,
+		oauthRepo:  oauthRepo,
+		auditRepo:  auditRepo,
 		jwtManager: jwtManager,
-		kafkaProducer: kafkaProducer,
+		outbox:     outbox,
+		secrets:    secrets,
+		revoked:    revoked,
+
+		verificationPolicy:  LoginVerificationNone,
+		passwordPolicy:      password.DefaultPolicy(),
+		loginLimiter:        ratelimit.NewLimiter(ratelimit.NewMemoryStore(), 15*time.Minute),
+		loginLimits:         DefaultLoginLimits(),
+		lockoutPolicy:       DefaultLockoutPolicy(),
+		loginRiskPolicy:     DefaultLoginRiskPolicy(),
+		stepUpTokenDuration: 5 * time.Minute,
 	}
 }
 
@@ -52,6 +101,10 @@ func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest)
 		return nil, ErrEmailAlreadyExists
 	}
 
+	if err := s.checkPasswordPolicy(req.Password, req.Email); err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	hashedPassword, err := hash.HashPassword(req.Password)
 	if err != nil {
@@ -70,43 +123,55 @@ func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest)
 		UpdatedAt:    time.Now(),
 	}
 
-	err = s.userRepo.CreateUser(ctx, user)
+	// Record user.registered event in the same transaction as the user
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.CreateUser(ctx, user); err != nil {
+			return err
+		}
+		if err := s.roleRepo.AssignRole(ctx, user.ID, RoleCustomer, nil); err != nil {
+			return err
+		}
+		err := s.enqueue(ctx, user.ID, events.TypeUserRegistered, &events.UserRegistered{
+			UserID:     user.ID,
+			Email:      user.Email,
+			Phone:      user.Phone,
+			IsVerified: user.IsVerified,
+			CreatedAt:  user.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Send verification codes for every channel the user registered
+		if err := s.sendVerification(ctx, user, models.VerificationChannelEmail, user.Email); err != nil {
+			return err
+		}
+		if user.Phone != nil {
+			return s.sendVerification(ctx, user, models.VerificationChannelPhone, *user.Phone)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Publish user.registered event to Kafka
-	event := &kafka.Event{
-		EventID: uuid.New().String(),
-		EventType: "user.registered",
-		UserID: user.ID,
-		Email: user.Email,
-		Data: map[string]interface{}{
-			"is_verified": user.IsVerified,
-			"created_at": user.CreatedAt,
-		},
-		Timestamp: time.Now(),
-	}
-
-	go func() {
-		if err := s.kafkaProducer.PublishEvent(context.Background(), event); err != nil {
-			log.Printf("error publishing")
-			//TODO: add message queue retry mechanism
-		}
-	}()
-
-	// TODO: Send verification email
-
 	return user, nil
 }
 
 // Login authenticates a user and returns tokens
 func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest, ipAddress, userAgent string) (*models.LoginResponse, error) {
+	// Throttle by IP and email before looking at the account, so unknown
+	// emails are throttled too
+	keys := s.loginKeys(ipAddress, req.Email)
+	if err := s.checkLoginThrottle(ctx, keys); err != nil {
+		return nil, err
+	}
+
 	// Get user by email
 	user, err := s.userRepo.GetUserByEmail(ctx, req.Email)
 	if err != nil {
 		if err == repository.ErrUserNotFound {
-			return nil, ErrInvalidCredentials
+			return nil, s.failLogin(ctx, keys, uuid.Nil, ipAddress)
 		}
 		return nil, err
 	}
@@ -123,55 +188,116 @@ func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest, ipAdd
 
 	// Verify password
 	if !hash.CheckPassword(req.Password, user.PasswordHash) {
-		// Increment failed attempts
-		_ = s.userRepo.IncrementFailedLoginAttempts(ctx, user.ID)
-		return nil, ErrInvalidCredentials
+		return nil, s.failLogin(ctx, keys, user.ID, ipAddress)
+	}
+
+	// The password is right, so this client and email start over; the IP
+	// keeps its count
+	if err := s.loginLimiter.Reset(ctx, keys[1:]...); err != nil {
+		return nil, err
+	}
+
+	// An admin has made the password unusable until it is reset
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
 	}
 
-	// Generate tokens
-	tokenPair, err := s.jwtManager.GenerateTokenPair(user.ID, user.Email)
+	// Check verification only after the password, so it reveals nothing
+	// about the account to someone without the password
+	if err := s.checkLoginVerification(user); err != nil {
+		return nil, err
+	}
+
+	client := loginClient{
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		Fingerprint: deviceFingerprint(userAgent, req.DeviceID),
+	}
+
+	assessment, err := s.assessLogin(ctx, user, client)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create session
-	session := &models.Session{
-		ID:           uuid.New(),
-		UserID:       user.ID,
-		RefreshToken: tokenPair.RefreshToken,
-		ExpiresAt:    time.Now().Add(7 * 24 * time.Hour), // 7 days
-		IPAddress:    &ipAddress,
-		UserAgent:    &userAgent,
-		CreatedAt:    time.Now(),
+	stepUp := assessment.suspicious() && s.loginRiskPolicy.StepUp
+	if assessment.suspicious() {
+		if err := s.reportSuspiciousLogin(ctx, user, client, assessment, stepUp || user.MFAEnabled); err != nil {
+			return nil, err
+		}
+	}
+
+	// Users with MFA get a challenge to complete with VerifyMFA, and so do
+	// suspicious logins when stepping up, with a code sent by email
+	if user.MFAEnabled {
+		return s.startMFAChallenge(ctx, user, client, models.MFAMethodTOTP)
+	}
+	if stepUp {
+		return s.startMFAChallenge(ctx, user, client, models.MFAMethodEmail)
 	}
 
-	err = s.userRepo.CreateSession(ctx, session)
+	return s.completeLogin(ctx, user, client, assessment, []string{jwt.AMRPassword})
+}
+
+// completeLogin issues tokens and creates a session for an authenticated
+// user, recording the login in their history. amr lists the methods the
+// user authenticated with.
+func (s *AuthService) completeLogin(ctx context.Context, user *models.User, client loginClient, assessment *loginAssessment, amr []string) (*models.LoginResponse, error) {
+	ipAddress, userAgent := client.IPAddress, client.UserAgent
+	authTime := time.Now()
+
+	// Generate tokens for a new refresh token family
+	sessionID := uuid.New()
+	identity, err := s.identityOf(ctx, user, sessionID)
 	if err != nil {
 		return nil, err
 	}
+	identity.AuthTime = authTime
+	identity.AMR = amr
 
-	// Update last login
-	err = s.userRepo.UpdateLastLogin(ctx, user.ID)
+	tokenPair, err := s.jwtManager.GenerateTokenPair(identity)
 	if err != nil {
 		return nil, err
 	}
 
-	event := &kafka.Event{
-		EventID:   uuid.New().String(),
-		EventType: "user.logged_in",
-		UserID:    user.ID,
-		Email:     user.Email,
-		Data: map[string]interface{}{
-			"ip_address": ipAddress,
-			"user_agent": userAgent,
-			"login_time": time.Now(),
-		},
-		Timestamp: time.Now(),
+	// Create session
+	session := &models.Session{
+		ID:               sessionID,
+		UserID:           user.ID,
+		RefreshTokenHash: hash.HashToken(tokenPair.RefreshToken),
+		FamilyID:         sessionID,
+		ExpiresAt:        time.Now().Add(7 * 24 * time.Hour), // 7 days
+		IPAddress:        &ipAddress,
+		UserAgent:        &userAgent,
+		AuthTime:         &authTime,
+		AMR:              amr,
+		CreatedAt:        time.Now(),
 	}
 
-	go func() {
-		_ = s.kafkaProducer.PublishEvent(context.Background(), event)
-	}()
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.CreateSession(ctx, session); err != nil {
+			return err
+		}
+
+		// Update last login
+		if err := s.userRepo.UpdateLastLogin(ctx, user.ID); err != nil {
+			return err
+		}
+
+		if err := s.recordLogin(ctx, user, sessionID, client, assessment); err != nil {
+			return err
+		}
+
+		return s.enqueue(ctx, user.ID, events.TypeUserLoggedIn, &events.UserLoggedIn{
+			UserID:    user.ID,
+			Email:     user.Email,
+			IPAddress: ipAddress,
+			UserAgent: userAgent,
+			LoginTime: time.Now(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	user.PasswordHash = ""
 
@@ -183,20 +309,17 @@ func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest, ipAdd
 	}, nil
 }
 
-// RefreshToken generates new access token from refresh token
-func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*models.LoginResponse, error) {
+// RefreshToken rotates a refresh token: the presented token's session is
+// marked rotated and a new session is created in the same family. Presenting
+// a token that was already rotated means it was copied, so the whole family
+// is revoked and a user.session.compromised event is recorded.
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken, ipAddress, userAgent string) (*models.LoginResponse, error) {
 	// Validate refresh token
 	claims, err := s.jwtManager.ValidateRefreshToken(refreshToken)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get session
-	session, err := s.userRepo.GetSessionByRefreshToken(ctx, refreshToken)
-	if err != nil {
-		return nil, err
-	}
-
 	// Parse user ID from claims
 	userID, err := uuid.Parse(claims.Subject)
 	if err != nil {
@@ -214,26 +337,80 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*m
 		return nil, ErrAccountInactive
 	}
 
-	// Generate new tokens
-	tokenPair, err := s.jwtManager.GenerateTokenPair(user.ID, user.Email)
+	var tokenPair *jwt.TokenPair
+	var reusedFamily *uuid.UUID
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		session, err := s.userRepo.GetSessionByRefreshTokenHash(ctx, hash.HashToken(refreshToken))
+		if err != nil {
+			return err
+		}
+
+		if session.UserID != userID || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		if session.RotatedAt != nil {
+			// Commit the revocation, then report the reuse
+			reusedFamily = &session.FamilyID
+			if err := s.userRepo.RevokeSessionFamily(ctx, session.FamilyID); err != nil {
+				return err
+			}
+			return s.enqueue(ctx, userID, events.TypeUserSessionCompromised, &events.UserSessionCompromised{
+				UserID:     userID,
+				FamilyID:   session.FamilyID,
+				SessionID:  session.ID,
+				IPAddress:  ipAddress,
+				UserAgent:  userAgent,
+				DetectedAt: time.Now(),
+			})
+		}
+
+		// Generate new tokens in the same family, picking up any role changes
+		// but keeping the time and methods of the login
+		identity, err := s.identityOf(ctx, user, session.FamilyID)
+		if err != nil {
+			return err
+		}
+		if session.AuthTime != nil {
+			identity.AuthTime = *session.AuthTime
+		}
+		identity.AMR = session.AMR
+
+		tokenPair, err = s.jwtManager.GenerateTokenPair(identity)
+		if err != nil {
+			return err
+		}
+
+		if err := s.userRepo.MarkSessionRotated(ctx, session.ID); err != nil {
+			return err
+		}
+
+		return s.userRepo.CreateSession(ctx, &models.Session{
+			ID:               uuid.New(),
+			UserID:           userID,
+			RefreshTokenHash: hash.HashToken(tokenPair.RefreshToken),
+			FamilyID:         session.FamilyID,
+			ParentID:         &session.ID,
+			ExpiresAt:        time.Now().Add(7 * 24 * time.Hour),
+			IPAddress:        &ipAddress,
+			UserAgent:        &userAgent,
+			AuthTime:         session.AuthTime,
+			AMR:              session.AMR,
+			CreatedAt:        time.Now(),
+		})
+	})
 	if err != nil {
+		if err == repository.ErrSessionNotFound {
+			return nil, ErrInvalidRefreshToken
+		}
 		return nil, err
 	}
 
-	// Update session with new refresh token
-	_ = s.userRepo.DeleteSession(ctx, refreshToken)
-	newSession := &models.Session{
-		ID:           uuid.New(),
-		UserID:       user.ID,
-		RefreshToken: tokenPair.RefreshToken,
-		ExpiresAt:    time.Now().Add(7 * 24 * time.Hour),
-		IPAddress:    session.IPAddress,
-		UserAgent:    session.UserAgent,
-		CreatedAt:    time.Now(),
-	}
-	err = s.userRepo.CreateSession(ctx, newSession)
-	if err != nil {
-		return nil, err
+	if reusedFamily != nil {
+		if err := s.revokeSessionTokens(ctx, userID, *reusedFamily); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
 	}
 
 	// Remove password hash from response
@@ -247,9 +424,34 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*m
 	}, nil
 }
 
-// Logout invalidates refresh token
-func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
-	return s.userRepo.DeleteSession(ctx, refreshToken)
+// Logout revokes the session family of a refresh token along with its
+// access tokens. accessToken, if not empty, is revoked as well.
+func (s *AuthService) Logout(ctx context.Context, refreshToken, accessToken string) error {
+	if accessToken != "" {
+		if err := s.revokeAccessToken(ctx, accessToken); err != nil {
+			return err
+		}
+	}
+
+	var session *models.Session
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		session, err = s.userRepo.GetSessionByRefreshTokenHash(ctx, hash.HashToken(refreshToken))
+		if err != nil {
+			return err
+		}
+
+		return s.userRepo.RevokeSessionFamily(ctx, session.FamilyID)
+	})
+	if err == repository.ErrSessionNotFound {
+		// Already gone, nothing to log out of
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.revokeSessionTokens(ctx, session.UserID, session.FamilyID)
 }
 
 // GetUserByID retrieves user by ID
@@ -264,19 +466,110 @@ func (s *AuthService) GetUserByID(ctx context.Context, userID uuid.UUID) (*model
 	return user, nil
 }
 
-// Reset password
-// func (s *AuthService) ResetPassword(ctx context.Context, email string) (string, error) {
-// 	user, err := s.userRepo.GetUserByEmail(ctx, email)
+// enqueue wraps data in an event envelope and records it in the outbox, to be
+// relayed to Kafka by outbox.Relay once the surrounding transaction commits
+func (s *AuthService) enqueue(ctx context.Context, userID uuid.UUID, eventType string, data interface{}) error {
+	event, err := events.New(eventType, userID.String(), data)
+	if err != nil {
+		return err
+	}
 
-// 	if err != nil {
-// 		return "", err
-// 	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
 
-// 	// Check if account is active
-// 	if !user.IsActive {
-// 		return "", ErrAccountInactive
-// 	}
+	return s.outbox.CreateEvent(ctx, &models.OutboxEvent{
+		ID:          uuid.New(),
+		AggregateID: userID,
+		EventType:   eventType,
+		Payload:     payload,
+		CreatedAt:   time.Now(),
+	})
+}
 
-// }
+// RequestPasswordReset issues a reset token for the user with the given email
+// and records a user.password_reset_requested event carrying it. Unknown and
+// inactive accounts are ignored silently so callers cannot tell which emails
+// are registered.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, req *models.PasswordResetRequest) error {
+	user, err := s.userRepo.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		if err == repository.ErrUserNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if !user.IsActive {
+		return nil
+	}
+
+	return s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		return s.issuePasswordReset(ctx, user)
+	})
+}
+
+// issuePasswordReset creates a reset token for the user and records a
+// user.password_reset_requested event carrying it. It must run inside a
+// transaction.
+func (s *AuthService) issuePasswordReset(ctx context.Context, user *models.User) error {
+	token, err := hash.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	resetToken := &models.PasswordResetToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: hash.HashToken(token),
+		ExpiresAt: now.Add(passwordResetExpiry),
+		CreatedAt: now,
+	}
 
-// Verify email/phone
+	if err := s.userRepo.CreatePasswordResetToken(ctx, resetToken); err != nil {
+		return err
+	}
+
+	return s.enqueue(ctx, user.ID, events.TypeUserPasswordResetRequested, &events.UserPasswordResetRequested{
+		UserID:      user.ID,
+		Email:       user.Email,
+		ResetToken:  token,
+		ExpiresAt:   resetToken.ExpiresAt,
+		RequestedAt: now,
+	})
+}
+
+// ResetPassword sets a new password using a reset token and revokes all of
+// the user's sessions and access tokens. A password rejected by the policy
+// leaves the token unused.
+func (s *AuthService) ResetPassword(ctx context.Context, req *models.PasswordResetConfirm) error {
+	var userID uuid.UUID
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		token, err := s.userRepo.ConsumePasswordResetToken(ctx, hash.HashToken(req.Token))
+		if err != nil {
+			return err
+		}
+		userID = token.UserID
+
+		user, err := s.userRepo.GetUserByID(ctx, token.UserID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.setPassword(ctx, user, req.NewPassword); err != nil {
+			return err
+		}
+
+		return s.userRepo.DeleteUserSessions(ctx, token.UserID)
+	})
+	if err == repository.ErrResetTokenInvalid {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.revokeAllTokens(ctx, userID)
+}
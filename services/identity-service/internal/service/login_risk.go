@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/events"
+	"github.com/Caesarsage/bankflow/identity-service/internal/geoip"
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/hash"
+	"github.com/google/uuid"
+)
+
+// Reasons a login is flagged as suspicious
+const (
+	LoginRiskNewDevice        = "new_device"
+	LoginRiskImpossibleTravel = "impossible_travel"
+	LoginRiskUnusualHour      = "unusual_hour"
+)
+
+const (
+	// Previous logins looked at for the usual login hours
+	loginHistoryWindow = 50
+
+	// GeoIP places an address at a city, or just a country, so shorter
+	// distances are never treated as travel
+	minTravelDistanceKm = 300
+
+	// A login within this many hours of a previous login's hour of day is
+	// at a usual hour
+	usualHourTolerance = 1
+)
+
+// LoginRiskPolicy controls which logins are flagged as suspicious and what
+// happens to them
+type LoginRiskPolicy struct {
+	// MaxTravelSpeed is the fastest believable travel between two logins,
+	// in km/h. 0 disables impossible travel detection.
+	MaxTravelSpeed float64
+
+	// UnusualHourMinLogins is how many previous logins a user needs before
+	// a login at an hour they have not logged in at is unusual. 0 disables
+	// unusual hour detection.
+	UnusualHourMinLogins int
+
+	// StepUp requires a second factor for suspicious logins. Users without
+	// MFA are emailed a one-time code; users with MFA are always challenged.
+	StepUp bool
+}
+
+// DefaultLoginRiskPolicy flags travel faster than an airliner and hours
+// unlike the user's last 10 logins, without stepping up
+func DefaultLoginRiskPolicy() LoginRiskPolicy {
+	return LoginRiskPolicy{
+		MaxTravelSpeed:       900,
+		UnusualHourMinLogins: 10,
+	}
+}
+
+// SetLoginRiskPolicy sets how suspicious logins are detected and handled
+func (s *AuthService) SetLoginRiskPolicy(policy LoginRiskPolicy) {
+	s.loginRiskPolicy = policy
+}
+
+// SetGeoIP sets the database used to locate login IP addresses. Without one,
+// impossible travel is not detected.
+func (s *AuthService) SetGeoIP(db *geoip.Database) {
+	s.geoIP = db
+}
+
+// loginClient describes the device a login comes from
+type loginClient struct {
+	IPAddress   string
+	UserAgent   string
+	Fingerprint string
+}
+
+// versionPattern matches version numbers, which change with every browser
+// or OS update
+var versionPattern = regexp.MustCompile(`[0-9]+([._][0-9]+)*`)
+
+// deviceFingerprint identifies a device by the ID the app gave it, or else
+// by its user agent with version numbers removed, so updates do not make a
+// device look new
+func deviceFingerprint(userAgent, deviceID string) string {
+	if deviceID != "" {
+		return hash.HashToken("device:" + deviceID)
+	}
+	agent := versionPattern.ReplaceAllString(strings.ToLower(userAgent), "")
+	return hash.HashToken("ua:" + agent)
+}
+
+// loginAssessment is why a login looks suspicious, if it does, along with
+// where it comes from
+type loginAssessment struct {
+	Reasons  []string
+	Location *geoip.Location
+
+	// Set for impossible travel
+	Previous   *models.LoginRecord
+	DistanceKm *float64
+	SpeedKmh   *float64
+}
+
+func (a *loginAssessment) suspicious() bool {
+	return len(a.Reasons) > 0
+}
+
+// assessLogin compares a login with the user's known devices and previous
+// logins
+func (s *AuthService) assessLogin(ctx context.Context, user *models.User, client loginClient) (*loginAssessment, error) {
+	now := time.Now()
+	assessment := &loginAssessment{Reasons: []string{}}
+	if s.geoIP != nil {
+		assessment.Location = s.geoIP.Lookup(client.IPAddress)
+	}
+
+	// A user's first device is not new
+	known, hasDevices, err := s.userRepo.GetDeviceStatus(ctx, user.ID, client.Fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if hasDevices && !known {
+		assessment.Reasons = append(assessment.Reasons, LoginRiskNewDevice)
+	}
+
+	history, err := s.userRepo.GetLoginHistory(ctx, user.ID, loginHistoryWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(history) > 0 && assessment.Location != nil && s.loginRiskPolicy.MaxTravelSpeed > 0 {
+		previous := history[0]
+		if previous.Latitude != nil && previous.Longitude != nil {
+			distance := geoip.DistanceKm(*assessment.Location, geoip.Location{
+				Latitude:  *previous.Latitude,
+				Longitude: *previous.Longitude,
+			})
+
+			// Logins in the same minute count as a minute apart
+			hours := max(now.Sub(previous.CreatedAt), time.Minute).Hours()
+			speed := distance / hours
+
+			if distance >= minTravelDistanceKm && speed > s.loginRiskPolicy.MaxTravelSpeed {
+				assessment.Reasons = append(assessment.Reasons, LoginRiskImpossibleTravel)
+				assessment.Previous = previous
+				assessment.DistanceKm = &distance
+				assessment.SpeedKmh = &speed
+			}
+		}
+	}
+
+	if minLogins := s.loginRiskPolicy.UnusualHourMinLogins; minLogins > 0 && len(history) >= minLogins {
+		if !isUsualHour(now, history) {
+			assessment.Reasons = append(assessment.Reasons, LoginRiskUnusualHour)
+		}
+	}
+
+	return assessment, nil
+}
+
+// isUsualHour reports whether any previous login was at about the same hour
+// of the day, in UTC
+func isUsualHour(at time.Time, history []*models.LoginRecord) bool {
+	hour := at.UTC().Hour()
+	for _, record := range history {
+		diff := hour - record.CreatedAt.UTC().Hour()
+		if diff < 0 {
+			diff = -diff
+		}
+		// Hours wrap around midnight
+		if min(diff, 24-diff) <= usualHourTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// reportSuspiciousLogin records a user.login.suspicious event.
+// stepUpRequired says whether the login needs a second factor to complete.
+func (s *AuthService) reportSuspiciousLogin(ctx context.Context, user *models.User, client loginClient, assessment *loginAssessment, stepUpRequired bool) error {
+	event := &events.UserLoginSuspicious{
+		UserID:            user.ID,
+		Email:             user.Email,
+		IPAddress:         client.IPAddress,
+		UserAgent:         client.UserAgent,
+		DeviceFingerprint: client.Fingerprint,
+		Reasons:           assessment.Reasons,
+		DistanceKm:        assessment.DistanceKm,
+		SpeedKmh:          assessment.SpeedKmh,
+		StepUpRequired:    stepUpRequired,
+		DetectedAt:        time.Now(),
+	}
+	if location := assessment.Location; location != nil {
+		event.Country = &location.Country
+		event.City = &location.City
+	}
+	if previous := assessment.Previous; previous != nil {
+		event.PreviousIPAddress = previous.IPAddress
+		event.PreviousCountry = previous.Country
+	}
+
+	return s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		return s.enqueue(ctx, user.ID, events.TypeUserLoginSuspicious, event)
+	})
+}
+
+// recordLogin adds a completed login to the user's login history and known
+// devices. It must run inside a transaction.
+func (s *AuthService) recordLogin(ctx context.Context, user *models.User, sessionID uuid.UUID, client loginClient, assessment *loginAssessment) error {
+	if err := s.userRepo.SaveDevice(ctx, user.ID, client.Fingerprint, client.UserAgent, client.IPAddress); err != nil {
+		return err
+	}
+
+	record := &models.LoginRecord{
+		ID:                uuid.New(),
+		UserID:            user.ID,
+		SessionID:         &sessionID,
+		IPAddress:         &client.IPAddress,
+		UserAgent:         &client.UserAgent,
+		DeviceFingerprint: &client.Fingerprint,
+		SuspiciousReasons: assessment.Reasons,
+		CreatedAt:         time.Now(),
+	}
+	if location := assessment.Location; location != nil {
+		record.Country = &location.Country
+		record.City = &location.City
+		record.Latitude = &location.Latitude
+		record.Longitude = &location.Longitude
+	}
+
+	return s.userRepo.CreateLoginRecord(ctx, record)
+}
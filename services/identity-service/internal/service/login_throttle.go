@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/events"
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/ratelimit"
+	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+	"github.com/google/uuid"
+)
+
+// LoginThrottledError is returned when too many logins have failed from the
+// client's IP, for the email, or both, with how long to wait
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return "too many failed login attempts"
+}
+
+// LoginLimits are the backoff rules for failed logins by IP address, by
+// email (including unregistered ones) and by the two together
+type LoginLimits struct {
+	IP      ratelimit.Rule
+	Email   ratelimit.Rule
+	IPEmail ratelimit.Rule
+}
+
+// DefaultLoginLimits allow a shared IP more failures than one account, and
+// one client on one account the fewest
+func DefaultLoginLimits() LoginLimits {
+	return LoginLimits{
+		IP:      ratelimit.Rule{Threshold: 20, BaseDelay: time.Second, MaxDelay: 15 * time.Minute},
+		Email:   ratelimit.Rule{Threshold: 5, BaseDelay: time.Second, MaxDelay: 15 * time.Minute},
+		IPEmail: ratelimit.Rule{Threshold: 3, BaseDelay: time.Second, MaxDelay: 15 * time.Minute},
+	}
+}
+
+// LockoutPolicy locks an account for Duration after Threshold consecutive
+// failed passwords or MFA codes. A zero Threshold disables lockout.
+type LockoutPolicy struct {
+	Threshold int
+	Duration  time.Duration
+}
+
+// DefaultLockoutPolicy locks an account for 30 minutes after 5 failures
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		Threshold: 5,
+		Duration:  30 * time.Minute,
+	}
+}
+
+// SetLoginLimiter sets the limiter and rules that throttle failed logins
+func (s *AuthService) SetLoginLimiter(limiter *ratelimit.Limiter, limits LoginLimits) {
+	s.loginLimiter = limiter
+	s.loginLimits = limits
+}
+
+// SetLockoutPolicy sets when failed logins lock an account
+func (s *AuthService) SetLockoutPolicy(policy LockoutPolicy) {
+	s.lockoutPolicy = policy
+}
+
+// UnlockUser clears a user's lockout and the email throttle on their
+// account. Throttles on IP addresses are left to expire.
+func (s *AuthService) UnlockUser(ctx context.Context, admin Admin, userID uuid.UUID, reason string) error {
+	var user *models.User
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = s.userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.userRepo.UnlockUser(ctx, userID); err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditUnlockUser, &userID, map[string]interface{}{
+			"reason":          reason,
+			"locked_until":    user.LockedUntil,
+			"failed_attempts": user.FailedLoginAttempts,
+		})
+	})
+	if err == repository.ErrUserNotFound {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.loginLimiter.Reset(ctx, s.emailLoginKey(user.Email))
+}
+
+// loginKeys returns the throttled keys of a login attempt: the IP's first,
+// then the email's and the IP and email's, which a correct password clears
+func (s *AuthService) loginKeys(ipAddress, email string) []ratelimit.Key {
+	return []ratelimit.Key{
+		{Name: "ip:" + ipAddress, Rule: s.loginLimits.IP},
+		s.emailLoginKey(email),
+		{Name: "ip_email:" + ipAddress + "|" + normalizeEmail(email), Rule: s.loginLimits.IPEmail},
+	}
+}
+
+func (s *AuthService) emailLoginKey(email string) ratelimit.Key {
+	return ratelimit.Key{Name: "email:" + normalizeEmail(email), Rule: s.loginLimits.Email}
+}
+
+// checkLoginThrottle returns a LoginThrottledError if any key is blocked
+func (s *AuthService) checkLoginThrottle(ctx context.Context, keys []ratelimit.Key) error {
+	wait, err := s.loginLimiter.Check(ctx, keys...)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordFailedLogin counts a failed password or MFA code against a user's
+// account, recording a user.locked event if it locks the account
+func (s *AuthService) recordFailedLogin(ctx context.Context, userID uuid.UUID, ipAddress string) error {
+	return s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		locked, err := s.userRepo.IncrementFailedLoginAttempts(ctx, userID, s.lockoutPolicy.Threshold, s.lockoutPolicy.Duration)
+		if err != nil || !locked {
+			return err
+		}
+
+		user, err := s.userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		lockedUntil := now.Add(s.lockoutPolicy.Duration)
+		if user.LockedUntil != nil {
+			lockedUntil = *user.LockedUntil
+		}
+
+		return s.enqueue(ctx, userID, events.TypeUserLocked, &events.UserLocked{
+			UserID:      userID,
+			Email:       user.Email,
+			IPAddress:   ipAddress,
+			LockedUntil: lockedUntil,
+			LockedAt:    now,
+		})
+	})
+}
+
+// failLogin records a failed login attempt against the throttled keys and,
+// for a registered email, the account, then returns ErrInvalidCredentials
+func (s *AuthService) failLogin(ctx context.Context, keys []ratelimit.Key, userID uuid.UUID, ipAddress string) error {
+	if err := s.loginLimiter.Fail(ctx, keys...); err != nil {
+		return err
+	}
+
+	if userID != uuid.Nil {
+		if err := s.recordFailedLogin(ctx, userID, ipAddress); err != nil && err != repository.ErrUserNotFound {
+			return err
+		}
+	}
+
+	return ErrInvalidCredentials
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
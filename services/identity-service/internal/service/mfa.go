@@ -0,0 +1,482 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/events"
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/hash"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/jwt"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/totp"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("mfa is already enabled")
+	ErrMFANotEnabled     = errors.New("mfa is not enabled")
+	ErrMFANotEnrolled    = errors.New("no pending mfa enrollment")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+	ErrInvalidMFAToken   = errors.New("invalid or expired mfa token")
+)
+
+const (
+	mfaIssuer = "BankFlow"
+
+	// Codes from one step either side are accepted to allow for clock drift
+	mfaSkew = 1
+
+	mfaChallengeExpiry      = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+
+	// Digits of the code emailed for a stepped-up login
+	stepUpCodeDigits = 6
+
+	recoveryCodeCount    = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// EnrollMFA starts TOTP enrollment and returns the secret and provisioning
+// URI to show as a QR code. The enrollment takes effect once confirmed with
+// ConfirmMFA; enrolling again before that replaces the pending secret.
+func (s *AuthService) EnrollMFA(ctx context.Context, userID uuid.UUID) (*models.MFAEnrollment, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := s.secrets.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.mfaRepo.SaveEnrollment(ctx, &models.UserMFA{
+		UserID:          userID,
+		SecretEncrypted: sealed,
+		CreatedAt:       time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, mfaIssuer, user.Email),
+	}, nil
+}
+
+// ConfirmMFA enables MFA once the user proves their authenticator produces
+// valid codes, and returns a fresh set of recovery codes
+func (s *AuthService) ConfirmMFA(ctx context.Context, userID uuid.UUID, req *models.MFACodeRequest) (*models.MFARecoveryCodes, error) {
+	var codes []string
+
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		enrollment, err := s.mfaRepo.GetEnrollment(ctx, userID)
+		if err != nil {
+			if err == repository.ErrMFANotFound {
+				return ErrMFANotEnrolled
+			}
+			return err
+		}
+
+		if enrollment.ConfirmedAt != nil {
+			return ErrMFAAlreadyEnabled
+		}
+
+		secret, err := s.secrets.Open(enrollment.SecretEncrypted)
+		if err != nil {
+			return err
+		}
+
+		step, ok := totp.Validate(secret, req.Code, time.Now(), mfaSkew)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		if err := s.mfaRepo.ConfirmEnrollment(ctx, userID, step); err != nil {
+			return err
+		}
+
+		codes, err = s.issueRecoveryCodes(ctx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MFARecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// DisableMFA turns MFA off after re-authenticating the user with their
+// password and a TOTP or recovery code. Wrong passwords and codes count
+// towards the account lockout, as they do at login.
+func (s *AuthService) DisableMFA(ctx context.Context, userID uuid.UUID, req *models.MFADisableRequest, ipAddress string) error {
+	user, err := s.mfaUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.MFAEnabled {
+		return ErrMFANotEnabled
+	}
+
+	if !hash.CheckPassword(req.Password, user.PasswordHash) {
+		if err := s.recordFailedLogin(ctx, userID, ipAddress); err != nil {
+			return err
+		}
+		return ErrInvalidCredentials
+	}
+
+	mismatch := false
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		ok, err := s.checkSecondFactor(ctx, userID, req.Code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Commit the failed attempt, then report the mismatch
+			mismatch = true
+			return s.recordFailedLogin(ctx, userID, ipAddress)
+		}
+
+		return s.mfaRepo.DeleteEnrollment(ctx, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if mismatch {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking
+// a current TOTP code. Wrong codes count towards the account lockout.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, req *models.MFACodeRequest, ipAddress string) (*models.MFARecoveryCodes, error) {
+	if _, err := s.mfaUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	mismatch := false
+
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		ok, err := s.checkTOTP(ctx, userID, req.Code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Commit the failed attempt, then report the mismatch
+			mismatch = true
+			return s.recordFailedLogin(ctx, userID, ipAddress)
+		}
+
+		codes, err = s.issueRecoveryCodes(ctx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if mismatch {
+		return nil, ErrInvalidMFACode
+	}
+
+	return &models.MFARecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// mfaUser returns an active user who may try a second factor, refusing one
+// locked out by failed attempts
+func (s *AuthService) mfaUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return nil, ErrAccountLocked
+	}
+	if !user.IsActive {
+		return nil, ErrAccountInactive
+	}
+
+	return user, nil
+}
+
+// VerifyMFA completes a login started by Login with a TOTP or recovery code,
+// or with the emailed code for a stepped-up login.
+// Failed codes count towards both the challenge's attempt limit and the
+// account lockout.
+func (s *AuthService) VerifyMFA(ctx context.Context, req *models.MFAVerifyRequest) (*models.LoginResponse, error) {
+	var challenge *models.MFAChallenge
+	mismatch, usedOTP := false, false
+
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		challenge, err = s.mfaRepo.GetActiveChallenge(ctx, hash.HashToken(req.MFAToken))
+		if err != nil {
+			if err == repository.ErrMFAChallengeNotFound {
+				return ErrInvalidMFAToken
+			}
+			return err
+		}
+
+		var ok bool
+		if challenge.Method == models.MFAMethodEmail {
+			// Emailed codes are the only answer to an email challenge
+			ok = challenge.CodeHash != nil && req.Code != "" &&
+				subtle.ConstantTimeCompare([]byte(hash.HashToken(req.Code)), []byte(*challenge.CodeHash)) == 1
+			usedOTP = true
+		} else {
+			code := req.Code
+			if code == "" {
+				code = req.RecoveryCode
+			}
+
+			ok, err = s.checkSecondFactor(ctx, challenge.UserID, code)
+			if err != nil {
+				return err
+			}
+			usedOTP = isTOTPCode(code)
+		}
+
+		if !ok {
+			// Commit the failed attempt, then report the mismatch
+			mismatch = true
+			if err := s.mfaRepo.RecordChallengeAttempt(ctx, challenge.ID, mfaChallengeMaxAttempts); err != nil {
+				return err
+			}
+			var ipAddress string
+			if challenge.IPAddress != nil {
+				ipAddress = *challenge.IPAddress
+			}
+			return s.recordFailedLogin(ctx, challenge.UserID, ipAddress)
+		}
+
+		return s.mfaRepo.ConsumeChallenge(ctx, challenge.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if mismatch {
+		return nil, ErrInvalidMFACode
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account may have been locked or deactivated since the password step
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return nil, ErrAccountLocked
+	}
+	if !user.IsActive {
+		return nil, ErrAccountInactive
+	}
+
+	var client loginClient
+	if challenge.IPAddress != nil {
+		client.IPAddress = *challenge.IPAddress
+	}
+	if challenge.UserAgent != nil {
+		client.UserAgent = *challenge.UserAgent
+	}
+	if challenge.DeviceFingerprint != nil {
+		client.Fingerprint = *challenge.DeviceFingerprint
+	} else {
+		client.Fingerprint = deviceFingerprint(client.UserAgent, "")
+	}
+
+	assessment, err := s.assessLogin(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recovery codes are a second factor, but not a one-time password
+	amr := []string{jwt.AMRPassword, jwt.AMRMFA}
+	if usedOTP {
+		amr = append(amr, jwt.AMROTP)
+	}
+
+	return s.completeLogin(ctx, user, client, assessment, amr)
+}
+
+// startMFAChallenge records a challenge for a user who passed the password
+// check and returns its token in place of a token pair. An email challenge
+// also records a user.login.step_up_requested event carrying a one-time code
+// for the notifier to send.
+func (s *AuthService) startMFAChallenge(ctx context.Context, user *models.User, client loginClient, method string) (*models.LoginResponse, error) {
+	token, err := hash.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	challenge := &models.MFAChallenge{
+		ID:                uuid.New(),
+		UserID:            user.ID,
+		TokenHash:         hash.HashToken(token),
+		IPAddress:         &client.IPAddress,
+		UserAgent:         &client.UserAgent,
+		DeviceFingerprint: &client.Fingerprint,
+		Method:            method,
+		ExpiresAt:         now.Add(mfaChallengeExpiry),
+		CreatedAt:         now,
+	}
+
+	var code string
+	if method == models.MFAMethodEmail {
+		code, err = hash.GenerateNumericCode(stepUpCodeDigits)
+		if err != nil {
+			return nil, err
+		}
+		codeHash := hash.HashToken(code)
+		challenge.CodeHash = &codeHash
+	}
+
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.mfaRepo.CreateChallenge(ctx, challenge); err != nil {
+			return err
+		}
+
+		if code == "" {
+			return nil
+		}
+
+		return s.enqueue(ctx, user.ID, events.TypeUserLoginStepUpRequested, &events.UserLoginStepUpRequested{
+			UserID:    user.ID,
+			Email:     user.Email,
+			Code:      code,
+			IPAddress: client.IPAddress,
+			ExpiresAt: challenge.ExpiresAt,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		MFAMethod:   method,
+	}, nil
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code,
+// consuming the recovery code if it matches. It must run inside a transaction.
+func (s *AuthService) checkSecondFactor(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	if isTOTPCode(code) {
+		return s.checkTOTP(ctx, userID, code)
+	}
+
+	return s.mfaRepo.UseRecoveryCode(ctx, userID, hash.HashToken(normalizeRecoveryCode(code)))
+}
+
+// checkTOTP validates a code against the user's confirmed secret, rejecting
+// codes from a time step that was already used. It must run inside a
+// transaction.
+func (s *AuthService) checkTOTP(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	enrollment, err := s.mfaRepo.GetEnrollment(ctx, userID)
+	if err != nil {
+		if err == repository.ErrMFANotFound {
+			return false, ErrMFANotEnabled
+		}
+		return false, err
+	}
+
+	if enrollment.ConfirmedAt == nil {
+		return false, ErrMFANotEnabled
+	}
+
+	secret, err := s.secrets.Open(enrollment.SecretEncrypted)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), mfaSkew)
+	if !ok || step <= enrollment.LastUsedStep {
+		return false, nil
+	}
+
+	return true, s.mfaRepo.UpdateLastUsedStep(ctx, userID, step)
+}
+
+// issueRecoveryCodes generates recovery codes, stores their hashes and
+// returns the plaintext codes
+func (s *AuthService) issueRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hash.HashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code like "k7mq2-x9pta"
+func generateRecoveryCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// isTOTPCode reports whether a code has the form of a TOTP code rather than
+// a recovery code
+func isTOTPCode(code string) bool {
+	return len(code) == totp.Digits && isDigits(code)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
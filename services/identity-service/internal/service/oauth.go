@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/hash"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/jwt"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidClient       = errors.New("invalid client credentials")
+	ErrInvalidScope        = errors.New("invalid scope")
+	ErrInvalidAPIKey       = errors.New("invalid or expired api key")
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+)
+
+const (
+	// Client IDs and API key prefixes are public and say what they identify
+	clientIDPrefix = "bfc_"
+	apiKeyPrefix   = "bfk_"
+)
+
+// CreateOAuthClient registers a client allowed to request the given
+// scopes, each of which must be a known permission or OpenID scope. The
+// secret of a confidential client is returned once and only its hash is
+// kept; public clients get no secret and must use PKCE.
+func (s *AuthService) CreateOAuthClient(ctx context.Context, admin Admin, req *models.CreateOAuthClientRequest) (*models.OAuthClientCredentials, error) {
+	if err := s.checkGrantableScopes(ctx, req.Scopes); err != nil {
+		return nil, err
+	}
+
+	id, err := hash.GenerateHex(12)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret, secretHash string
+	if !req.Public {
+		secret, err = hash.GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+		secretHash = hash.HashToken(secret)
+	}
+
+	redirectURIs := req.RedirectURIs
+	if redirectURIs == nil {
+		redirectURIs = []string{}
+	}
+
+	client := &models.OAuthClient{
+		ID:           uuid.New(),
+		ClientID:     clientIDPrefix + id,
+		SecretHash:   secretHash,
+		Name:         req.Name,
+		Scopes:       req.Scopes,
+		RedirectURIs: redirectURIs,
+		Public:       req.Public,
+		CreatedBy:    &admin.ID,
+		CreatedAt:    time.Now(),
+	}
+
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.oauthRepo.CreateClient(ctx, client); err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditCreateOAuthClient, nil, map[string]interface{}{
+			"client_id":     client.ClientID,
+			"name":          client.Name,
+			"scopes":        client.Scopes,
+			"redirect_uris": client.RedirectURIs,
+			"public":        client.Public,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OAuthClientCredentials{
+		Client:       client,
+		ClientSecret: secret,
+	}, nil
+}
+
+// ListOAuthClients lists all OAuth clients, including revoked ones
+func (s *AuthService) ListOAuthClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	return s.oauthRepo.ListClients(ctx)
+}
+
+// RevokeOAuthClient revokes a client along with the access tokens already
+// issued to it
+func (s *AuthService) RevokeOAuthClient(ctx context.Context, admin Admin, clientID string) error {
+	var id uuid.UUID
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		id, err = s.oauthRepo.RevokeClient(ctx, clientID)
+		if err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditRevokeOAuthClient, nil, map[string]interface{}{
+			"client_id": clientID,
+		})
+	})
+	if err == repository.ErrOAuthClientNotFound {
+		return ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.revokeSessionTokens(ctx, uuid.Nil, id)
+}
+
+// ClientCredentialsToken issues an access token to a confidential OAuth
+// client for the client_credentials grant. scope is a space-separated subset
+// of the client's scopes, or empty for all of them. The token has no user;
+// its permissions are the granted scopes and its sid is the client's record
+// ID, so revoking the client revokes the token.
+func (s *AuthService) ClientCredentialsToken(ctx context.Context, clientID, clientSecret, scope string) (*models.OAuthTokenResponse, error) {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		return nil, ErrInvalidClient
+	}
+
+	scopes, err := requestedScopes(scope, permissionScopes(client.Scopes))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.oauthRepo.TouchClient(ctx, client.ID); err != nil {
+		return nil, err
+	}
+
+	return s.issueClientToken(jwt.Identity{
+		SessionID:   client.ID,
+		Permissions: scopes,
+		ClientID:    client.ClientID,
+		Scopes:      scopes,
+	})
+}
+
+// authenticateClient looks up an unrevoked client and checks its secret.
+// Public clients have no secret and must not send one.
+func (s *AuthService) authenticateClient(ctx context.Context, clientID, clientSecret string) (*models.OAuthClient, error) {
+	client, err := s.oauthRepo.GetClientByClientID(ctx, clientID)
+	if err == repository.ErrOAuthClientNotFound {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.RevokedAt != nil {
+		return nil, ErrInvalidClient
+	}
+
+	if client.Public {
+		if clientSecret != "" {
+			return nil, ErrInvalidClient
+		}
+	} else if !tokenHashMatches(clientSecret, client.SecretHash) {
+		return nil, ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// CreateAPIKey creates an API key for a user. Its scopes must be permissions
+// the user holds. The key is returned once and only its hash is kept.
+func (s *AuthService) CreateAPIKey(ctx context.Context, userID uuid.UUID, req *models.CreateAPIKeyRequest) (*models.CreatedAPIKey, error) {
+	roles, err := s.roleRepo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := req.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	if len(intersectScopes(scopes, roles.Permissions)) != len(scopes) {
+		return nil, ErrInvalidScope
+	}
+
+	id, err := hash.GenerateHex(6)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := hash.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// The prefix before the dot finds the key, the rest proves it
+	prefix := apiKeyPrefix + id
+	key := prefix + "." + secret
+
+	now := time.Now()
+	apiKey := &models.APIKey{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash.HashToken(key),
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := now.AddDate(0, 0, req.ExpiresIn)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	if err := s.oauthRepo.CreateAPIKey(ctx, apiKey); err != nil {
+		return nil, err
+	}
+
+	return &models.CreatedAPIKey{
+		APIKey: apiKey,
+		Key:    key,
+	}, nil
+}
+
+// ListAPIKeys lists a user's active API keys
+func (s *AuthService) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error) {
+	return s.oauthRepo.ListAPIKeys(ctx, userID)
+}
+
+// RevokeAPIKey revokes one of a user's API keys along with the access
+// tokens already issued for it
+func (s *AuthService) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID) error {
+	err := s.oauthRepo.RevokeAPIKey(ctx, userID, keyID)
+	if err == repository.ErrAPIKeyNotFound {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.revokeSessionTokens(ctx, userID, keyID)
+}
+
+// APIKeyToken exchanges an API key for an access token acting for the key's
+// owner. The token's permissions are the requested scopes that the owner
+// still holds, and its sid is the key's ID, so revoking the key revokes the
+// token.
+func (s *AuthService) APIKeyToken(ctx context.Context, key, scope string) (*models.OAuthTokenResponse, error) {
+	prefix, _, ok := strings.Cut(key, ".")
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.oauthRepo.GetAPIKeyByPrefix(ctx, prefix)
+	if err == repository.ErrAPIKeyNotFound {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+	if !tokenHashMatches(key, apiKey.KeyHash) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, apiKey.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrAccountInactive
+	}
+
+	scopes, err := requestedScopes(scope, apiKey.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := s.identityOf(ctx, user, apiKey.ID)
+	if err != nil {
+		return nil, err
+	}
+	identity.Permissions = intersectScopes(scopes, identity.Permissions)
+	identity.ClientID = apiKey.Prefix
+	identity.Scopes = scopes
+
+	if err := s.oauthRepo.TouchAPIKey(ctx, apiKey.ID); err != nil {
+		return nil, err
+	}
+
+	return s.issueClientToken(identity)
+}
+
+// issueClientToken signs an access token for the token endpoint response
+func (s *AuthService) issueClientToken(identity jwt.Identity) (*models.OAuthTokenResponse, error) {
+	accessToken, err := s.jwtManager.GenerateAccessToken(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.jwtManager.AccessTokenDuration().Seconds()),
+		Scope:       strings.Join(identity.Scopes, " "),
+	}, nil
+}
+
+// checkGrantableScopes returns ErrInvalidScope unless every scope is a
+// known permission or OpenID scope
+func (s *AuthService) checkGrantableScopes(ctx context.Context, scopes []string) error {
+	permissions, err := s.roleRepo.ListPermissions(ctx)
+	if err != nil {
+		return err
+	}
+
+	known := append([]string{}, oidcScopes...)
+	for _, permission := range permissions {
+		known = append(known, permission.Name)
+	}
+
+	if len(intersectScopes(scopes, known)) != len(scopes) {
+		return ErrInvalidScope
+	}
+	return nil
+}
+
+// requestedScopes parses a space-separated scope parameter, which must be a
+// subset of allowed. An empty parameter requests every allowed scope.
+func requestedScopes(scope string, allowed []string) ([]string, error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+
+	granted := intersectScopes(requested, allowed)
+	if len(granted) != len(requested) {
+		return nil, ErrInvalidScope
+	}
+	return granted, nil
+}
+
+// intersectScopes returns the scopes that are also in allowed, in order
+func intersectScopes(scopes, allowed []string) []string {
+	set := make(map[string]bool, len(allowed))
+	for _, a := range allowed {
+		set[a] = true
+	}
+
+	result := []string{}
+	for _, scope := range scopes {
+		if set[scope] {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+// tokenHashMatches compares a presented secret with a stored HashToken hash
+// in constant time
+func tokenHashMatches(secret, tokenHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash.HashToken(secret)), []byte(tokenHash)) == 1
+}
@@ -0,0 +1,407 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/hash"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/jwt"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidRedirectURI = errors.New("redirect uri is not registered for this client")
+	ErrInvalidGrant       = errors.New("invalid or expired authorization code")
+	ErrConsentNotFound    = errors.New("consent not found")
+	ErrInsufficientScope  = errors.New("token lacks the openid scope")
+)
+
+// OpenID Connect scopes. Any other scope a client requests is a permission.
+const (
+	ScopeOpenID = "openid"
+	ScopeEmail  = "email"
+	ScopePhone  = "phone"
+)
+
+var oidcScopes = []string{ScopeOpenID, ScopeEmail, ScopePhone}
+
+// authorizationCodeExpiry is how long a client has to redeem a code
+const authorizationCodeExpiry = 5 * time.Minute
+
+// SetOIDCIssuer sets the issuer URL of ID tokens and the discovery document
+func (s *AuthService) SetOIDCIssuer(issuer string) {
+	s.oidcIssuer = issuer
+}
+
+// Authorize handles an authorization request from the signed-in user's app.
+// An unknown client or unregistered redirect URI is returned as an error,
+// since the user must not be sent to an unverified URI; any other problem
+// is reported to the client through the redirect. If the user has not yet
+// consented to the requested scopes and req.Approve is false, the response
+// asks for consent instead.
+func (s *AuthService) Authorize(ctx context.Context, userID uuid.UUID, req *models.AuthorizeRequest) (*models.AuthorizeResponse, error) {
+	client, redirectURI, err := s.authorizingClient(ctx, req.ClientID, req.RedirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	reject := func(code, description string) (*models.AuthorizeResponse, error) {
+		return &models.AuthorizeResponse{
+			RedirectURI: withQuery(redirectURI, "error", code, "error_description", description, "state", req.State),
+		}, nil
+	}
+
+	if req.ResponseType != "code" {
+		return reject("unsupported_response_type", "Only the code response type is supported")
+	}
+
+	scopes, err := requestedScopes(req.Scope, client.Scopes)
+	if err != nil {
+		return reject("invalid_scope", "Requested scope is not allowed for this client")
+	}
+
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return reject("invalid_request", "PKCE with code_challenge_method S256 is required")
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrAccountInactive
+	}
+
+	consented := false
+	if req.Prompt != "consent" {
+		consented, err = s.hasConsent(ctx, userID, client.ClientID, scopes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !consented && !req.Approve {
+		if req.Prompt == "none" {
+			return reject("consent_required", "User consent is required")
+		}
+		return &models.AuthorizeResponse{
+			ConsentRequired: true,
+			ClientName:      client.Name,
+			Scopes:          scopes,
+		}, nil
+	}
+
+	code, err := hash.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	authCode := &models.AuthorizationCode{
+		ID:            uuid.New(),
+		CodeHash:      hash.HashToken(code),
+		ClientID:      client.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     now.Add(authorizationCodeExpiry),
+		CreatedAt:     now,
+	}
+	if req.Nonce != "" {
+		authCode.Nonce = &req.Nonce
+	}
+
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if !consented {
+			if err := s.oauthRepo.SaveConsent(ctx, userID, client.ClientID, scopes); err != nil {
+				return err
+			}
+		}
+		return s.oauthRepo.CreateAuthorizationCode(ctx, authCode)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthorizeResponse{
+		RedirectURI: withQuery(redirectURI, "code", code, "state", req.State),
+	}, nil
+}
+
+// CheckAuthorizeRequest returns ErrInvalidClient or ErrInvalidRedirectURI
+// if a browser must not be sent on to sign in with an authorization request
+func (s *AuthService) CheckAuthorizeRequest(ctx context.Context, clientID, redirectURI string) error {
+	_, _, err := s.authorizingClient(ctx, clientID, redirectURI)
+	return err
+}
+
+// authorizingClient returns the active client an authorization request is
+// for, and the registered redirect URI to answer it at
+func (s *AuthService) authorizingClient(ctx context.Context, clientID, requested string) (*models.OAuthClient, string, error) {
+	client, err := s.oauthRepo.GetClientByClientID(ctx, clientID)
+	if err == repository.ErrOAuthClientNotFound {
+		return nil, "", ErrInvalidClient
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if client.RevokedAt != nil {
+		return nil, "", ErrInvalidClient
+	}
+
+	redirectURI, err := registeredRedirectURI(client, requested)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client, redirectURI, nil
+}
+
+// AuthorizationCodeToken redeems an authorization code for an access token,
+// plus an ID token if the openid scope was granted. The code must be
+// redeemed once, by the client it was issued to, with the PKCE verifier of
+// its challenge and the redirect URI it was requested with. It is only
+// marked used once all of those check out. Redeeming a code twice means it
+// was intercepted, so the tokens from the first redemption are revoked.
+func (s *AuthService) AuthorizationCodeToken(ctx context.Context, clientID, clientSecret, code, redirectURI, codeVerifier string) (*models.OAuthTokenResponse, error) {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	var authCode *models.AuthorizationCode
+	reused := false
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		authCode, err = s.oauthRepo.GetAuthorizationCode(ctx, hash.HashToken(code))
+		if err != nil {
+			return err
+		}
+
+		// Another client cannot burn a code, or revoke what it was redeemed for
+		if authCode.ClientID != client.ClientID {
+			return ErrInvalidGrant
+		}
+
+		if authCode.UsedAt != nil {
+			reused = true
+			return nil
+		}
+
+		// redirect_uri must be sent again if it was sent to authorize, and
+		// may only be left out if it was left out there too
+		if redirectURI != authCode.RedirectURI && (authCode.RedirectURI != "" || !soleRedirectURI(client, redirectURI)) {
+			return ErrInvalidGrant
+		}
+
+		if time.Now().After(authCode.ExpiresAt) || !verifyPKCE(codeVerifier, authCode.CodeChallenge) {
+			return ErrInvalidGrant
+		}
+
+		return s.oauthRepo.MarkAuthorizationCodeUsed(ctx, authCode.ID)
+	})
+	if err == repository.ErrAuthorizationCodeNotFound {
+		return nil, ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if reused {
+		if err := s.revokeSessionTokens(ctx, authCode.UserID, authCode.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidGrant
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, authCode.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrInvalidGrant
+	}
+
+	// The code's ID is the token's sid, so a replayed code revokes it
+	identity, err := s.identityOf(ctx, user, authCode.ID)
+	if err != nil {
+		return nil, err
+	}
+	identity.Permissions = intersectScopes(permissionScopes(authCode.Scopes), identity.Permissions)
+	identity.ClientID = client.ClientID
+	identity.Scopes = authCode.Scopes
+
+	response, err := s.issueClientToken(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	if containsScope(authCode.Scopes, ScopeOpenID) {
+		claims := jwt.IDTokenClaims{}
+		if authCode.Nonce != nil {
+			claims.Nonce = *authCode.Nonce
+		}
+		info := userInfoFor(user, authCode.Scopes)
+		claims.Email, claims.EmailVerified = info.Email, info.EmailVerified
+		claims.PhoneNumber, claims.PhoneNumberVerified = info.PhoneNumber, info.PhoneNumberVerified
+
+		response.IDToken, err = s.jwtManager.GenerateIDToken(s.oidcIssuer, client.ClientID, user.ID, response.AccessToken, claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.oauthRepo.TouchClient(ctx, client.ID); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// UserInfo returns the OpenID claims of a user. scopes are the scopes of the
+// access token presented, or nil for a token from an interactive sign-in,
+// which sees every claim.
+func (s *AuthService) UserInfo(ctx context.Context, userID uuid.UUID, scopes []string) (*models.UserInfo, error) {
+	if scopes != nil && !containsScope(scopes, ScopeOpenID) {
+		return nil, ErrInsufficientScope
+	}
+	if scopes == nil {
+		scopes = oidcScopes
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return userInfoFor(user, scopes), nil
+}
+
+// ListConsents lists the clients a user has authorized
+func (s *AuthService) ListConsents(ctx context.Context, userID uuid.UUID) ([]*models.OAuthConsent, error) {
+	return s.oauthRepo.ListConsents(ctx, userID)
+}
+
+// RevokeConsent withdraws a user's consent to a client, so its next
+// authorization request asks again
+func (s *AuthService) RevokeConsent(ctx context.Context, userID uuid.UUID, clientID string) error {
+	err := s.oauthRepo.DeleteConsent(ctx, userID, clientID)
+	if err == repository.ErrConsentNotFound {
+		return ErrConsentNotFound
+	}
+	return err
+}
+
+// hasConsent reports whether a user has already allowed a client every scope
+func (s *AuthService) hasConsent(ctx context.Context, userID uuid.UUID, clientID string, scopes []string) (bool, error) {
+	consent, err := s.oauthRepo.GetConsent(ctx, userID, clientID)
+	if err == repository.ErrConsentNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return len(intersectScopes(scopes, consent.Scopes)) == len(scopes), nil
+}
+
+// userInfoFor returns the claims of a user that the scopes allow
+func userInfoFor(user *models.User, scopes []string) *models.UserInfo {
+	info := &models.UserInfo{Subject: user.ID.String()}
+
+	if containsScope(scopes, ScopeEmail) {
+		info.Email = user.Email
+		info.EmailVerified = &user.EmailVerified
+	}
+
+	if containsScope(scopes, ScopePhone) && user.Phone != nil {
+		info.PhoneNumber = *user.Phone
+		info.PhoneNumberVerified = &user.PhoneVerified
+	}
+
+	return info
+}
+
+// registeredRedirectURI returns the redirect URI to use for a request. It
+// must exactly match one the client registered, and may be omitted only if
+// the client registered exactly one.
+func registeredRedirectURI(client *models.OAuthClient, requested string) (string, error) {
+	if requested == "" {
+		if len(client.RedirectURIs) == 1 {
+			return client.RedirectURIs[0], nil
+		}
+		return "", ErrInvalidRedirectURI
+	}
+
+	for _, uri := range client.RedirectURIs {
+		if uri == requested {
+			return uri, nil
+		}
+	}
+	return "", ErrInvalidRedirectURI
+}
+
+// soleRedirectURI reports whether uri is the client's only registered
+// redirect URI, the one an authorization request without one was sent to
+func soleRedirectURI(client *models.OAuthClient, uri string) bool {
+	return len(client.RedirectURIs) == 1 && client.RedirectURIs[0] == uri
+}
+
+// withQuery adds name, value pairs to a URI's query, skipping empty values
+func withQuery(uri string, pairs ...string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	query := u.Query()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			query.Set(pairs[i], pairs[i+1])
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// verifyPKCE checks a code verifier against an S256 code challenge
+// (RFC 7636 section 4.6)
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// permissionScopes returns the scopes that are permissions rather than
+// OpenID scopes
+func permissionScopes(scopes []string) []string {
+	result := []string{}
+	for _, scope := range scopes {
+		if !containsScope(oidcScopes, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
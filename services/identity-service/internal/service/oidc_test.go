@@ -0,0 +1,67 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// TestVerifyPKCE checks S256 verification against the example in RFC 7636
+// appendix B
+func TestVerifyPKCE(t *testing.T) {
+	const (
+		rfcVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		rfcChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"rfc 7636 example", rfcVerifier, rfcChallenge, true},
+		{"wrong verifier", strings.Replace(rfcVerifier, "d", "e", 1), rfcChallenge, false},
+		{"plain challenge", rfcVerifier, rfcVerifier, false},
+		{"padded challenge", rfcVerifier, rfcChallenge + "=", false},
+		{"empty challenge", rfcVerifier, "", false},
+		{"empty verifier", "", rfcChallenge, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("verifyPKCE(%q, %q) = %v, want %v", tt.verifier, tt.challenge, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestVerifyPKCELengthLimits checks the verifier length limits of RFC 7636
+// section 4.1: verifiers at the limits are accepted when they match their
+// challenge and those past them never are
+func TestVerifyPKCELengthLimits(t *testing.T) {
+	tests := []struct {
+		length int
+		want   bool
+	}{
+		{42, false},
+		{43, true},
+		{128, true},
+		{129, false},
+	}
+
+	for _, tt := range tests {
+		verifier := strings.Repeat("a", tt.length)
+		challenge := s256Challenge(verifier)
+		if got := verifyPKCE(verifier, challenge); got != tt.want {
+			t.Errorf("verifyPKCE with a %d character verifier = %v, want %v", tt.length, got, tt.want)
+		}
+	}
+}
+
+func s256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/password"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/hash"
+)
+
+// PasswordPolicyError is returned when a new password breaks the password
+// policy, with every rule it breaks
+type PasswordPolicyError struct {
+	Violations []models.PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet the password policy"
+}
+
+// SetPasswordPolicy sets the rules new passwords must follow
+func (s *AuthService) SetPasswordPolicy(policy *password.Policy) {
+	s.passwordPolicy = policy
+}
+
+// checkPasswordPolicy returns a PasswordPolicyError if a new password for
+// the given email breaks the policy
+func (s *AuthService) checkPasswordPolicy(newPassword, email string) error {
+	if violations := s.passwordPolicy.Check(newPassword, email); len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// setPassword checks a user's new password against the policy and their
+// current and previous passwords, then stores it and moves the old hash into
+// the history. It should run in a transaction. Reuse is only checked once
+// the other rules pass, since each comparison costs a bcrypt hash.
+func (s *AuthService) setPassword(ctx context.Context, user *models.User, newPassword string) error {
+	if err := s.checkPasswordPolicy(newPassword, user.Email); err != nil {
+		return err
+	}
+
+	if history := s.passwordPolicy.History; history > 0 {
+		previous, err := s.userRepo.GetPasswordHistory(ctx, user.ID, history)
+		if err != nil {
+			return err
+		}
+
+		for _, passwordHash := range append([]string{user.PasswordHash}, previous...) {
+			if hash.CheckPassword(newPassword, passwordHash) {
+				return &PasswordPolicyError{
+					Violations: []models.PasswordViolation{password.ReusedViolation()},
+				}
+			}
+		}
+	}
+
+	hashedPassword, err := hash.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		return err
+	}
+
+	if history := s.passwordPolicy.History; history > 0 {
+		return s.userRepo.AddPasswordHistory(ctx, user.ID, user.PasswordHash, history)
+	}
+	return nil
+}
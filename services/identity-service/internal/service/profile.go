@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/events"
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/hash"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidPassword    = errors.New("current password is incorrect")
+	ErrPhoneAlreadyExists = errors.New("phone number already in use")
+	ErrContactUnchanged   = errors.New("new value is the same as the current one")
+)
+
+// ChangePassword changes a signed-in user's password after checking the
+// current one, then signs the user out of every other session. keepSessionID
+// is the session making the change, or nil to sign out everywhere.
+func (s *AuthService) ChangePassword(ctx context.Context, userID uuid.UUID, keepSessionID *uuid.UUID, req *models.ChangePasswordRequest, ipAddress string) error {
+	// Checked outside the transaction so a failed attempt stays counted
+	user, err := s.currentUserWithPassword(ctx, userID, req.CurrentPassword, ipAddress)
+	if err != nil {
+		return err
+	}
+
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		return s.setPassword(ctx, user, req.NewPassword)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.RevokeAllSessions(ctx, userID, keepSessionID)
+	return err
+}
+
+// RequestEmailChange sends a verification link to a new email address. The
+// user's email only changes once the link is verified with VerifyEmail.
+func (s *AuthService) RequestEmailChange(ctx context.Context, userID uuid.UUID, req *models.ChangeEmailRequest, ipAddress string) error {
+	user, err := s.currentUserWithPassword(ctx, userID, req.CurrentPassword, ipAddress)
+	if err != nil {
+		return err
+	}
+
+	if req.Email == user.Email {
+		return ErrContactUnchanged
+	}
+
+	existing, err := s.userRepo.GetUserByEmail(ctx, req.Email)
+	if err != nil && err != repository.ErrUserNotFound {
+		return err
+	}
+	if existing != nil {
+		return ErrEmailAlreadyExists
+	}
+
+	return s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		return s.sendVerification(ctx, user, models.VerificationChannelEmail, req.Email)
+	})
+}
+
+// RequestPhoneChange sends a one-time code to a new phone number. The user's
+// phone only changes once the code is verified with VerifyPhone.
+func (s *AuthService) RequestPhoneChange(ctx context.Context, userID uuid.UUID, req *models.ChangePhoneRequest, ipAddress string) error {
+	user, err := s.currentUserWithPassword(ctx, userID, req.CurrentPassword, ipAddress)
+	if err != nil {
+		return err
+	}
+
+	if user.Phone != nil && req.Phone == *user.Phone {
+		return ErrContactUnchanged
+	}
+
+	inUse, err := s.userRepo.PhoneInUse(ctx, req.Phone)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrPhoneAlreadyExists
+	}
+
+	return s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		return s.sendVerification(ctx, user, models.VerificationChannelPhone, req.Phone)
+	})
+}
+
+// currentUserWithPassword returns an active user after checking their
+// current password. Wrong passwords are throttled and count towards lockout
+// as failed logins do, so a stolen access token cannot be used to guess the
+// password. It must not run inside a transaction, which would roll the
+// failure back.
+func (s *AuthService) currentUserWithPassword(ctx context.Context, userID uuid.UUID, password, ipAddress string) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return nil, ErrAccountLocked
+	}
+	if !user.IsActive {
+		return nil, ErrAccountInactive
+	}
+
+	keys := s.loginKeys(ipAddress, user.Email)
+	if err := s.checkLoginThrottle(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	if !hash.CheckPassword(password, user.PasswordHash) {
+		if err := s.failLogin(ctx, keys, user.ID, ipAddress); err != ErrInvalidCredentials {
+			return nil, err
+		}
+		return nil, ErrInvalidPassword
+	}
+
+	if err := s.loginLimiter.Reset(ctx, keys[1:]...); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// changeContact switches a user to a newly verified email or phone number
+// and records a user.updated event. It must run inside a transaction.
+func (s *AuthService) changeContact(ctx context.Context, user *models.User, channel models.VerificationChannel, destination string) error {
+	updated := &events.UserUpdated{
+		UserID:        user.ID,
+		Email:         user.Email,
+		Phone:         user.Phone,
+		EmailVerified: user.EmailVerified,
+		PhoneVerified: user.PhoneVerified,
+		UpdatedAt:     time.Now(),
+	}
+
+	switch channel {
+	case models.VerificationChannelEmail:
+		err := s.userRepo.UpdateEmail(ctx, user.ID, destination)
+		if err == repository.ErrUserAlreadyExists {
+			return ErrEmailAlreadyExists
+		}
+		if err != nil {
+			return err
+		}
+
+		previous := user.Email
+		updated.Email = destination
+		updated.EmailVerified = true
+		updated.PreviousEmail = &previous
+		updated.ChangedFields = []string{"email"}
+	case models.VerificationChannelPhone:
+		err := s.userRepo.UpdatePhone(ctx, user.ID, destination)
+		if err == repository.ErrPhoneTaken {
+			return ErrPhoneAlreadyExists
+		}
+		if err != nil {
+			return err
+		}
+
+		updated.Phone = &destination
+		updated.PhoneVerified = true
+		updated.PreviousPhone = user.Phone
+		updated.ChangedFields = []string{"phone"}
+	}
+
+	return s.enqueue(ctx, user.ID, events.TypeUserUpdated, updated)
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleExists        = errors.New("role already exists")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrUserNotFound      = errors.New("user not found")
+)
+
+// Built-in roles, seeded with the schema
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
+)
+
+// roleError maps repository errors to service errors
+func roleError(err error) error {
+	switch err {
+	case repository.ErrRoleNotFound:
+		return ErrRoleNotFound
+	case repository.ErrRoleExists:
+		return ErrRoleExists
+	case repository.ErrUnknownPermission:
+		return ErrUnknownPermission
+	case repository.ErrUserNotFound:
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// ListRoles lists all roles with their permissions
+func (s *AuthService) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	return s.roleRepo.ListRoles(ctx)
+}
+
+// ListPermissions lists the permissions roles can grant
+func (s *AuthService) ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	return s.roleRepo.ListPermissions(ctx)
+}
+
+// CreateRole creates a role granting existing permissions
+func (s *AuthService) CreateRole(ctx context.Context, admin Admin, req *models.CreateRoleRequest) (*models.Role, error) {
+	role := &models.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+		CreatedAt:   time.Now(),
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.roleRepo.CreateRole(ctx, role); err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditCreateRole, nil, map[string]interface{}{
+			"role":        role.Name,
+			"permissions": role.Permissions,
+		})
+	})
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	return role, nil
+}
+
+// SetRolePermissions replaces a role's permissions. Users holding the role
+// get the new permissions when their access tokens are next refreshed.
+func (s *AuthService) SetRolePermissions(ctx context.Context, admin Admin, roleName string, permissions []string) error {
+	return roleError(s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.roleRepo.SetRolePermissions(ctx, roleName, permissions); err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditSetRolePermissions, nil, map[string]interface{}{
+			"role":        roleName,
+			"permissions": permissions,
+		})
+	}))
+}
+
+// GetUserRoles returns a user's roles and permissions
+func (s *AuthService) GetUserRoles(ctx context.Context, userID uuid.UUID) (*models.UserRoles, error) {
+	return s.roleRepo.GetUserRoles(ctx, userID)
+}
+
+// AssignRole gives a user a role
+func (s *AuthService) AssignRole(ctx context.Context, admin Admin, userID uuid.UUID, roleName string) error {
+	return roleError(s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.roleRepo.AssignRole(ctx, userID, roleName, &admin.ID); err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditAssignRole, &userID, map[string]interface{}{
+			"role": roleName,
+		})
+	}))
+}
+
+// RemoveRole takes a role away from a user. The user's access tokens are
+// revoked so the lost permissions cannot be used until they expire; the
+// next refresh issues tokens without them.
+func (s *AuthService) RemoveRole(ctx context.Context, admin Admin, userID uuid.UUID, roleName string) error {
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.roleRepo.RemoveRole(ctx, userID, roleName); err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditRemoveRole, &userID, map[string]interface{}{
+			"role": roleName,
+		})
+	})
+	if err != nil {
+		return roleError(err)
+	}
+
+	return s.revokeAllTokens(ctx, userID)
+}
+
+// GrantRoleByEmail gives the user with an email a role, for bootstrapping
+// the first administrator. There is no admin to record, so it is not
+// audited.
+func (s *AuthService) GrantRoleByEmail(ctx context.Context, email, roleName string) error {
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return roleError(err)
+	}
+
+	return roleError(s.roleRepo.AssignRole(ctx, user.ID, roleName, nil))
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+	"github.com/Caesarsage/bankflow/identity-service/internal/revocation"
+	"github.com/google/uuid"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// GetSessions lists a user's signed-in sessions, marking currentSessionID
+func (s *AuthService) GetSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]*models.ActiveSession, error) {
+	sessions, err := s.userRepo.GetActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession signs a user out of one session
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	err := s.userRepo.RevokeUserSession(ctx, userID, sessionID)
+	if err == repository.ErrSessionNotFound {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.revokeSessionTokens(ctx, userID, sessionID)
+}
+
+// RevokeAllSessions signs a user out everywhere, except keepSessionID if
+// given, and returns how many sessions were revoked
+func (s *AuthService) RevokeAllSessions(ctx context.Context, userID uuid.UUID, keepSessionID *uuid.UUID) (int, error) {
+	families, err := s.userRepo.RevokeUserSessions(ctx, userID, keepSessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	if keepSessionID == nil {
+		// Also catches tokens of sessions that were already revoked or
+		// rotated but whose access tokens have not expired yet
+		if err := s.revokeAllTokens(ctx, userID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := s.revokeSessionTokens(ctx, userID, families...); err != nil {
+		return 0, err
+	}
+
+	return len(families), nil
+}
+
+// AdminRevokeSession signs a user out of one session on an admin's behalf
+func (s *AuthService) AdminRevokeSession(ctx context.Context, admin Admin, userID, sessionID uuid.UUID) error {
+	return s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.RevokeSession(ctx, userID, sessionID); err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditRevokeSession, &userID, map[string]interface{}{
+			"session_id": sessionID,
+		})
+	})
+}
+
+// AdminRevokeAllSessions signs a user out everywhere on an admin's behalf
+// and returns how many sessions were revoked
+func (s *AuthService) AdminRevokeAllSessions(ctx context.Context, admin Admin, userID uuid.UUID) (int, error) {
+	var revoked int
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		revoked, err = s.RevokeAllSessions(ctx, userID, nil)
+		if err != nil {
+			return err
+		}
+
+		return s.audit(ctx, admin, AuditRevokeAllSessions, &userID, map[string]interface{}{
+			"sessions_revoked": revoked,
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return revoked, nil
+}
+
+// revokeSessionTokens revokes the access tokens issued for the given
+// sessions. Revocations last as long as the longest-lived of the tokens.
+func (s *AuthService) revokeSessionTokens(ctx context.Context, userID uuid.UUID, sessionIDs ...uuid.UUID) error {
+	until := time.Now().Add(s.jwtManager.AccessTokenDuration())
+	for _, sessionID := range sessionIDs {
+		if err := s.revoked.Revoke(ctx, revocation.KindSession, sessionID.String(), userID, until); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeAllTokens revokes every access token issued to a user so far.
+// Truncating to the second matches the precision of the iat claim, so a
+// token issued straight after is still accepted.
+func (s *AuthService) revokeAllTokens(ctx context.Context, userID uuid.UUID) error {
+	return s.revoked.SetValidAfter(ctx, userID, time.Now().Truncate(time.Second))
+}
+
+// revokeAccessToken revokes a single access token by its jti. Tokens that
+// are already invalid are ignored.
+func (s *AuthService) revokeAccessToken(ctx context.Context, accessToken string) error {
+	claims, err := s.jwtManager.ValidateAccessToken(accessToken)
+	if err != nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil
+	}
+
+	return s.revoked.Revoke(ctx, revocation.KindToken, claims.ID, userID, claims.ExpiresAt.Time)
+}
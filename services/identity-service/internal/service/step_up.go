@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/hash"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/jwt"
+	"github.com/google/uuid"
+)
+
+// SetStepUpTokenDuration sets how long elevated access tokens stay valid
+func (s *AuthService) SetStepUpTokenDuration(duration time.Duration) {
+	s.stepUpTokenDuration = duration
+}
+
+// StepUp re-authenticates a signed-in user with their password or a TOTP
+// code and issues a short-lived access token for their session, with
+// auth_time set to now, for routes that require recent authentication.
+// Failures count towards the account lockout like failed logins.
+func (s *AuthService) StepUp(ctx context.Context, userID, sessionID uuid.UUID, req *models.StepUpRequest, ipAddress string) (*models.StepUpResponse, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return nil, ErrAccountLocked
+	}
+	if !user.IsActive {
+		return nil, ErrAccountInactive
+	}
+
+	var amr []string
+	mismatch := false
+	if req.Code != "" {
+		amr = []string{jwt.AMROTP}
+		err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+			ok, err := s.checkTOTP(ctx, userID, req.Code)
+			if err != nil || ok {
+				return err
+			}
+			// Commit the failed attempt, then report the mismatch
+			mismatch = true
+			return s.recordFailedLogin(ctx, userID, ipAddress)
+		})
+	} else {
+		amr = []string{jwt.AMRPassword}
+		if !hash.CheckPassword(req.Password, user.PasswordHash) {
+			mismatch = true
+			err = s.recordFailedLogin(ctx, userID, ipAddress)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if mismatch {
+		if req.Code != "" {
+			return nil, ErrInvalidMFACode
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	identity, err := s.identityOf(ctx, user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	identity.AuthTime = time.Now()
+	identity.AMR = amr
+
+	accessToken, err := s.jwtManager.GenerateElevatedToken(identity, s.stepUpTokenDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.StepUpResponse{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(s.stepUpTokenDuration.Seconds()),
+		AuthTime:    identity.AuthTime,
+	}, nil
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/internal/events"
+	"github.com/Caesarsage/bankflow/identity-service/internal/models"
+	"github.com/Caesarsage/bankflow/identity-service/internal/repository"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/hash"
+	"github.com/Caesarsage/bankflow/identity-service/pkg/jwt"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrEmailNotVerified        = errors.New("email is not verified")
+	ErrPhoneNotVerified        = errors.New("phone is not verified")
+	ErrNoPhoneNumber           = errors.New("user has no phone number")
+	ErrAlreadyVerified         = errors.New("already verified")
+	ErrInvalidVerificationCode = errors.New("invalid or expired verification code")
+	ErrVerificationThrottled   = errors.New("verification code requested too recently")
+)
+
+const (
+	emailVerificationExpiry = 24 * time.Hour
+	phoneVerificationExpiry = 10 * time.Minute
+	phoneCodeDigits         = 6
+
+	// Resend throttling, per user and channel
+	verificationResendInterval = time.Minute
+	verificationMaxPerHour     = 5
+
+	// Wrong codes allowed before a phone code is burned
+	verificationMaxAttempts = 5
+)
+
+// LoginVerificationPolicy controls which channels must be verified before a
+// user can log in. Unverified users who are allowed in still get tokens whose
+// email_verified and phone_number_verified claims let other services restrict
+// them.
+type LoginVerificationPolicy string
+
+const (
+	LoginVerificationNone  LoginVerificationPolicy = "none"
+	LoginVerificationEmail LoginVerificationPolicy = "email"
+	LoginVerificationAll   LoginVerificationPolicy = "all"
+)
+
+// ParseLoginVerificationPolicy parses a policy name, defaulting to none
+func ParseLoginVerificationPolicy(value string) (LoginVerificationPolicy, error) {
+	switch LoginVerificationPolicy(value) {
+	case "", LoginVerificationNone:
+		return LoginVerificationNone, nil
+	case LoginVerificationEmail, LoginVerificationAll:
+		return LoginVerificationPolicy(value), nil
+	}
+	return "", errors.New("unknown login verification policy " + value)
+}
+
+// SetLoginVerificationPolicy sets which channels Login requires verified
+func (s *AuthService) SetLoginVerificationPolicy(policy LoginVerificationPolicy) {
+	s.verificationPolicy = policy
+}
+
+// checkLoginVerification enforces the login verification policy
+func (s *AuthService) checkLoginVerification(user *models.User) error {
+	switch s.verificationPolicy {
+	case LoginVerificationEmail:
+		if !user.EmailVerified {
+			return ErrEmailNotVerified
+		}
+	case LoginVerificationAll:
+		if !user.EmailVerified {
+			return ErrEmailNotVerified
+		}
+		if user.Phone != nil && !user.PhoneVerified {
+			return ErrPhoneNotVerified
+		}
+	}
+	return nil
+}
+
+// VerifyEmail verifies a user's email with the token from the verification
+// link. A link sent for an email change switches the user to the new address.
+func (s *AuthService) VerifyEmail(ctx context.Context, req *models.VerifyEmailRequest) error {
+	return s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		code, err := s.userRepo.GetActiveVerificationCodeByHash(ctx, models.VerificationChannelEmail, hash.HashToken(req.Token))
+		if err != nil {
+			if err == repository.ErrVerificationCodeNotFound {
+				return ErrInvalidVerificationCode
+			}
+			return err
+		}
+
+		user, err := s.userRepo.GetUserByID(ctx, code.UserID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.userRepo.ConsumeVerificationCode(ctx, code.ID); err != nil {
+			return err
+		}
+
+		if user.Email != code.Destination {
+			if err := s.changeContact(ctx, user, code.Channel, code.Destination); err != nil {
+				return err
+			}
+		} else if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return err
+		}
+
+		return s.publishUserVerified(ctx, code)
+	})
+}
+
+// ResendEmailVerification sends a new verification link. Unknown, inactive,
+// already verified and throttled requests are ignored silently so callers
+// cannot tell which emails are registered.
+func (s *AuthService) ResendEmailVerification(ctx context.Context, req *models.ResendVerificationRequest) error {
+	user, err := s.userRepo.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		if err == repository.ErrUserNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if !user.IsActive || user.EmailVerified {
+		return nil
+	}
+
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		return s.sendVerification(ctx, user, models.VerificationChannelEmail, user.Email)
+	})
+	if err == ErrVerificationThrottled {
+		return nil
+	}
+
+	return err
+}
+
+// SendPhoneVerification sends a one-time code to the user's phone
+func (s *AuthService) SendPhoneVerification(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Phone == nil {
+		return ErrNoPhoneNumber
+	}
+	if user.PhoneVerified {
+		return ErrAlreadyVerified
+	}
+
+	return s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		return s.sendVerification(ctx, user, models.VerificationChannelPhone, *user.Phone)
+	})
+}
+
+// VerifyPhone verifies the user's phone with a one-time code, or switches
+// the user to a new number if the code was sent for a phone change. Each
+// wrong code counts against the current code, which is burned after
+// verificationMaxAttempts failures.
+func (s *AuthService) VerifyPhone(ctx context.Context, userID uuid.UUID, req *models.VerifyPhoneRequest) error {
+	mismatch := false
+
+	err := s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		user, err := s.userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		code, err := s.userRepo.GetActiveVerificationCode(ctx, userID, models.VerificationChannelPhone)
+		if err == repository.ErrVerificationCodeNotFound {
+			switch {
+			case user.Phone == nil:
+				return ErrNoPhoneNumber
+			case user.PhoneVerified:
+				return ErrAlreadyVerified
+			}
+			return ErrInvalidVerificationCode
+		}
+		if err != nil {
+			return err
+		}
+
+		changing := user.Phone == nil || *user.Phone != code.Destination
+		if !changing && user.PhoneVerified {
+			return ErrAlreadyVerified
+		}
+
+		if subtle.ConstantTimeCompare([]byte(hash.HashToken(req.Code)), []byte(code.CodeHash)) != 1 {
+			// Commit the failed attempt, then report the mismatch
+			mismatch = true
+			_, err := s.userRepo.RecordVerificationAttempt(ctx, code.ID, verificationMaxAttempts)
+			return err
+		}
+
+		if err := s.userRepo.ConsumeVerificationCode(ctx, code.ID); err != nil {
+			return err
+		}
+
+		if changing {
+			if err := s.changeContact(ctx, user, code.Channel, code.Destination); err != nil {
+				return err
+			}
+		} else if err := s.userRepo.MarkPhoneVerified(ctx, userID); err != nil {
+			return err
+		}
+
+		return s.publishUserVerified(ctx, code)
+	})
+	if err != nil {
+		return err
+	}
+
+	if mismatch {
+		return ErrInvalidVerificationCode
+	}
+
+	return nil
+}
+
+// sendVerification issues a verification code for a destination on a
+// channel, enforcing resend throttling, and records a
+// user.verification_requested event for the notifier. A destination other
+// than the user's current one is a change that takes effect once verified.
+// It must run inside a transaction.
+func (s *AuthService) sendVerification(ctx context.Context, user *models.User, channel models.VerificationChannel, destination string) error {
+	now := time.Now()
+
+	count, last, err := s.userRepo.GetVerificationSendStats(ctx, user.ID, channel, now.Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if count >= verificationMaxPerHour || (last != nil && now.Sub(*last) < verificationResendInterval) {
+		return ErrVerificationThrottled
+	}
+
+	var secret string
+	var expiry time.Duration
+	switch channel {
+	case models.VerificationChannelEmail:
+		secret, err = hash.GenerateToken()
+		expiry = emailVerificationExpiry
+	case models.VerificationChannelPhone:
+		secret, err = hash.GenerateNumericCode(phoneCodeDigits)
+		expiry = phoneVerificationExpiry
+	}
+	if err != nil {
+		return err
+	}
+
+	code := &models.VerificationCode{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		Channel:     channel,
+		Destination: destination,
+		CodeHash:    hash.HashToken(secret),
+		ExpiresAt:   now.Add(expiry),
+		CreatedAt:   now,
+	}
+
+	if err := s.userRepo.CreateVerificationCode(ctx, code); err != nil {
+		return err
+	}
+
+	return s.enqueue(ctx, user.ID, events.TypeUserVerificationRequested, &events.UserVerificationRequested{
+		UserID:      user.ID,
+		Channel:     string(channel),
+		Destination: destination,
+		Code:        secret,
+		ExpiresAt:   code.ExpiresAt,
+	})
+}
+
+func (s *AuthService) publishUserVerified(ctx context.Context, code *models.VerificationCode) error {
+	return s.enqueue(ctx, code.UserID, events.TypeUserVerified, &events.UserVerified{
+		UserID:      code.UserID,
+		Channel:     string(code.Channel),
+		Destination: code.Destination,
+		VerifiedAt:  time.Now(),
+	})
+}
+
+// identityOf returns the token identity of a user signed in to a session
+// family, including the permissions of the user's roles
+func (s *AuthService) identityOf(ctx context.Context, user *models.User, sessionID uuid.UUID) (jwt.Identity, error) {
+	roles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return jwt.Identity{}, err
+	}
+
+	return jwt.Identity{
+		UserID:        user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		PhoneVerified: user.PhoneVerified,
+		SessionID:     sessionID,
+		Roles:         roles.Roles,
+		Permissions:   roles.Permissions,
+	}, nil
+}
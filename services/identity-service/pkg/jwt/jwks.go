@@ -0,0 +1,200 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWK is a public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK encodes an RSA or Ed25519 public key
+func NewJWK(kid, alg string, public crypto.PublicKey) (*JWK, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: alg,
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Kid: kid,
+			Use: "sig",
+			Alg: alg,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", public)
+}
+
+// PublicKey decodes the key
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// JWKSClient fetches and caches a remote JWKS. Keys are refetched once the
+// cache is older than ttl, or when a token names an unknown kid, but never
+// more often than every minRefresh so bad tokens cannot hammer the issuer.
+// If a refresh fails, the cached keys keep being served.
+type JWKSClient struct {
+	url        string
+	client     *http.Client
+	ttl        time.Duration
+	minRefresh time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func NewJWKSClient(url string, ttl time.Duration) *JWKSClient {
+	return &JWKSClient{
+		url:        url,
+		client:     &http.Client{Timeout: 5 * time.Second},
+		ttl:        ttl,
+		minRefresh: 30 * time.Second,
+		keys:       map[string]crypto.PublicKey{},
+	}
+}
+
+// PublicKey returns the public key for a key ID
+func (c *JWKSClient) PublicKey(kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[kid]
+	age := time.Since(c.fetchedAt)
+
+	if (ok && age < c.ttl) || (!ok && age < c.minRefresh) {
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		return key, nil
+	}
+
+	if err := c.refresh(context.Background()); err != nil && !ok {
+		return nil, err
+	}
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (c *JWKSClient) refresh(ctx context.Context) error {
+	// Count failed fetches too, so minRefresh also limits retries
+	c.fetchedAt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch %s: %s", c.url, resp.Status)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decode %s: %w", c.url, err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	c.keys = keys
+	return nil
+}
+
+// JWKSValidator validates access tokens against a remote JWKS, for services
+// that accept tokens but must not be able to mint them
+type JWKSValidator struct {
+	client *JWKSClient
+}
+
+func NewJWKSValidator(url string, ttl time.Duration) *JWKSValidator {
+	return &JWKSValidator{
+		client: NewJWKSClient(url, ttl),
+	}
+}
+
+// ValidateAccessToken validates an access token
+func (v *JWKSValidator) ValidateAccessToken(tokenString string) (*Claims, error) {
+	return parseAccessToken(tokenString, v.client.PublicKey)
+}
@@ -1,7 +1,9 @@
 package jwt
 
 import (
+	"crypto"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,13 +15,87 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
+const issuer = "bankflow-identity-service"
+
+// Authentication methods in the amr claim (RFC 8176)
+const (
+	AMRPassword = "pwd"
+	AMROTP      = "otp"
+	AMRMFA      = "mfa"
+)
+
+// Values of the token_use claim, which keeps refresh tokens from being
+// accepted as access tokens and the other way round
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+)
+
+// validMethods are the only algorithms accepted, so a token cannot pick a
+// weaker one (or "none") through its header
+var validMethods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+
 // Claims represents JWT claims
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID        string   `json:"user_id"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	PhoneVerified bool     `json:"phone_number_verified"`
+	SessionID     string   `json:"sid,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
+	// ClientID and Scope are set on tokens issued to machine clients: OAuth
+	// clients, which have no UserID, and API keys, which act for their owner
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// AuthTime is when the user last proved who they are, at login or step
+	// up, and AMR how. Tokens issued to machine clients have neither.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	// TokenUse is always TokenUseAccess
+	TokenUse string `json:"token_use"`
+	jwt.RegisteredClaims
+}
+
+// refreshClaims are the claims of a refresh token
+type refreshClaims struct {
+	TokenUse string `json:"token_use"`
 	jwt.RegisteredClaims
 }
 
+// HasPermission reports whether the token grants a permission
+func (c *Claims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticatedWithin reports whether the user authenticated no longer than
+// maxAge ago
+func (c *Claims) AuthenticatedWithin(maxAge time.Duration) bool {
+	return c.AuthTime != nil && time.Since(c.AuthTime.Time) <= maxAge
+}
+
+// Identity is the user information carried in an access token. SessionID
+// is the session the token was issued for. Tokens for machine clients set
+// ClientID and Scopes, and UserID only if the client acts for a user.
+type Identity struct {
+	UserID        uuid.UUID
+	Email         string
+	EmailVerified bool
+	PhoneVerified bool
+	SessionID     uuid.UUID
+	Roles         []string
+	Permissions   []string
+	ClientID      string
+	Scopes        []string
+	AuthTime      time.Time
+	AMR           []string
+}
+
 // TokenPair represents access and refresh tokens
 type TokenPair struct {
 	AccessToken  string
@@ -27,61 +103,122 @@ type TokenPair struct {
 	ExpiresIn    int64
 }
 
+// AccessTokenValidator validates access tokens, either with local keys
+// (JWTManager) or keys fetched from the issuer (JWKSValidator)
+type AccessTokenValidator interface {
+	ValidateAccessToken(tokenString string) (*Claims, error)
+}
+
 // JWTManager manages JWT tokens
 type JWTManager struct {
-	secretKey            string
+	keys                 *KeySet
 	accessTokenDuration  time.Duration
 	refreshTokenDuration time.Duration
 }
 
-func NewJWTManager(secretKey string, accessTokenDuration, refreshTokenDuration time.Duration) *JWTManager {
+func NewJWTManager(keys *KeySet, accessTokenDuration, refreshTokenDuration time.Duration) *JWTManager {
 	return &JWTManager{
-		secretKey:            secretKey,
+		keys:                 keys,
 		accessTokenDuration:  accessTokenDuration,
 		refreshTokenDuration: refreshTokenDuration,
 	}
 }
 
-// GenerateAccessToken generates a new access token
-func (m *JWTManager) GenerateAccessToken(userID uuid.UUID, email string) (string, error) {
+// Keys returns the manager's key set
+func (m *JWTManager) Keys() *KeySet {
+	return m.keys
+}
+
+// AccessTokenDuration returns how long access tokens stay valid
+func (m *JWTManager) AccessTokenDuration() time.Duration {
+	return m.accessTokenDuration
+}
+
+// GenerateAccessToken generates a new access token. The jti lets a single
+// token be revoked before it expires. Tokens without a user have the client
+// as their subject.
+func (m *JWTManager) GenerateAccessToken(identity Identity) (string, error) {
+	return m.generateAccessToken(identity, m.accessTokenDuration)
+}
+
+// GenerateElevatedToken generates an access token that expires after
+// duration, meant to be short, for a user who has just stepped up
+func (m *JWTManager) GenerateElevatedToken(identity Identity, duration time.Duration) (string, error) {
+	return m.generateAccessToken(identity, duration)
+}
+
+func (m *JWTManager) generateAccessToken(identity Identity, duration time.Duration) (string, error) {
+	var authTime *jwt.NumericDate
+	if !identity.AuthTime.IsZero() {
+		authTime = jwt.NewNumericDate(identity.AuthTime)
+	}
+
+	userID, subject := identity.UserID.String(), identity.UserID.String()
+	if identity.UserID == uuid.Nil {
+		userID, subject = "", identity.ClientID
+	}
+
 	claims := Claims{
-		UserID: userID.String(),
-		Email:  email,
+		UserID:        userID,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		PhoneVerified: identity.PhoneVerified,
+		SessionID:     identity.SessionID.String(),
+		Roles:         identity.Roles,
+		Permissions:   identity.Permissions,
+		ClientID:      identity.ClientID,
+		Scope:         strings.Join(identity.Scopes, " "),
+		AuthTime:      authTime,
+		AMR:           identity.AMR,
+		TokenUse:      TokenUseAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.accessTokenDuration)),
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "bankflow-identity-service",
-			Subject:   userID.String(),
+			Issuer:    issuer,
+			Subject:   subject,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.secretKey))
+	return m.sign(claims)
 }
 
-// GenerateRefreshToken generates a new refresh token
+// GenerateRefreshToken generates a new refresh token. The jti makes every
+// token unique, even two issued to the same user in the same second.
 func (m *JWTManager) GenerateRefreshToken(userID uuid.UUID) (string, error) {
-	claims := jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.refreshTokenDuration)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		Issuer:    "bankflow-identity-service",
-		Subject:   userID.String(),
+	claims := refreshClaims{
+		TokenUse: TokenUseRefresh,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.refreshTokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    issuer,
+			Subject:   userID.String(),
+		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.secretKey))
+	return m.sign(claims)
+}
+
+// sign signs claims with the active key and names it in the kid header
+func (m *JWTManager) sign(claims jwt.Claims) (string, error) {
+	key := m.keys.Active()
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
 }
 
 // GenerateTokenPair generates both access and refresh tokens
-func (m *JWTManager) GenerateTokenPair(userID uuid.UUID, email string) (*TokenPair, error) {
-	accessToken, err := m.GenerateAccessToken(userID, email)
+func (m *JWTManager) GenerateTokenPair(identity Identity) (*TokenPair, error) {
+	accessToken, err := m.GenerateAccessToken(identity)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, err := m.GenerateRefreshToken(userID)
+	refreshToken, err := m.GenerateRefreshToken(identity.UserID)
 	if err != nil {
 		return nil, err
 	}
@@ -95,51 +232,61 @@ func (m *JWTManager) GenerateTokenPair(userID uuid.UUID, email string) (*TokenPa
 
 // ValidateAccessToken validates an access token
 func (m *JWTManager) ValidateAccessToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(m.secretKey), nil
-	})
+	return parseAccessToken(tokenString, m.keys.PublicKey)
+}
 
-	if err != nil {
+// ValidateRefreshToken validates a refresh token
+func (m *JWTManager) ValidateRefreshToken(tokenString string) (*jwt.RegisteredClaims, error) {
+	claims := &refreshClaims{}
+	if err := parse(tokenString, claims, m.keys.PublicKey); err != nil {
 		return nil, err
 	}
-
-	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
+	if claims.TokenUse != TokenUseRefresh {
 		return nil, ErrInvalidToken
 	}
 
-	if time.Now().After(claims.ExpiresAt.Time) {
-		return nil, ErrExpiredToken
+	return &claims.RegisteredClaims, nil
+}
+
+// parseAccessToken validates an access token, rejecting refresh and other
+// tokens signed with the same keys
+func parseAccessToken(tokenString string, publicKey func(kid string) (crypto.PublicKey, error)) (*Claims, error) {
+	claims := &Claims{}
+	if err := parse(tokenString, claims, publicKey); err != nil {
+		return nil, err
+	}
+	if claims.TokenUse != TokenUseAccess {
+		return nil, ErrInvalidToken
 	}
 
 	return claims, nil
 }
 
-// ValidateRefreshToken validates a refresh token
-func (m *JWTManager) ValidateRefreshToken(tokenString string) (*jwt.RegisteredClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+// parse verifies a token's signature with the key named by its kid header
+// and checks its expiry and issuer
+func parse(tokenString string, claims jwt.Claims, publicKey func(kid string) (crypto.PublicKey, error)) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
 			return nil, ErrInvalidToken
 		}
-		return []byte(m.secretKey), nil
-	})
+		return publicKey(kid)
+	},
+		jwt.WithValidMethods(validMethods),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
 
-	if err != nil {
-		return nil, err
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return ErrExpiredToken
 	}
-
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok || !token.Valid {
-		return nil, ErrInvalidToken
+	if err != nil {
+		return err
 	}
 
-	if time.Now().After(claims.ExpiresAt.Time) {
-		return nil, ErrExpiredToken
+	if !token.Valid {
+		return ErrInvalidToken
 	}
 
-	return claims, nil
+	return nil
 }
-
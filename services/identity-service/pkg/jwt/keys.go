@@ -0,0 +1,196 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// SigningKey is an asymmetric key identified by the kid header of the tokens
+// it signs
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+}
+
+// Public returns the key's public half
+func (k *SigningKey) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// NewSigningKey wraps an RSA or Ed25519 private key
+func NewSigningKey(id string, private crypto.Signer) (*SigningKey, error) {
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %s: RSA keys must be at least 2048 bits", id)
+		}
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, Private: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Private: key}, nil
+	}
+	return nil, fmt.Errorf("key %s: unsupported key type %T", id, private)
+}
+
+// GenerateEd25519Key creates a new random Ed25519 signing key
+func GenerateEd25519Key(id string) (*SigningKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigningKey(id, private)
+}
+
+// LoadKeyDir loads every *.pem private key in dir. The file name without its
+// extension is the key ID, so date-based names like 2025-06-01.pem sort in
+// rotation order. RSA keys may be PKCS#1 or PKCS#8; Ed25519 keys are PKCS#8.
+func LoadKeyDir(dir string) ([]*SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	keys := []*SigningKey{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		key, err := parsePrivateKey(id, data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no *.pem keys in %s", dir)
+	}
+
+	return keys, nil
+}
+
+func parsePrivateKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM block", id)
+	}
+
+	var private interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key %s: unsupported key type %T", id, private)
+	}
+
+	return NewSigningKey(id, signer)
+}
+
+// KeySet holds the keys published in the JWKS. Tokens are signed with the
+// active key; the others stay published so tokens they signed keep
+// validating until they expire.
+type KeySet struct {
+	keys   map[string]*SigningKey
+	order  []string
+	active *SigningKey
+}
+
+// NewKeySet creates a key set. An empty activeID selects the last key, which
+// for date-named key files is the newest.
+func NewKeySet(keys []*SigningKey, activeID string) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("key set needs at least one key")
+	}
+
+	set := &KeySet{keys: map[string]*SigningKey{}}
+	for _, key := range keys {
+		if _, exists := set.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key ID %s", key.ID)
+		}
+		set.keys[key.ID] = key
+		set.order = append(set.order, key.ID)
+	}
+
+	if activeID == "" {
+		activeID = keys[len(keys)-1].ID
+	}
+
+	active, ok := set.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %s not found", activeID)
+	}
+	set.active = active
+
+	return set, nil
+}
+
+// Active returns the key new tokens are signed with
+func (s *KeySet) Active() *SigningKey {
+	return s.active
+}
+
+// PublicKey returns the public key for a key ID
+func (s *KeySet) PublicKey(kid string) (crypto.PublicKey, error) {
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key.Public(), nil
+}
+
+// Algorithms returns the distinct signing algorithms of the keys
+func (s *KeySet) Algorithms() []string {
+	algs := []string{}
+	seen := map[string]bool{}
+	for _, id := range s.order {
+		alg := s.keys[id].Method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// JWKS returns the public keys in JWKS form
+func (s *KeySet) JWKS() (*JWKSet, error) {
+	set := &JWKSet{Keys: []JWK{}}
+	for _, id := range s.order {
+		key := s.keys[id]
+		jwk, err := NewJWK(key.ID, key.Method.Alg(), key.Public())
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, *jwk)
+	}
+	return set, nil
+}
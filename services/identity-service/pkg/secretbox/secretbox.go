@@ -0,0 +1,67 @@
+// Package secretbox encrypts small secrets for storage with AES-256-GCM.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+)
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// Box seals and opens secrets with a single key
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a box from a 32-byte key
+func New(key []byte) (*Box, error) {
+	if len(key) != 32 {
+		return nil, errors.New("secretbox key must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts plaintext and returns base64 of nonce and ciphertext
+func (b *Box) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value produced by Seal
+func (b *Box) Open(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+
+	size := b.aead.NonceSize()
+	if len(data) < size {
+		return "", ErrInvalidCiphertext
+	}
+
+	plaintext, err := b.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+
+	return string(plaintext), nil
+}
@@ -0,0 +1,134 @@
+package totp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Caesarsage/bankflow/identity-service/pkg/totp"
+)
+
+// rfcSecret is the SHA1 key from RFC 6238 appendix B, "12345678901234567890"
+// in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestCodeMatchesRFC6238 checks codes against the SHA1 test vectors of
+// RFC 6238 appendix B, truncated to six digits
+func TestCodeMatchesRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		step := totp.Step(time.Unix(tt.unix, 0))
+
+		got, err := totp.Code(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %q, want %q", tt.unix, got, tt.want)
+		}
+
+		lower, err := totp.Code(strings.ToLower(rfcSecret), step)
+		if err != nil {
+			t.Fatalf("Code(%d) with lowercase secret: %v", tt.unix, err)
+		}
+		if lower != tt.want {
+			t.Errorf("Code(%d) with lowercase secret = %q, want %q", tt.unix, lower, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totp.Step(now)
+
+	code := func(step int64) string {
+		c, err := totp.Code(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("Code(%d): %v", step, err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code(current), 1, current, true},
+		{"previous step within skew", code(current - 1), 1, current - 1, true},
+		{"next step within skew", code(current + 1), 1, current + 1, true},
+		{"previous step without skew", code(current - 1), 0, 0, false},
+		{"two steps behind", code(current - 2), 1, 0, false},
+		{"two steps ahead", code(current + 2), 1, 0, false},
+		{"wrong code", "000000", 1, 0, false},
+		{"too short", code(current)[:5], 1, 0, false},
+		{"too long", code(current) + "0", 1, 0, false},
+		{"empty", "", 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := totp.Validate(rfcSecret, tt.code, now, tt.skew)
+			if ok != tt.wantOK {
+				t.Fatalf("Validate ok = %v, want %v", ok, tt.wantOK)
+			}
+			if step != tt.wantStep {
+				t.Errorf("Validate step = %d, want %d", step, tt.wantStep)
+			}
+		})
+	}
+}
+
+// TestValidateReturnsStepForReplayCheck checks that a code accepted again
+// later still reports the step it was issued for, so callers rejecting steps
+// at or before the last accepted one refuse the replay
+func TestValidateReturnsStepForReplayCheck(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totp.Step(now)
+
+	c, err := totp.Code(rfcSecret, current)
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+
+	lastUsed, ok := totp.Validate(rfcSecret, c, now, 1)
+	if !ok {
+		t.Fatal("first use rejected")
+	}
+
+	replayed, ok := totp.Validate(rfcSecret, c, now.Add(totp.Period), 1)
+	if !ok {
+		t.Fatal("replay within skew not matched")
+	}
+	if replayed > lastUsed {
+		t.Errorf("replayed step = %d, want at most last used %d", replayed, lastUsed)
+	}
+
+	next, err := totp.Code(rfcSecret, current+1)
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+	step, ok := totp.Validate(rfcSecret, next, now.Add(totp.Period), 1)
+	if !ok || step <= lastUsed {
+		t.Errorf("next code step = %d (ok %v), want after last used %d", step, ok, lastUsed)
+	}
+}
+
+func TestValidateRejectsInvalidSecret(t *testing.T) {
+	if _, ok := totp.Validate("not base32!", "123456", time.Now(), 1); ok {
+		t.Error("Validate accepted a code for an undecodable secret")
+	}
+}
@@ -1,5 +1,6 @@
 import * as grpc from '@grpc/grpc-js';
 import * as protoLoader from '@grpc/proto-loader';
+import fs from 'fs';
 import path from 'path';
 
 const PROTO_PATH = path.join(__dirname, '../../proto/account/account.proto');
@@ -14,6 +15,29 @@ const packageDefinition = protoLoader.loadSync(PROTO_PATH, {
 
 const accountProto = grpc.loadPackageDefinition(packageDefinition).account as any;
 
+/**
+ * Builds channel credentials for the Account Service. With
+ * ACCOUNT_GRPC_TLS_CA set the server certificate is verified, and with
+ * ACCOUNT_GRPC_TLS_CERT and ACCOUNT_GRPC_TLS_KEY also set this service
+ * authenticates with its client certificate (mutual TLS).
+ */
+function accountServiceCredentials(): grpc.ChannelCredentials {
+  const caFile = process.env.ACCOUNT_GRPC_TLS_CA;
+  if (!caFile) {
+    console.warn('ACCOUNT_GRPC_TLS_CA not set, connecting to Account Service without TLS');
+    return grpc.credentials.createInsecure();
+  }
+
+  const certFile = process.env.ACCOUNT_GRPC_TLS_CERT;
+  const keyFile = process.env.ACCOUNT_GRPC_TLS_KEY;
+
+  return grpc.credentials.createSsl(
+    fs.readFileSync(caFile),
+    keyFile ? fs.readFileSync(keyFile) : null,
+    certFile ? fs.readFileSync(certFile) : null
+  );
+}
+
 /**
  * Account Service gRPC Client
  * Handles all communication with the Account Service via gRPC
@@ -24,7 +48,7 @@ export class AccountGRPCClient {
   constructor(serverAddress: string = 'localhost:50051') {
     this.client = new accountProto.AccountService(
       serverAddress,
-      grpc.credentials.createInsecure()
+      accountServiceCredentials()
     );
   }
 